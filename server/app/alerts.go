@@ -0,0 +1,358 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultAlertThresholds apply to households that never configured alerts.
+var defaultAlertThresholds = []int{80, 100}
+
+const maxAlertThresholds = 5
+
+// parseThresholds reads a comma separated list of percentages as stored in
+// the database.
+func parseThresholds(s string) []int {
+	thresholds := []int{}
+	for _, part := range strings.Split(s, ",") {
+		if v, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			thresholds = append(thresholds, v)
+		}
+	}
+	return thresholds
+}
+
+// formatThresholds validates, sorts and de-duplicates thresholds for
+// storage.
+func formatThresholds(thresholds []int) (string, error) {
+	if len(thresholds) > maxAlertThresholds {
+		return "", fmt.Errorf("at most %d thresholds are allowed", maxAlertThresholds)
+	}
+	sorted := append([]int(nil), thresholds...)
+	sort.Ints(sorted)
+	parts := []string{}
+	for i, v := range sorted {
+		if v < 1 || v > 1000 {
+			return "", fmt.Errorf("thresholds must be between 1 and 1000")
+		}
+		if i > 0 && v == sorted[i-1] {
+			continue
+		}
+		parts = append(parts, strconv.Itoa(v))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// householdThresholds returns the household-wide alert thresholds.
+func householdThresholds(household Household) []int {
+	if household.AlertThresholds == nil {
+		return defaultAlertThresholds
+	}
+	return parseThresholds(*household.AlertThresholds)
+}
+
+// categoryThresholds returns the thresholds in effect for a category.
+func categoryThresholds(household Household, category Category) []int {
+	if category.AlertThresholds == nil {
+		return householdThresholds(household)
+	}
+	return parseThresholds(*category.AlertThresholds)
+}
+
+// checkBudgetAlerts records the thresholds newly reached by a category in
+// the month of date and emails opted-in members about them. Each threshold
+// is recorded at most once per category and month, so repeated checks and
+// concurrent requests never alert twice.
+func (h *Handlers) checkBudgetAlerts(householdID, categoryID string, date time.Time) ([]BudgetAlert, error) {
+	var category Category
+	if err := h.db.Where("id = ? AND household_id = ?", categoryID, householdID).First(&category).Error; err != nil {
+		return nil, nil // Uncategorized or unknown: nothing to check
+	}
+	if category.MonthlyBudget <= 0 {
+		return nil, nil
+	}
+	var household Household
+	if err := h.db.First(&household, "id = ?", householdID).Error; err != nil {
+		return nil, err
+	}
+	thresholds := categoryThresholds(household, category)
+	if len(thresholds) == 0 {
+		return nil, nil
+	}
+
+	date = date.UTC()
+	startOfMonth := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var spent float64
+	if err := h.db.Model(&Transaction{}).
+		Where("household_id = ? AND category_id = ? AND date >= ? AND date < ?", householdID, categoryID, startOfMonth, startOfMonth.AddDate(0, 1, 0)).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&spent).Error; err != nil {
+		return nil, err
+	}
+
+	// Alerts and their emails are recorded together
+	var fired []BudgetAlert
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for _, threshold := range thresholds {
+			if spent < category.MonthlyBudget*float64(threshold)/100 {
+				break
+			}
+			alert := BudgetAlert{
+				ID:          uuid.New().String(),
+				HouseholdID: householdID,
+				CategoryID:  categoryID,
+				Period:      startOfMonth.Format("2006-01"),
+				Threshold:   threshold,
+				Spent:       spent,
+				Budget:      category.MonthlyBudget,
+			}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&alert)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				fired = append(fired, alert)
+			}
+		}
+		if len(fired) == 0 {
+			return nil
+		}
+
+		// Only the highest threshold reached is worth an email
+		recipients, err := budgetAlertRecipients(tx, householdID)
+		if err != nil {
+			return err
+		}
+		for _, to := range recipients {
+			if err := h.QueueBudgetAlertEmail(tx, to, fired[len(fired)-1], string(category.Name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, alert := range fired {
+		h.publishEvent(householdID, EventBudgetAlertTriggered, alert)
+	}
+	return fired, nil
+}
+
+// budgetAlertRecipients returns the emails of the household members who
+// opted in to budget alerts.
+func budgetAlertRecipients(db *gorm.DB, householdID string) ([]string, error) {
+	var users []User
+	if err := db.Where("id IN (?) AND budget_alerts = ?", memberIDs(db, householdID), true).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	var emails []string
+	for _, u := range users {
+		if u.Email != "" {
+			emails = append(emails, string(u.Email))
+		}
+	}
+	return emails, nil
+}
+
+// afterTransactionSaved runs the checks that follow a new or edited
+// transaction. Failures are logged: the transaction itself was saved.
+func (h *Handlers) afterTransactionSaved(t Transaction) {
+	if _, err := h.checkBudgetAlerts(t.HouseholdID, t.CategoryID, t.Date); err != nil {
+		log.Printf("Error checking budget alerts for household %s: %v", t.HouseholdID, err)
+	}
+}
+
+// ============================================================================
+// ALERT SETTINGS
+// ============================================================================
+
+type CategoryAlertSettings struct {
+	CategoryID string `json:"category_id"`
+	Name       string `json:"name"`
+	Thresholds []int  `json:"thresholds"`
+	Inherited  bool   `json:"inherited"`
+}
+
+type AlertSettings struct {
+	Thresholds []int                   `json:"thresholds"`
+	Categories []CategoryAlertSettings `json:"categories"`
+	// Subscribed tells whether the current user receives alert emails.
+	Subscribed bool `json:"subscribed"`
+}
+
+func (h *Handlers) GetAlertSettings(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var household Household
+	if err := h.db.First(&household, "id = ?", householdID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found"})
+		return
+	}
+	var categories []Category
+	if err := h.db.Where("household_id = ?", householdID).Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	settings := AlertSettings{
+		Thresholds: householdThresholds(household),
+		Categories: []CategoryAlertSettings{},
+	}
+	for _, cat := range categories {
+		settings.Categories = append(settings.Categories, CategoryAlertSettings{
+			CategoryID: cat.ID,
+			Name:       string(cat.Name),
+			Thresholds: categoryThresholds(household, cat),
+			Inherited:  cat.AlertThresholds == nil,
+		})
+	}
+
+	var user User
+	if err := h.db.First(&user, "id = ?", c.GetString("user_id")).Error; err == nil {
+		settings.Subscribed = user.BudgetAlerts
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateAlertSettings sets the household thresholds. An empty list disables
+// alerts for categories without their own thresholds.
+func (h *Handlers) UpdateAlertSettings(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var req struct {
+		Thresholds []int `json:"thresholds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Thresholds == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "thresholds is required"})
+		return
+	}
+	thresholds, err := formatThresholds(req.Thresholds)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := h.db.Model(&Household{}).Where("id = ?", householdID).Update("alert_thresholds", thresholds)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert settings"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"thresholds": parseThresholds(thresholds)})
+}
+
+// UpdateCategoryAlerts sets a category's own thresholds and returns its
+// settings. Null goes back to the household thresholds and an empty list
+// disables its alerts.
+func (h *Handlers) UpdateCategoryAlerts(c *gin.Context) {
+	householdID := c.Param("household_id")
+	id := c.Param("id")
+
+	var req struct {
+		Thresholds *[]int `json:"thresholds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var value *string
+	if req.Thresholds != nil {
+		thresholds, err := formatThresholds(*req.Thresholds)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		value = &thresholds
+	}
+
+	result := h.db.Model(&Category{}).Where("id = ? AND household_id = ?", id, householdID).Update("alert_thresholds", value)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category alerts"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	var category Category
+	if err := h.db.First(&category, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category"})
+		return
+	}
+	h.publishEvent(householdID, EventCategoryUpdated, category)
+
+	var household Household
+	if err := h.db.First(&household, "id = ?", householdID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch household"})
+		return
+	}
+	c.JSON(http.StatusOK, CategoryAlertSettings{
+		CategoryID: category.ID,
+		Name:       string(category.Name),
+		Thresholds: categoryThresholds(household, category),
+		Inherited:  category.AlertThresholds == nil,
+	})
+}
+
+// UpdateAlertSubscription opts the current user in or out of alert emails.
+func (h *Handlers) UpdateAlertSubscription(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "enabled is required"})
+		return
+	}
+
+	if err := h.db.Model(&User{}).Where("id = ?", c.GetString("user_id")).Update("budget_alerts", *req.Enabled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscribed": *req.Enabled})
+}
+
+// GetBudgetAlerts lists the alerts fired for the household, optionally for
+// a single month.
+func (h *Handlers) GetBudgetAlerts(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	query := h.db.Where("household_id = ?", householdID)
+	if period := c.Query("period"); period != "" {
+		if _, err := time.Parse("2006-01", period); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period format. Use YYYY-MM"})
+			return
+		}
+		query = query.Where("period = ?", period)
+	}
+
+	alerts := []BudgetAlert{}
+	if err := query.Order("created_at DESC").Limit(100).Find(&alerts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, alerts)
+}
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckBudgetAlerts(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-alerts"
+	date := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	db.Create(&Household{ID: householdID, Name: "Home"})
+	db.Create(&User{ID: "u1", Email: "in@example.com", HouseholdID: householdID, BudgetAlerts: true})
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: householdID, MonthlyBudget: 100})
+	custom := "50"
+	db.Create(&Category{ID: "cat-2", Name: "Fun", HouseholdID: householdID, MonthlyBudget: 100, AlertThresholds: &custom})
+	disabled := ""
+	db.Create(&Category{ID: "cat-3", Name: "Rent", HouseholdID: householdID, MonthlyBudget: 100, AlertThresholds: &disabled})
+
+	db.Create(&Transaction{ID: "t1", HouseholdID: householdID, CategoryID: "cat-1", Amount: 70, Date: date})
+	fired, err := h.checkBudgetAlerts(householdID, "cat-1", date)
+	require.NoError(t, err)
+	assert.Empty(t, fired)
+
+	// Crossing 80% fires once
+	db.Create(&Transaction{ID: "t2", HouseholdID: householdID, CategoryID: "cat-1", Amount: 15, Date: date})
+	fired, err = h.checkBudgetAlerts(householdID, "cat-1", date)
+	require.NoError(t, err)
+	require.Len(t, fired, 1)
+	assert.Equal(t, 80, fired[0].Threshold)
+	assert.Equal(t, "2024-05", fired[0].Period)
+	assert.Equal(t, 85.0, fired[0].Spent)
+
+	var queued int64
+	db.Model(&OutboxEmail{}).Where("household_id = ? AND template = ?", householdID, "budget_alert").Count(&queued)
+	assert.Equal(t, int64(1), queued)
+
+	fired, err = h.checkBudgetAlerts(householdID, "cat-1", date)
+	require.NoError(t, err)
+	assert.Empty(t, fired)
+
+	// Jumping past 100% only fires the thresholds not reached before
+	db.Create(&Transaction{ID: "t3", HouseholdID: householdID, CategoryID: "cat-1", Amount: 40, Date: date})
+	fired, err = h.checkBudgetAlerts(householdID, "cat-1", date)
+	require.NoError(t, err)
+	require.Len(t, fired, 1)
+	assert.Equal(t, 100, fired[0].Threshold)
+
+	// A new month is a new period
+	nextMonth := date.AddDate(0, 1, 0)
+	db.Create(&Transaction{ID: "t4", HouseholdID: householdID, CategoryID: "cat-1", Amount: 200, Date: nextMonth})
+	fired, err = h.checkBudgetAlerts(householdID, "cat-1", nextMonth)
+	require.NoError(t, err)
+	assert.Len(t, fired, 2)
+
+	// Category overrides
+	db.Create(&Transaction{ID: "t5", HouseholdID: householdID, CategoryID: "cat-2", Amount: 60, Date: date})
+	fired, err = h.checkBudgetAlerts(householdID, "cat-2", date)
+	require.NoError(t, err)
+	require.Len(t, fired, 1)
+	assert.Equal(t, 50, fired[0].Threshold)
+
+	db.Create(&Transaction{ID: "t6", HouseholdID: householdID, CategoryID: "cat-3", Amount: 500, Date: date})
+	fired, err = h.checkBudgetAlerts(householdID, "cat-3", date)
+	require.NoError(t, err)
+	assert.Empty(t, fired)
+}
+
+func TestBudgetAlertRecipients(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	db.Create(&User{ID: "u1", Email: "in@example.com", HouseholdID: "hh", BudgetAlerts: true})
+	db.Create(&User{ID: "u2", Email: "out@example.com", HouseholdID: "hh"})
+	db.Create(&User{ID: "u3", Email: "other@example.com", HouseholdID: "other", BudgetAlerts: true})
+
+	recipients, err := budgetAlertRecipients(db, "hh")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"in@example.com"}, recipients)
+}
+
+func TestAlertSettings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-settings"
+
+	db.Create(&Household{ID: householdID, Name: "Home"})
+	db.Create(&User{ID: "u1", Email: "a@example.com", HouseholdID: householdID})
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: householdID, MonthlyBudget: 100})
+	db.Create(&Category{ID: "cat-2", Name: "Fun", HouseholdID: householdID, MonthlyBudget: 100})
+
+	r := gin.Default()
+	r.Use(func(c *gin.Context) { c.Set("user_id", "u1") })
+	r.GET("/households/:household_id/alerts", h.GetBudgetAlerts)
+	r.GET("/households/:household_id/alerts/settings", h.GetAlertSettings)
+	r.PUT("/households/:household_id/alerts/settings", h.UpdateAlertSettings)
+	r.PUT("/households/:household_id/alerts/subscription", h.UpdateAlertSubscription)
+	r.PUT("/households/:household_id/categories/:id/alerts", h.UpdateCategoryAlerts)
+	r.POST("/households/:household_id/transactions", h.CreateTransaction)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/households/"+householdID+path, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	settings := func() AlertSettings {
+		w := send("GET", "/alerts/settings", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var s AlertSettings
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &s))
+		return s
+	}
+
+	s := settings()
+	assert.Equal(t, []int{80, 100}, s.Thresholds)
+	assert.False(t, s.Subscribed)
+
+	assert.Equal(t, http.StatusOK, send("PUT", "/alerts/settings", `{"thresholds": [100, 75, 75]}`).Code)
+	events, cancel := h.events.Subscribe(householdID)
+	defer cancel()
+	w := send("PUT", "/categories/cat-2/alerts", `{"thresholds": []}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var updated CategoryAlertSettings
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, CategoryAlertSettings{CategoryID: "cat-2", Name: "Fun", Thresholds: []int{}}, updated)
+	event := <-events
+	assert.Equal(t, EventCategoryUpdated, event.Type)
+	assert.Equal(t, "cat-2", event.Data.(Category).ID)
+	assert.Equal(t, http.StatusOK, send("PUT", "/alerts/subscription", `{"enabled": true}`).Code)
+
+	s = settings()
+	assert.Equal(t, []int{75, 100}, s.Thresholds)
+	assert.True(t, s.Subscribed)
+	for _, cat := range s.Categories {
+		if cat.CategoryID == "cat-1" {
+			assert.True(t, cat.Inherited)
+			assert.Equal(t, []int{75, 100}, cat.Thresholds)
+		} else {
+			assert.False(t, cat.Inherited)
+			assert.Empty(t, cat.Thresholds)
+		}
+	}
+
+	assert.Equal(t, http.StatusBadRequest, send("PUT", "/alerts/settings", `{"thresholds": [0]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("PUT", "/alerts/settings", `{}`).Code)
+	assert.Equal(t, http.StatusNotFound, send("PUT", "/categories/missing/alerts", `{"thresholds": null}`).Code)
+
+	// Creating a transaction checks the thresholds
+	w = send("POST", "/transactions", `{"amount": 80, "category_id": "cat-1", "date": "2024-05-10T00:00:00Z"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = send("GET", "/alerts?period=2024-05", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var alerts []BudgetAlert
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &alerts))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, 75, alerts[0].Threshold)
+	assert.Equal(t, "cat-1", alerts[0].CategoryID)
+}
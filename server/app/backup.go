@@ -0,0 +1,790 @@
+package app
+
+import (
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	backupFormat  = "keda-household-backup"
+	backupVersion = 2
+
+	backupKDFIterations = 600000
+	// Backups made with other iteration counts are read within these bounds,
+	// so a crafted backup can neither weaken the key nor stall the server.
+	backupMinKDFIterations = 100000
+	backupMaxKDFIterations = 10 * backupKDFIterations
+	backupMaxSize          = 100 << 20 // 100 MB
+)
+
+var ErrBackupPassphrase = errors.New("backup is encrypted: wrong or missing passphrase")
+
+// BackupEnvelope is the outer, versioned container of a household backup.
+// The archive itself is stored in Payload, or in Ciphertext when the backup
+// is protected with a passphrase. The whole envelope is gzip-compressed.
+type BackupEnvelope struct {
+	Format     string            `json:"format"`
+	Version    int               `json:"version"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Encryption *BackupEncryption `json:"encryption,omitempty"`
+	Payload    *HouseholdArchive `json:"payload,omitempty"`
+	Ciphertext []byte            `json:"ciphertext,omitempty"`
+}
+
+type BackupEncryption struct {
+	Algorithm  string `json:"algorithm"` // aes-256-gcm
+	KDF        string `json:"kdf"`       // pbkdf2-sha256
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+}
+
+// HouseholdArchive holds every entity of a household in plain text. Secret
+// fields are decrypted on export and re-encrypted with the target instance's
+// key on restore.
+type HouseholdArchive struct {
+	Household    ArchiveHousehold     `json:"household"`
+	Users        []ArchiveUser        `json:"users"`
+	Memberships  []ArchiveMembership  `json:"memberships"`
+	Accounts     []ArchiveAccount     `json:"accounts"`
+	Categories   []ArchiveCategory    `json:"categories"`
+	Transactions []ArchiveTransaction `json:"transactions"`
+	Invitations  []ArchiveInvitation  `json:"invitations"`
+}
+
+type ArchiveHousehold struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	// AlertThresholds is omitted when the household uses the defaults.
+	AlertThresholds *string `json:"alert_thresholds,omitempty"`
+	Locale          string  `json:"locale,omitempty"`
+}
+
+type ArchiveUser struct {
+	ID           string     `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	Email        string     `json:"email"`
+	GoogleID     string     `json:"google_id"`
+	Name         string     `json:"name"`
+	GoogleName   string     `json:"google_name,omitempty"`
+	CustomName   bool       `json:"custom_name,omitempty"`
+	PictureURL   string     `json:"picture_url"`
+	Color        string     `json:"color"`
+	BudgetAlerts bool       `json:"budget_alerts,omitempty"`
+	// DigestEmails is nil in archives made before it was backed up, which
+	// keeps the default.
+	DigestEmails *bool  `json:"digest_emails,omitempty"`
+	Locale       string `json:"locale,omitempty"`
+}
+
+// ArchiveMembership is a user's membership of the household, including the
+// ones of users who left it.
+type ArchiveMembership struct {
+	UserID    string     `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Role      string     `json:"role"`
+}
+
+type ArchiveAccount struct {
+	ID              string     `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	Type            string     `json:"type"`
+	Name            string     `json:"name"`
+	Brand           *string    `json:"brand,omitempty"`
+	Bank            *string    `json:"bank,omitempty"`
+	LedgerBalance   *float64   `json:"ledger_balance,omitempty"`
+	LedgerBalanceAt *time.Time `json:"ledger_balance_at,omitempty"`
+}
+
+type ArchiveCategory struct {
+	ID              string     `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	Name            string     `json:"name"`
+	MonthlyBudget   float64    `json:"monthly_budget"`
+	IsActive        bool       `json:"is_active"`
+	AlertThresholds *string    `json:"alert_thresholds,omitempty"`
+}
+
+type ArchiveTransaction struct {
+	ID                    string     `json:"id"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`
+	AccountID             string     `json:"account_id"`
+	CategoryID            string     `json:"category_id"`
+	UserID                string     `json:"user_id"`
+	Amount                float64    `json:"amount"`
+	Date                  time.Time  `json:"date"`
+	Description           string     `json:"note"`
+	ReplacedTransactionID *string    `json:"replaced_transaction_id,omitempty"`
+	ExternalID            string     `json:"external_id,omitempty"`
+}
+
+type ArchiveInvitation struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Code      string     `json:"code"`
+	Email     string     `json:"email"`
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
+
+func deletedAtPtr(d gorm.DeletedAt) *time.Time {
+	if !d.Valid {
+		return nil
+	}
+	t := d.Time
+	return &t
+}
+
+func deletedAtFrom(t *time.Time) gorm.DeletedAt {
+	if t == nil {
+		return gorm.DeletedAt{}
+	}
+	return gorm.DeletedAt{Time: *t, Valid: true}
+}
+
+func secretPtrToString(s *SecretString) *string {
+	if s == nil {
+		return nil
+	}
+	v := string(*s)
+	return &v
+}
+
+func stringToSecretPtr(s *string) *SecretString {
+	if s == nil {
+		return nil
+	}
+	v := SecretString(*s)
+	return &v
+}
+
+// BuildHouseholdArchive collects all entities of a household, including
+// soft-deleted rows so that transaction version chains stay intact.
+func BuildHouseholdArchive(db *gorm.DB, householdID string) (*HouseholdArchive, error) {
+	var household Household
+	if err := db.First(&household, "id = ?", householdID).Error; err != nil {
+		return nil, err
+	}
+
+	archive := &HouseholdArchive{
+		Household: ArchiveHousehold{
+			ID:              household.ID,
+			CreatedAt:       household.CreatedAt,
+			UpdatedAt:       household.UpdatedAt,
+			Name:            string(household.Name),
+			AlertThresholds: household.AlertThresholds,
+			Locale:          household.Locale,
+		},
+		Users:        []ArchiveUser{},
+		Memberships:  []ArchiveMembership{},
+		Accounts:     []ArchiveAccount{},
+		Categories:   []ArchiveCategory{},
+		Transactions: []ArchiveTransaction{},
+		Invitations:  []ArchiveInvitation{},
+	}
+
+	var users []User
+	if err := db.Unscoped().
+		Where("id IN (?) OR id IN (?)", memberIDs(db, householdID).Unscoped(), db.Unscoped().Model(&Transaction{}).Select("user_id").Where("household_id = ?", householdID)).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		archive.Users = append(archive.Users, ArchiveUser{
+			ID:           u.ID,
+			CreatedAt:    u.CreatedAt,
+			UpdatedAt:    u.UpdatedAt,
+			DeletedAt:    deletedAtPtr(u.DeletedAt),
+			Email:        string(u.Email),
+			GoogleID:     u.GoogleID,
+			Name:         string(u.Name),
+			GoogleName:   string(u.GoogleName),
+			CustomName:   u.CustomName,
+			PictureURL:   u.PictureURL,
+			Color:        u.Color,
+			BudgetAlerts: u.BudgetAlerts,
+			DigestEmails: &u.DigestEmails,
+			Locale:       u.Locale,
+		})
+	}
+
+	var memberships []Membership
+	if err := db.Unscoped().Where("household_id = ?", householdID).Order("created_at ASC").Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range memberships {
+		archive.Memberships = append(archive.Memberships, ArchiveMembership{
+			UserID:    m.UserID,
+			CreatedAt: m.CreatedAt,
+			DeletedAt: deletedAtPtr(m.DeletedAt),
+			Role:      m.Role,
+		})
+	}
+
+	var accounts []Account
+	if err := db.Unscoped().Where("household_id = ?", householdID).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range accounts {
+		archive.Accounts = append(archive.Accounts, ArchiveAccount{
+			ID:              a.ID,
+			CreatedAt:       a.CreatedAt,
+			UpdatedAt:       a.UpdatedAt,
+			DeletedAt:       deletedAtPtr(a.DeletedAt),
+			Type:            a.Type,
+			Name:            string(a.Name),
+			Brand:           secretPtrToString(a.Brand),
+			Bank:            secretPtrToString(a.Bank),
+			LedgerBalance:   a.LedgerBalance,
+			LedgerBalanceAt: a.LedgerBalanceAt,
+		})
+	}
+
+	var categories []Category
+	if err := db.Unscoped().Where("household_id = ?", householdID).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	for _, cat := range categories {
+		archive.Categories = append(archive.Categories, ArchiveCategory{
+			ID:              cat.ID,
+			CreatedAt:       cat.CreatedAt,
+			UpdatedAt:       cat.UpdatedAt,
+			DeletedAt:       deletedAtPtr(cat.DeletedAt),
+			Name:            string(cat.Name),
+			MonthlyBudget:   cat.MonthlyBudget,
+			IsActive:        cat.IsActive,
+			AlertThresholds: cat.AlertThresholds,
+		})
+	}
+
+	var transactions []Transaction
+	if err := db.Unscoped().Where("household_id = ?", householdID).Order("created_at ASC").Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range transactions {
+		archive.Transactions = append(archive.Transactions, ArchiveTransaction{
+			ID:                    t.ID,
+			CreatedAt:             t.CreatedAt,
+			UpdatedAt:             t.UpdatedAt,
+			DeletedAt:             deletedAtPtr(t.DeletedAt),
+			AccountID:             t.AccountID,
+			CategoryID:            t.CategoryID,
+			UserID:                t.UserID,
+			Amount:                t.Amount,
+			Date:                  t.Date,
+			Description:           string(t.Description),
+			ReplacedTransactionID: t.ReplacedTransactionID,
+			ExternalID:            t.ExternalID,
+		})
+	}
+
+	var invitations []Invitation
+	if err := db.Unscoped().Where("household_id = ?", householdID).Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	for _, i := range invitations {
+		archive.Invitations = append(archive.Invitations, ArchiveInvitation{
+			ID:        i.ID,
+			CreatedAt: i.CreatedAt,
+			UpdatedAt: i.UpdatedAt,
+			DeletedAt: deletedAtPtr(i.DeletedAt),
+			Code:      i.Code,
+			Email:     string(i.Email),
+			Status:    i.Status,
+			ExpiresAt: i.ExpiresAt,
+			SentAt:    i.SentAt,
+		})
+	}
+
+	return archive, nil
+}
+
+// WriteBackup serializes an archive into a gzip-compressed envelope,
+// encrypting it when a passphrase is given.
+func WriteBackup(w io.Writer, archive *HouseholdArchive, passphrase string) error {
+	envelope := BackupEnvelope{
+		Format:    backupFormat,
+		Version:   backupVersion,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if passphrase == "" {
+		envelope.Payload = archive
+	} else {
+		plain, err := json.Marshal(archive)
+		if err != nil {
+			return err
+		}
+
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		gcm, err := backupCipher(passphrase, salt, backupKDFIterations)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+
+		envelope.Encryption = &BackupEncryption{
+			Algorithm:  "aes-256-gcm",
+			KDF:        "pbkdf2-sha256",
+			Iterations: backupKDFIterations,
+			Salt:       salt,
+			Nonce:      nonce,
+		}
+		envelope.Ciphertext = gcm.Seal(nil, nonce, plain, []byte(backupFormat))
+	}
+
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(envelope); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ReadBackup parses and, if needed, decrypts a backup produced by WriteBackup.
+func ReadBackup(r io.Reader, passphrase string) (*HouseholdArchive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup: %v", err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	var envelope BackupEnvelope
+	if err := json.NewDecoder(io.LimitReader(gz, backupMaxSize)).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("invalid backup: %v", err)
+	}
+	if envelope.Format != backupFormat {
+		return nil, fmt.Errorf("invalid backup: unknown format %q", envelope.Format)
+	}
+	if envelope.Version < 1 || envelope.Version > backupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", envelope.Version)
+	}
+
+	if envelope.Encryption == nil {
+		if envelope.Payload == nil {
+			return nil, fmt.Errorf("invalid backup: missing payload")
+		}
+		return upgradeArchive(envelope.Version, envelope.Payload), nil
+	}
+
+	if passphrase == "" {
+		return nil, ErrBackupPassphrase
+	}
+	enc := envelope.Encryption
+	if enc.Algorithm != "aes-256-gcm" || enc.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("unsupported backup encryption %s/%s", enc.Algorithm, enc.KDF)
+	}
+	if enc.Iterations < backupMinKDFIterations || enc.Iterations > backupMaxKDFIterations {
+		return nil, fmt.Errorf("unsupported backup encryption: %d iterations", enc.Iterations)
+	}
+	gcm, err := backupCipher(passphrase, enc.Salt, enc.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid backup: bad nonce")
+	}
+	plain, err := gcm.Open(nil, enc.Nonce, envelope.Ciphertext, []byte(backupFormat))
+	if err != nil {
+		return nil, ErrBackupPassphrase
+	}
+
+	var archive HouseholdArchive
+	if err := json.Unmarshal(plain, &archive); err != nil {
+		return nil, fmt.Errorf("invalid backup: %v", err)
+	}
+	return upgradeArchive(envelope.Version, &archive), nil
+}
+
+// upgradeArchive fills in what archives of older versions lack. Version 1
+// archives have no memberships: their users were all members of the
+// household, and the one who joined first becomes its owner.
+func upgradeArchive(version int, archive *HouseholdArchive) *HouseholdArchive {
+	if version >= 2 {
+		return archive
+	}
+	users := slices.Clone(archive.Users)
+	slices.SortStableFunc(users, func(a, b ArchiveUser) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	archive.Memberships = []ArchiveMembership{}
+	for i, u := range users {
+		role := RoleMember
+		if i == 0 {
+			role = RoleOwner
+		}
+		archive.Memberships = append(archive.Memberships, ArchiveMembership{UserID: u.ID, CreatedAt: u.CreatedAt, Role: role})
+	}
+	return archive
+}
+
+func backupCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// RestoreResult describes where an archive ended up. IDMap lists the
+// entities that received a new ID because theirs was already taken.
+type RestoreResult struct {
+	HouseholdID   string            `json:"household_id"`
+	Users         int               `json:"users"`
+	ExistingUsers int               `json:"existing_users"`
+	Memberships   int               `json:"memberships"`
+	Accounts      int               `json:"accounts"`
+	Categories    int               `json:"categories"`
+	Transactions  int               `json:"transactions"`
+	Invitations   int               `json:"invitations"`
+	IDMap         map[string]string `json:"id_map"`
+}
+
+// RestoreHouseholdArchive recreates an archived household in a single
+// database transaction. Secrets are re-encrypted with this instance's key
+// and hashes recomputed by the entity hooks. Entities whose ID already
+// exists get a fresh one, and all references are remapped. Users that
+// already exist on this instance (matched by email) are linked instead of
+// duplicated and keep their current household. Memberships and roles are
+// restored as archived, so users who left or who only appear in
+// transactions do not become members.
+func RestoreHouseholdArchive(db *gorm.DB, archive *HouseholdArchive) (*RestoreResult, error) {
+	result := &RestoreResult{IDMap: map[string]string{}}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// remap returns the ID to use for an archived entity, generating a
+		// new one if it is already taken by a row of the given model.
+		remap := func(model any, id string) (string, error) {
+			var count int64
+			if err := tx.Unscoped().Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+				return "", err
+			}
+			if count == 0 {
+				return id, nil
+			}
+			newID := uuid.New().String()
+			result.IDMap[id] = newID
+			return newID, nil
+		}
+
+		householdID, err := remap(&Household{}, archive.Household.ID)
+		if err != nil {
+			return err
+		}
+		household := Household{
+			ID:              householdID,
+			CreatedAt:       archive.Household.CreatedAt,
+			UpdatedAt:       archive.Household.UpdatedAt,
+			Name:            SecretString(archive.Household.Name),
+			AlertThresholds: archive.Household.AlertThresholds,
+			Locale:          archive.Household.Locale,
+		}
+		if err := tx.Create(&household).Error; err != nil {
+			return err
+		}
+		result.HouseholdID = householdID
+
+		members := map[string]bool{}
+		for _, m := range archive.Memberships {
+			if m.DeletedAt == nil {
+				members[m.UserID] = true
+			}
+		}
+
+		userIDs := map[string]string{}
+		for _, u := range archive.Users {
+			var existing User
+			err := tx.Unscoped().Where("email_hash = ?", HashSensitive(u.Email)).First(&existing).Error
+			if err == nil {
+				userIDs[u.ID] = existing.ID
+				if existing.ID != u.ID {
+					result.IDMap[u.ID] = existing.ID
+				}
+				result.ExistingUsers++
+				continue
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			id, err := remap(&User{}, u.ID)
+			if err != nil {
+				return err
+			}
+			current := ""
+			if members[u.ID] {
+				current = householdID
+			}
+			digestEmails := u.DigestEmails == nil || *u.DigestEmails
+			user := User{
+				ID:           id,
+				CreatedAt:    u.CreatedAt,
+				UpdatedAt:    u.UpdatedAt,
+				DeletedAt:    deletedAtFrom(u.DeletedAt),
+				Email:        SecretString(u.Email),
+				EmailHash:    HashSensitive(u.Email),
+				GoogleID:     u.GoogleID,
+				Name:         SecretString(u.Name),
+				GoogleName:   SecretString(u.GoogleName),
+				CustomName:   u.CustomName,
+				PictureURL:   u.PictureURL,
+				Color:        u.Color,
+				HouseholdID:  current,
+				BudgetAlerts: u.BudgetAlerts,
+				DigestEmails: digestEmails,
+				Locale:       u.Locale,
+			}
+			// Without hooks, creating them does not make them members
+			if err := tx.Session(&gorm.Session{SkipHooks: true}).Create(&user).Error; err != nil {
+				return err
+			}
+			// GORM replaces a false DigestEmails with the column default on create
+			if !digestEmails {
+				if err := tx.Session(&gorm.Session{SkipHooks: true}).Model(&user).Update("digest_emails", false).Error; err != nil {
+					return err
+				}
+			}
+			userIDs[u.ID] = id
+			result.Users++
+		}
+
+		for _, m := range archive.Memberships {
+			userID, ok := userIDs[m.UserID]
+			if !ok {
+				continue
+			}
+			role := m.Role
+			if roleRanks[role] == 0 {
+				role = RoleMember
+			}
+			membership := Membership{
+				ID:          uuid.New().String(),
+				CreatedAt:   m.CreatedAt,
+				DeletedAt:   deletedAtFrom(m.DeletedAt),
+				UserID:      userID,
+				HouseholdID: householdID,
+				Role:        role,
+			}
+			if err := tx.Create(&membership).Error; err != nil {
+				return err
+			}
+			result.Memberships++
+		}
+
+		accountIDs := map[string]string{}
+		for _, a := range archive.Accounts {
+			id, err := remap(&Account{}, a.ID)
+			if err != nil {
+				return err
+			}
+			account := Account{
+				ID:              id,
+				CreatedAt:       a.CreatedAt,
+				UpdatedAt:       a.UpdatedAt,
+				DeletedAt:       deletedAtFrom(a.DeletedAt),
+				Type:            a.Type,
+				Name:            SecretString(a.Name),
+				Brand:           stringToSecretPtr(a.Brand),
+				Bank:            stringToSecretPtr(a.Bank),
+				HouseholdID:     householdID,
+				LedgerBalance:   a.LedgerBalance,
+				LedgerBalanceAt: a.LedgerBalanceAt,
+			}
+			if err := tx.Create(&account).Error; err != nil {
+				return err
+			}
+			accountIDs[a.ID] = id
+			result.Accounts++
+		}
+
+		categoryIDs := map[string]string{}
+		for _, cat := range archive.Categories {
+			id, err := remap(&Category{}, cat.ID)
+			if err != nil {
+				return err
+			}
+			category := Category{
+				ID:              id,
+				CreatedAt:       cat.CreatedAt,
+				UpdatedAt:       cat.UpdatedAt,
+				DeletedAt:       deletedAtFrom(cat.DeletedAt),
+				Name:            SecretString(cat.Name),
+				MonthlyBudget:   cat.MonthlyBudget,
+				IsActive:        cat.IsActive,
+				HouseholdID:     householdID,
+				AlertThresholds: cat.AlertThresholds,
+			}
+			if err := tx.Create(&category).Error; err != nil {
+				return err
+			}
+			// GORM replaces a false IsActive with the column default on create
+			if !cat.IsActive {
+				if err := tx.Model(&category).Update("is_active", false).Error; err != nil {
+					return err
+				}
+			}
+			categoryIDs[cat.ID] = id
+			result.Categories++
+		}
+
+		lookup := func(ids map[string]string, id string) string {
+			if mapped, ok := ids[id]; ok {
+				return mapped
+			}
+			return id
+		}
+
+		// Assign all transaction IDs first, as version chains may reference
+		// transactions that appear later in the archive.
+		transactionIDs := map[string]string{}
+		for _, t := range archive.Transactions {
+			id, err := remap(&Transaction{}, t.ID)
+			if err != nil {
+				return err
+			}
+			transactionIDs[t.ID] = id
+		}
+		for _, t := range archive.Transactions {
+			var replaced *string
+			if t.ReplacedTransactionID != nil {
+				r := lookup(transactionIDs, *t.ReplacedTransactionID)
+				replaced = &r
+			}
+			transaction := Transaction{
+				ID:                    transactionIDs[t.ID],
+				CreatedAt:             t.CreatedAt,
+				UpdatedAt:             t.UpdatedAt,
+				DeletedAt:             deletedAtFrom(t.DeletedAt),
+				AccountID:             lookup(accountIDs, t.AccountID),
+				CategoryID:            lookup(categoryIDs, t.CategoryID),
+				UserID:                lookup(userIDs, t.UserID),
+				Amount:                t.Amount,
+				Date:                  t.Date.UTC(),
+				Description:           SecretString(t.Description),
+				HouseholdID:           householdID,
+				ReplacedTransactionID: replaced,
+				ExternalID:            t.ExternalID,
+			}
+			if err := tx.Create(&transaction).Error; err != nil {
+				return err
+			}
+			result.Transactions++
+		}
+
+		for _, i := range archive.Invitations {
+			id, err := remap(&Invitation{}, i.ID)
+			if err != nil {
+				return err
+			}
+			code := i.Code
+			var count int64
+			if err := tx.Unscoped().Model(&Invitation{}).Where("code = ?", code).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				if code, err = newInvitationCode(); err != nil {
+					return err
+				}
+			}
+			invitation := Invitation{
+				ID:          id,
+				CreatedAt:   i.CreatedAt,
+				UpdatedAt:   i.UpdatedAt,
+				DeletedAt:   deletedAtFrom(i.DeletedAt),
+				Code:        code,
+				Email:       SecretString(i.Email),
+				HouseholdID: householdID,
+				Status:      i.Status,
+				ExpiresAt:   i.ExpiresAt,
+				SentAt:      i.SentAt,
+			}
+			if err := tx.Create(&invitation).Error; err != nil {
+				return err
+			}
+			result.Invitations++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ============================================================================
+// HANDLERS
+// ============================================================================
+
+// ExportBackup downloads a full backup of the household. The passphrase is
+// read from the JSON body so it never shows up in URLs or access logs.
+func (h *Handlers) ExportBackup(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var req struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	archive, err := BuildHouseholdArchive(h.db, householdID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Household not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build backup"})
+		}
+		return
+	}
+
+	filename := fmt.Sprintf("keda-backup-%s.json.gz", time.Now().UTC().Format("2006-01-02"))
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	if err := WriteBackup(c.Writer, archive, req.Passphrase); err != nil {
+		log.Printf("Error writing backup for household %s: %v", householdID, err)
+	}
+}
@@ -0,0 +1,259 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func seedBackupHousehold(t *testing.T, db *gorm.DB, householdID string) {
+	require.NoError(t, db.Create(&Household{ID: householdID, Name: "Family"}).Error)
+	require.NoError(t, db.Create(&User{ID: "u1", Email: "owner@example.com", Name: "Owner", HouseholdID: householdID}).Error)
+	require.NoError(t, db.Create(&Account{ID: "acc-1", Type: "card", Name: "Card", Bank: ptrSecret("ACME"), HouseholdID: householdID}).Error)
+	require.NoError(t, db.Create(&Category{ID: "cat-1", Name: "Food", MonthlyBudget: 200, IsActive: true, HouseholdID: householdID}).Error)
+	sentAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := sentAt.AddDate(0, 0, 7)
+	require.NoError(t, db.Create(&Invitation{ID: "inv-1", Code: "abc123", Email: "guest@example.com", Status: "pending", HouseholdID: householdID, SentAt: &sentAt, ExpiresAt: &expiresAt}).Error)
+
+	// A transaction that was edited once: the original is soft-deleted and
+	// replaced by a new version.
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	original := Transaction{ID: "t1", AccountID: "acc-1", CategoryID: "cat-1", UserID: "u1", Amount: 10, Date: date, Description: "Bread", HouseholdID: householdID}
+	require.NoError(t, db.Create(&original).Error)
+	require.NoError(t, db.Delete(&original).Error)
+	replaced := "t1"
+	require.NoError(t, db.Create(&Transaction{ID: "t2", AccountID: "acc-1", CategoryID: "cat-1", UserID: "u1", Amount: 12, Date: date, Description: "Bread and milk", HouseholdID: householdID, ReplacedTransactionID: &replaced}).Error)
+}
+
+func TestBackupRoundTrip_Encrypted(t *testing.T) {
+	db, _ := setupTestDB(t)
+	seedBackupHousehold(t, db, "hh-1")
+
+	archive, err := BuildHouseholdArchive(db, "hh-1")
+	require.NoError(t, err)
+	assert.Len(t, archive.Transactions, 2)
+	assert.Equal(t, "ACME", *archive.Accounts[0].Bank)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteBackup(&buf, archive, "correct horse"))
+	assert.NotContains(t, buf.String(), "Bread")
+
+	_, err = ReadBackup(bytes.NewReader(buf.Bytes()), "")
+	assert.ErrorIs(t, err, ErrBackupPassphrase)
+
+	_, err = ReadBackup(bytes.NewReader(buf.Bytes()), "wrong")
+	assert.ErrorIs(t, err, ErrBackupPassphrase)
+
+	restored, err := ReadBackup(bytes.NewReader(buf.Bytes()), "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, archive.Household, restored.Household)
+	assert.Equal(t, "Bread and milk", restored.Transactions[1].Description)
+}
+
+func TestReadBackup_RejectsIterationCounts(t *testing.T) {
+	db, _ := setupTestDB(t)
+	seedBackupHousehold(t, db, "hh-1")
+	archive, err := BuildHouseholdArchive(db, "hh-1")
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, WriteBackup(&buf, archive, "correct horse"))
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	var envelope BackupEnvelope
+	require.NoError(t, json.NewDecoder(gz).Decode(&envelope))
+
+	for _, iterations := range []int{1, backupMaxKDFIterations + 1} {
+		envelope.Encryption.Iterations = iterations
+		var tampered bytes.Buffer
+		gz := gzip.NewWriter(&tampered)
+		require.NoError(t, json.NewEncoder(gz).Encode(envelope))
+		require.NoError(t, gz.Close())
+
+		_, err := ReadBackup(&tampered, "correct horse")
+		assert.ErrorContains(t, err, "unsupported backup encryption", iterations)
+	}
+}
+
+func TestRestore_ReencryptsWithTargetKey(t *testing.T) {
+	db, _ := setupTestDB(t)
+	seedBackupHousehold(t, db, "hh-1")
+
+	archive, err := BuildHouseholdArchive(db, "hh-1")
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, WriteBackup(&buf, archive, ""))
+
+	// Target instance with a different key
+	_, err = SetupEncryption("fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210")
+	require.NoError(t, err)
+	target, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, target.AutoMigrate(Entities...))
+
+	parsed, err := ReadBackup(&buf, "")
+	require.NoError(t, err)
+	result, err := RestoreHouseholdArchive(target, parsed)
+	require.NoError(t, err)
+	assert.Equal(t, "hh-1", result.HouseholdID)
+	assert.Empty(t, result.IDMap)
+	assert.Equal(t, 2, result.Transactions)
+
+	var raw string
+	target.Raw("SELECT description FROM transactions WHERE id = ?", "t2").Scan(&raw)
+	decrypted, err := Decrypt(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "Bread and milk", decrypted)
+
+	var user User
+	require.NoError(t, target.First(&user, "email_hash = ?", HashSensitive("owner@example.com")).Error)
+	assert.Equal(t, "hh-1", user.HouseholdID)
+
+	var deleted Transaction
+	require.NoError(t, target.Unscoped().First(&deleted, "id = ?", "t1").Error)
+	assert.True(t, deleted.DeletedAt.Valid)
+}
+
+func TestRestore_RemapsConflictingIDs(t *testing.T) {
+	db, _ := setupTestDB(t)
+	seedBackupHousehold(t, db, "hh-1")
+	db.Model(&Category{}).Where("id = ?", "cat-1").Update("is_active", false)
+
+	archive, err := BuildHouseholdArchive(db, "hh-1")
+	require.NoError(t, err)
+
+	// Restoring into the same instance conflicts on every ID
+	result, err := RestoreHouseholdArchive(db, archive)
+	require.NoError(t, err)
+	assert.NotEqual(t, "hh-1", result.HouseholdID)
+	assert.Equal(t, 1, result.ExistingUsers)
+	assert.Equal(t, 0, result.Users)
+
+	newT2 := result.IDMap["t2"]
+	newT1 := result.IDMap["t1"]
+	require.NotEmpty(t, newT2)
+	require.NotEmpty(t, newT1)
+
+	var latest Transaction
+	require.NoError(t, db.First(&latest, "id = ?", newT2).Error)
+	assert.Equal(t, result.HouseholdID, latest.HouseholdID)
+	assert.Equal(t, newT1, *latest.ReplacedTransactionID)
+	assert.Equal(t, result.IDMap["acc-1"], latest.AccountID)
+	assert.Equal(t, result.IDMap["cat-1"], latest.CategoryID)
+	assert.Equal(t, "u1", latest.UserID)
+
+	var category Category
+	require.NoError(t, db.First(&category, "id = ?", result.IDMap["cat-1"]).Error)
+	assert.False(t, category.IsActive)
+
+	var invitation Invitation
+	require.NoError(t, db.First(&invitation, "id = ?", result.IDMap["inv-1"]).Error)
+	assert.NotEqual(t, "abc123", invitation.Code)
+}
+
+func TestRestore_KeepsMemberships(t *testing.T) {
+	db, _ := setupTestDB(t)
+	seedBackupHousehold(t, db, "hh-1")
+	for _, id := range []string{"u2", "u3"} {
+		require.NoError(t, db.Create(&User{ID: id, Email: SecretString(id + "@example.com"), Name: SecretString(id), HouseholdID: "hh-1"}).Error)
+	}
+	db.Model(&Membership{}).Where("user_id = ?", "u2").Update("role", RoleAdmin)
+	db.Model(&User{}).Where("id = ?", "u2").Updates(map[string]any{"digest_emails": false, "custom_name": true, "google_name": SecretString("Google u2")})
+	db.Where("user_id = ?", "u3").Delete(&Membership{})
+	// Someone who only appears in a transaction
+	require.NoError(t, db.Create(&User{ID: "u4", Email: "u4@example.com", Name: "u4"}).Error)
+	require.NoError(t, db.Create(&Transaction{ID: "t4", AccountID: "acc-1", CategoryID: "cat-1", UserID: "u4", Amount: 1, HouseholdID: "hh-1"}).Error)
+
+	archive, err := BuildHouseholdArchive(db, "hh-1")
+	require.NoError(t, err)
+	assert.Len(t, archive.Users, 4)
+	assert.Len(t, archive.Memberships, 3)
+
+	target, _ := setupTestDB(t)
+	result, err := RestoreHouseholdArchive(target, archive)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Memberships)
+
+	roles, err := memberRoles(target, "hh-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"u1": RoleOwner, "u2": RoleAdmin}, roles)
+
+	var admin, owner User
+	require.NoError(t, target.First(&admin, "id = ?", "u2").Error)
+	assert.False(t, admin.DigestEmails)
+	assert.True(t, admin.CustomName)
+	assert.Equal(t, SecretString("Google u2"), admin.GoogleName)
+	require.NoError(t, target.First(&owner, "id = ?", "u1").Error)
+	assert.True(t, owner.DigestEmails)
+
+	var invitation Invitation
+	require.NoError(t, target.First(&invitation, "id = ?", "inv-1").Error)
+	require.NotNil(t, invitation.ExpiresAt)
+	require.NotNil(t, invitation.SentAt)
+	assert.True(t, invitation.ExpiresAt.Equal(time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, invitation.SentAt.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)))
+
+	var left Membership
+	require.NoError(t, target.Unscoped().First(&left, "user_id = ?", "u3").Error)
+	assert.True(t, left.DeletedAt.Valid)
+	var outsider User
+	require.NoError(t, target.First(&outsider, "id = ?", "u4").Error)
+	assert.Empty(t, outsider.HouseholdID)
+	assert.Equal(t, HashSensitive("u4@example.com"), outsider.EmailHash)
+	var memberships int64
+	target.Unscoped().Model(&Membership{}).Where("user_id = ?", "u4").Count(&memberships)
+	assert.Zero(t, memberships)
+}
+
+func TestReadBackup_Version1(t *testing.T) {
+	archive := &HouseholdArchive{Users: []ArchiveUser{
+		{ID: "later", CreatedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "first", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	require.NoError(t, json.NewEncoder(gz).Encode(BackupEnvelope{Format: backupFormat, Version: 1, Payload: archive}))
+	require.NoError(t, gz.Close())
+
+	parsed, err := ReadBackup(&buf, "")
+	require.NoError(t, err)
+	assert.Equal(t, []ArchiveMembership{
+		{UserID: "first", CreatedAt: archive.Users[1].CreatedAt, Role: RoleOwner},
+		{UserID: "later", CreatedAt: archive.Users[0].CreatedAt, Role: RoleMember},
+	}, parsed.Memberships)
+}
+
+func TestExportBackupHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	seedBackupHousehold(t, db, "hh-1")
+
+	r := gin.Default()
+	r.POST("/households/:household_id/backup", h.ExportBackup)
+
+	req, _ := http.NewRequest("POST", "/households/hh-1/backup", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+
+	archive, err := ReadBackup(w.Body, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Family", archive.Household.Name)
+
+	req, _ = http.NewRequest("POST", "/households/none/backup", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,245 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxBatchOperations = 500
+
+// BatchOperation is one change in a batch. Data holds the same body as the
+// individual endpoint; ID is required to update or delete. IfMatch works as
+// the If-Match header does.
+type BatchOperation struct {
+	Op      string          `json:"op"`   // create, update or delete
+	Type    string          `json:"type"` // transaction, category or account
+	ID      string          `json:"id,omitempty"`
+	IfMatch string          `json:"if_match,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type BatchRequest struct {
+	// Atomic applies every operation or none. Otherwise each one is
+	// applied on its own.
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchResult is the outcome of an operation, with the status and body its
+// individual endpoint would have answered with. A change to a stale version
+// fails with 412 and the current version as Data.
+type BatchResult struct {
+	Status int    `json:"status"`
+	Data   any    `json:"data,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// batchEffects are the events and alert checks of applied operations, run
+// once their changes are committed.
+type batchEffects struct {
+	events []Event
+	saved  []Transaction
+}
+
+func (e *batchEffects) publish(eventType string, data any) {
+	e.events = append(e.events, Event{Type: eventType, Data: data})
+}
+
+// ApplyBatch applies a list of changes to transactions, categories and
+// accounts, as sent by clients catching up after being offline. Each
+// operation gets a result in the same position. In an atomic batch a failed
+// operation rolls back the others, which answer 424 Failed Dependency.
+func (h *Handlers) ApplyBatch(c *gin.Context) {
+	householdID := c.Param("household_id")
+	userID := c.GetString("user_id")
+	role := c.GetString("role")
+
+	var req BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A batch must have between 1 and %d operations", maxBatchOperations)})
+		return
+	}
+
+	results := make([]BatchResult, len(req.Operations))
+	var effects batchEffects
+
+	if req.Atomic {
+		failed := -1
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			for i, op := range req.Operations {
+				results[i] = h.applyBatchOperation(tx, householdID, userID, role, op, &effects)
+				if results[i].Error != "" {
+					failed = i
+					return errors.New(results[i].Error)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			for i := range results {
+				switch {
+				case failed < 0:
+					results[i] = BatchResult{Status: http.StatusInternalServerError, Error: "Failed to apply batch"}
+				case i != failed:
+					results[i] = BatchResult{Status: http.StatusFailedDependency, Error: "Not applied because another operation failed"}
+				}
+			}
+			c.JSON(http.StatusOK, BatchResponse{Results: results})
+			return
+		}
+	} else {
+		for i, op := range req.Operations {
+			var opEffects batchEffects
+			err := h.db.Transaction(func(tx *gorm.DB) error {
+				results[i] = h.applyBatchOperation(tx, householdID, userID, role, op, &opEffects)
+				if results[i].Error != "" {
+					return errors.New(results[i].Error)
+				}
+				return nil
+			})
+			if err != nil {
+				if results[i].Error == "" {
+					results[i] = BatchResult{Status: http.StatusInternalServerError, Error: "Failed to apply operation"}
+				}
+				continue
+			}
+			effects.events = append(effects.events, opEffects.events...)
+			effects.saved = append(effects.saved, opEffects.saved...)
+		}
+	}
+
+	// Alerts are checked once per category and month
+	checked := map[string]bool{}
+	for _, t := range effects.saved {
+		key := t.CategoryID + "/" + t.Date.Format("2006-01")
+		if !checked[key] {
+			checked[key] = true
+			h.afterTransactionSaved(t)
+		}
+	}
+	for _, e := range effects.events {
+		h.publishEvent(householdID, e.Type, e.Data)
+	}
+
+	c.JSON(http.StatusOK, BatchResponse{Results: results})
+}
+
+// applyBatchOperation applies op within tx, the way its individual endpoint
+// does, for a member with the given role.
+func (h *Handlers) applyBatchOperation(tx *gorm.DB, householdID, userID, role string, op BatchOperation, effects *batchEffects) BatchResult {
+	fail := func(status int, message string) BatchResult {
+		return BatchResult{Status: status, Error: message}
+	}
+	if (op.Type == "category" || op.Type == "account") && !hasRole(role, RoleAdmin) {
+		rerr := requiresRole(RoleAdmin)
+		return fail(rerr.status, rerr.message)
+	}
+	if (op.Op == "update" || op.Op == "delete") && op.ID == "" {
+		return fail(http.StatusBadRequest, "id is required to "+op.Op)
+	}
+	decode := func(v any) error {
+		if len(op.Data) == 0 {
+			return errors.New("data is required to " + op.Op)
+		}
+		return json.Unmarshal(op.Data, v)
+	}
+
+	var result any
+	var rerr *requestError
+	switch op.Type + ":" + op.Op {
+	case "transaction:create":
+		var t Transaction
+		if err := decode(&t); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if t, rerr = createTransaction(tx, householdID, userID, t); rerr == nil {
+			effects.publish(EventTransactionCreated, t)
+			effects.saved = append(effects.saved, t)
+			return BatchResult{Status: http.StatusCreated, Data: t}
+		}
+	case "transaction:update":
+		var t Transaction
+		if err := decode(&t); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if t, rerr = updateTransaction(tx, householdID, op.ID, op.IfMatch, t); rerr == nil {
+			effects.publish(EventTransactionUpdated, updatedTransaction{Transaction: t, PreviousID: op.ID})
+			effects.saved = append(effects.saved, t)
+			result = t
+		}
+	case "transaction:delete":
+		var deleted bool
+		if deleted, rerr = deleteTransaction(tx, householdID, op.ID, op.IfMatch); deleted {
+			effects.publish(EventTransactionDeleted, deletedResource{ID: op.ID})
+		}
+	case "category:create":
+		var cat Category
+		if err := decode(&cat); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if cat, rerr = createCategory(tx, householdID, cat); rerr == nil {
+			effects.publish(EventCategoryCreated, cat)
+			return BatchResult{Status: http.StatusCreated, Data: cat}
+		}
+	case "category:update":
+		var cat Category
+		if err := decode(&cat); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if cat, rerr = updateCategory(tx, householdID, op.ID, op.IfMatch, cat); rerr == nil {
+			effects.publish(EventCategoryUpdated, cat)
+			result = cat
+		}
+	case "category:delete":
+		var deleted bool
+		if deleted, rerr = deleteCategory(tx, householdID, op.ID, op.IfMatch); deleted {
+			effects.publish(EventCategoryDeleted, deletedResource{ID: op.ID})
+		}
+	case "account:create":
+		var account Account
+		if err := decode(&account); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if account, rerr = h.createAccount(tx, householdID, account); rerr == nil {
+			effects.publish(EventAccountCreated, account)
+			return BatchResult{Status: http.StatusCreated, Data: account}
+		}
+	case "account:update":
+		var account Account
+		if err := decode(&account); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if account, rerr = h.updateAccount(tx, householdID, op.ID, op.IfMatch, account); rerr == nil {
+			effects.publish(EventAccountUpdated, account)
+			result = account
+		}
+	case "account:delete":
+		if rerr = h.deleteAccount(tx, householdID, op.ID, op.IfMatch); rerr == nil {
+			effects.publish(EventAccountDeleted, deletedResource{ID: op.ID})
+		}
+	default:
+		return fail(http.StatusBadRequest, fmt.Sprintf("Unsupported operation %q on %q", op.Op, op.Type))
+	}
+
+	if rerr != nil {
+		result := fail(rerr.status, rerr.message)
+		if rerr.current != nil {
+			result.Data = rerr.current
+		}
+		return result
+	}
+	return BatchResult{Status: http.StatusOK, Data: result}
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	r := gin.New()
+	r.POST("/households/:household_id/batch", func(c *gin.Context) {
+		c.Set("user_id", "u1")
+		c.Set("role", RoleAdmin)
+		h.ApplyBatch(c)
+	})
+
+	householdID := "hh-batch"
+	db.Create(&Household{ID: householdID, Name: "Home"})
+	db.Create(&Account{ID: "cash", Type: "cash", Name: "Cash", HouseholdID: householdID})
+	db.Create(&Transaction{ID: "old", HouseholdID: householdID, CategoryID: "cat-1", Amount: 5})
+	db.Create(&Transaction{ID: "gone", HouseholdID: householdID, CategoryID: "cat-1", Amount: 7})
+
+	events, cancel := h.events.Subscribe(householdID)
+	defer cancel()
+
+	post := func(body string) (int, BatchResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/households/"+householdID+"/batch", strings.NewReader(body)))
+		var resp BatchResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w.Code, resp
+	}
+
+	// Operations may depend on earlier ones in the same batch
+	code, resp := post(`{"atomic": true, "operations": [
+		{"op": "create", "type": "category", "data": {"id": "cat-1", "name": "Food", "monthly_budget": 100}},
+		{"op": "create", "type": "transaction", "data": {"id": "t1", "category_id": "cat-1", "amount": 10, "date": "2024-05-01T10:00:00Z"}},
+		{"op": "update", "type": "transaction", "id": "old", "data": {"category_id": "cat-1", "amount": 6, "date": "2024-05-02T10:00:00Z"}},
+		{"op": "delete", "type": "transaction", "id": "gone"}
+	]}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Results, 4)
+	assert.Equal(t, http.StatusCreated, resp.Results[0].Status)
+	assert.Equal(t, http.StatusCreated, resp.Results[1].Status)
+	assert.Equal(t, http.StatusOK, resp.Results[2].Status)
+	assert.Equal(t, http.StatusOK, resp.Results[3].Status)
+
+	var created Transaction
+	require.NoError(t, db.First(&created, "id = ?", "t1").Error)
+	assert.Equal(t, "u1", created.UserID)
+	var live int64
+	db.Model(&Transaction{}).Where("household_id = ?", householdID).Count(&live)
+	assert.Equal(t, int64(2), live)
+
+	// Events are published after the commit, in order
+	var types []string
+	for len(events) > 0 {
+		types = append(types, (<-events).Type)
+	}
+	assert.Equal(t, []string{EventCategoryCreated, EventTransactionCreated, EventTransactionUpdated, EventTransactionDeleted}, types)
+
+	// A failure rolls back an atomic batch
+	code, resp = post(`{"atomic": true, "operations": [
+		{"op": "create", "type": "transaction", "data": {"id": "t2", "category_id": "cat-1", "amount": 1}},
+		{"op": "delete", "type": "account", "id": "cash"}
+	]}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusFailedDependency, resp.Results[0].Status)
+	assert.Equal(t, http.StatusForbidden, resp.Results[1].Status)
+	assert.Equal(t, "Cannot delete mandatory cash account", resp.Results[1].Error)
+	assert.Error(t, db.First(&Transaction{}, "id = ?", "t2").Error)
+	assert.Empty(t, events)
+
+	// Otherwise each operation stands on its own
+	code, resp = post(`{"operations": [
+		{"op": "create", "type": "transaction", "data": {"id": "t3", "category_id": "cat-1", "amount": 1}},
+		{"op": "update", "type": "category", "id": "missing", "data": {"name": "X"}},
+		{"op": "update", "type": "transaction"},
+		{"op": "rename", "type": "budget", "id": "x"}
+	]}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusCreated, resp.Results[0].Status)
+	assert.Equal(t, http.StatusNotFound, resp.Results[1].Status)
+	assert.Equal(t, http.StatusBadRequest, resp.Results[2].Status)
+	assert.Equal(t, http.StatusBadRequest, resp.Results[3].Status)
+	assert.NoError(t, db.First(&Transaction{}, "id = ?", "t3").Error)
+
+	code, _ = post(`{"operations": []}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
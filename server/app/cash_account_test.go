@@ -18,6 +18,7 @@ func TestMandatoryCashAccountRules(t *testing.T) {
 	householdID := "test-hh"
 
 	r := gin.Default()
+	r.Use(func(c *gin.Context) { c.Set("user_id", "u1") })
 	r.POST("/households", h.CreateHousehold)
 	r.POST("/households/:household_id/accounts", h.CreateAccount)
 	r.PUT("/households/:household_id/accounts/:id", h.UpdateAccount)
@@ -0,0 +1,266 @@
+package app
+
+import (
+	"reflect"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ChangeCounter holds the last change sequence handed out in a household.
+// Rows outside any household share the counter with an empty HouseholdID.
+type ChangeCounter struct {
+	HouseholdID string `gorm:"type:varchar(255);primaryKey"`
+	Value       int64
+}
+
+// ChangeTracking is a GORM plugin that stamps every create, update and soft
+// delete of a model with a ChangeSeq column with the next change sequence.
+// Delta sync returns the rows changed after a client's last sequence.
+//
+// The sequence comes from the counter row of the household the change
+// belongs to, updated in the same transaction as the change. The row stays
+// locked until the transaction commits, so changes to a household become
+// visible in sequence order and a client that already saw sequence N never
+// misses a change numbered below N, while other households write
+// concurrently. A change to a user belongs to all of their households. Hard
+// deletes leave no tombstone and must not be used on tracked models.
+type ChangeTracking struct{}
+
+func (ChangeTracking) Name() string { return "keda:change_tracking" }
+
+func (ChangeTracking) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("keda:change_seq", stampChangeSeq); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("keda:change_seq", stampChangeSeq); err != nil {
+		return err
+	}
+	return db.Callback().Delete().Before("gorm:delete").Register("keda:change_seq", softDeleteWithChangeSeq)
+}
+
+// nextChangeSeq increments the counters of the households within db's
+// transaction. A change to several households takes the next sequence of
+// all of them, so it comes after what each of them saw before.
+func nextChangeSeq(db *gorm.DB, households []string) (int64, error) {
+	tx := db.Session(&gorm.Session{NewDB: true})
+	if len(households) == 0 {
+		households = []string{""}
+	}
+	// Counters are locked in order, so changes to several households cannot
+	// deadlock
+	households = slices.Compact(slices.Sorted(slices.Values(households)))
+
+	var seq int64
+	for _, householdID := range households {
+		increment := func() *gorm.DB {
+			return tx.Model(&ChangeCounter{}).Where("household_id = ?", householdID).UpdateColumn("value", gorm.Expr("value + 1"))
+		}
+		result := increment()
+		if result.Error == nil && result.RowsAffected == 0 {
+			// First change to the household
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ChangeCounter{HouseholdID: householdID}).Error; err != nil {
+				return 0, err
+			}
+			result = increment()
+		}
+		if result.Error != nil {
+			return 0, result.Error
+		}
+
+		var value int64
+		if err := tx.Model(&ChangeCounter{}).Where("household_id = ?", householdID).Pluck("value", &value).Error; err != nil {
+			return 0, err
+		}
+		seq = max(seq, value)
+	}
+	if len(households) > 1 {
+		if err := tx.Model(&ChangeCounter{}).Where("household_id IN ?", households).UpdateColumn("value", seq).Error; err != nil {
+			return 0, err
+		}
+	}
+	return seq, nil
+}
+
+// currentChangeSeq returns the last change sequence handed out in the
+// household.
+func currentChangeSeq(db *gorm.DB, householdID string) (int64, error) {
+	var seq int64
+	err := db.Model(&ChangeCounter{}).Where("household_id = ?", householdID).Select("COALESCE(MAX(value), 0)").Scan(&seq).Error
+	return seq, err
+}
+
+// changeHouseholds returns the households the rows a statement writes
+// belong to. They are read from the rows when all of them have one, and
+// looked up with the statement's conditions otherwise.
+func changeHouseholds(db *gorm.DB) ([]string, error) {
+	stmt := db.Statement
+	tx := db.Session(&gorm.Session{NewDB: true})
+	lookUp := func(column string) ([]string, error) {
+		conditions := primaryKeyConditions(stmt)
+		if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok {
+			conditions = append(conditions, where.Exprs...)
+		}
+		if len(conditions) == 0 {
+			return nil, nil
+		}
+		var values []string
+		err := tx.Unscoped().Table(stmt.Table).Clauses(clause.Where{Exprs: conditions}).Distinct(column).Pluck(column, &values).Error
+		return values, err
+	}
+	values := func(column string) ([]string, error) {
+		if values, ok := rowValues(stmt, stmt.Schema.LookUpField(column)); ok {
+			return values, nil
+		}
+		return lookUp(column)
+	}
+
+	switch {
+	case stmt.Schema.Name == "Household":
+		return values("id")
+	case stmt.Schema.Name == "User":
+		users, err := values("id")
+		if err != nil || len(users) == 0 {
+			return nil, err
+		}
+		var households []string
+		err = tx.Unscoped().Model(&Membership{}).Where("user_id IN ?", users).Distinct("household_id").Pluck("household_id", &households).Error
+		return households, err
+	case stmt.Schema.LookUpField("household_id") != nil:
+		return values("household_id")
+	}
+	return nil, nil
+}
+
+// rowValues returns the values of field in the rows of a statement, and
+// whether all of them have one.
+func rowValues(stmt *gorm.Statement, field *schema.Field) ([]string, bool) {
+	var values []string
+	complete := true
+	add := func(row reflect.Value) {
+		row = reflect.Indirect(row)
+		if row.Kind() != reflect.Struct || row.Type() != stmt.Schema.ModelType {
+			complete = false
+			return
+		}
+		value, zero := field.ValueOf(stmt.Context, row)
+		s, ok := value.(string)
+		if zero || !ok {
+			complete = false
+			return
+		}
+		values = append(values, s)
+	}
+	switch rows := reflect.Indirect(stmt.ReflectValue); rows.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rows.Len(); i++ {
+			add(rows.Index(i))
+		}
+	default:
+		add(rows)
+	}
+	return values, complete && len(values) > 0
+}
+
+// primaryKeyConditions returns the conditions on the primary keys of a
+// statement's rows, which GORM adds to updates and deletes.
+func primaryKeyConditions(stmt *gorm.Statement) []clause.Expression {
+	var conditions []clause.Expression
+	_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+	column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+	if len(values) > 0 {
+		conditions = append(conditions, clause.IN{Column: column, Values: values})
+	}
+	if stmt.ReflectValue.CanAddr() && stmt.Dest != stmt.Model && stmt.Model != nil {
+		_, queryValues = schema.GetIdentityFieldValuesMap(stmt.Context, reflect.ValueOf(stmt.Model), stmt.Schema.PrimaryFields)
+		column, values = schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			conditions = append(conditions, clause.IN{Column: column, Values: values})
+		}
+	}
+	return conditions
+}
+
+func changeSeqField(stmt *gorm.Statement) *schema.Field {
+	if stmt.Schema == nil {
+		return nil
+	}
+	return stmt.Schema.LookUpField("change_seq")
+}
+
+// skipChangeSeq is the setting withoutChangeSeq sets.
+const skipChangeSeq = "keda:skip_change_seq"
+
+// withoutChangeSeq returns a session whose writes keep the change sequence
+// of the rows. It is only for rewrites clients cannot tell apart, such as
+// encrypting stored values.
+func withoutChangeSeq(db *gorm.DB) *gorm.DB {
+	return db.Set(skipChangeSeq, true).Session(&gorm.Session{})
+}
+
+func stampChangeSeq(db *gorm.DB) {
+	field := changeSeqField(db.Statement)
+	if db.Error != nil || field == nil {
+		return
+	}
+	if skip, _ := db.Get(skipChangeSeq); skip == true {
+		return
+	}
+	households, err := changeHouseholds(db)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	seq, err := nextChangeSeq(db, households)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	db.Statement.SetColumn(field.DBName, seq, true)
+	if len(db.Statement.Selects) > 0 {
+		db.Statement.Selects = append(db.Statement.Selects, field.DBName)
+	}
+}
+
+// softDeleteWithChangeSeq builds the soft delete of a tracked model, as
+// gorm.DeletedAt does, also setting its change sequence so that it is
+// synced as a tombstone.
+func softDeleteWithChangeSeq(db *gorm.DB) {
+	stmt := db.Statement
+	field := changeSeqField(stmt)
+	if db.Error != nil || field == nil || stmt.Unscoped || stmt.SQL.Len() > 0 {
+		return
+	}
+	deletedAt := stmt.Schema.LookUpField("deleted_at")
+	if deletedAt == nil {
+		return
+	}
+
+	households, err := changeHouseholds(db)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	seq, err := nextChangeSeq(db, households)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	now := db.NowFunc()
+	stmt.AddClause(clause.Set{
+		{Column: clause.Column{Name: deletedAt.DBName}, Value: now},
+		{Column: clause.Column{Name: field.DBName}, Value: seq},
+	})
+	stmt.SetColumn(deletedAt.DBName, now, true)
+	stmt.SetColumn(field.DBName, seq, true)
+
+	if conditions := primaryKeyConditions(stmt); len(conditions) > 0 {
+		stmt.AddClause(clause.Where{Exprs: conditions})
+	}
+
+	gorm.SoftDeleteQueryClause{Field: deletedAt}.ModifyStatement(stmt)
+	stmt.AddClauseIfNotExists(clause.Update{})
+	stmt.Build(db.Callback().Update().Clauses...)
+}
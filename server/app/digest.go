@@ -0,0 +1,197 @@
+package app
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// digestTopExpenses is how many of the month's largest expenses are listed.
+const digestTopExpenses = 5
+
+// digestInterval is how often the scheduler looks for digests to send.
+const digestInterval = time.Hour
+
+type DigestExpense struct {
+	Date     time.Time
+	Category string
+	Member   string
+	Note     string
+	Amount   float64
+}
+
+// Digest is the content of a household's monthly digest email.
+type Digest struct {
+	HouseholdID     string
+	Household       string
+	Month           time.Time
+	AppURL          string
+	Summary         MonthlySummary
+	OverBudget      []CategorySummary
+	TopExpenses     []DigestExpense
+	Members         []MemberSpending
+	Recommendations []Suggestion
+}
+
+// buildDigest gathers the digest for the month starting at month. Pending
+// recommendations are the ones currently shown for the following month.
+func (h *Handlers) buildDigest(householdID string, month time.Time) (*Digest, error) {
+	var household Household
+	if err := h.db.First(&household, "id = ?", householdID).Error; err != nil {
+		return nil, err
+	}
+
+	end := month.AddDate(0, 1, 0)
+	summary, err := h.buildMonthlySummaryAt(householdID, month, end)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &Digest{
+		HouseholdID: householdID,
+		Household:   string(household.Name),
+		Month:       month,
+		AppURL:      h.cfg.AppURL,
+		Summary:     summary,
+	}
+	for _, cat := range summary.Categories {
+		if cat.Budget > 0 && cat.Spent > cat.Budget {
+			digest.OverBudget = append(digest.OverBudget, cat)
+		}
+	}
+	sort.Slice(digest.OverBudget, func(i, j int) bool {
+		return digest.OverBudget[i].Spent-digest.OverBudget[i].Budget > digest.OverBudget[j].Spent-digest.OverBudget[j].Budget
+	})
+
+	var top []Transaction
+	if err := h.db.Preload("User").
+		Where("household_id = ? AND date >= ? AND date < ?", householdID, month, end).
+		Order("amount DESC, date ASC").
+		Limit(digestTopExpenses).
+		Find(&top).Error; err != nil {
+		return nil, err
+	}
+	categoryNames, err := h.reportCategoryNames(householdID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range top {
+		expense := DigestExpense{
+			Date:     t.Date,
+			Category: categoryNames[t.CategoryID],
+			Note:     string(t.Description),
+			Amount:   t.Amount,
+		}
+		if t.User != nil {
+			expense.Member = string(t.User.Name)
+		}
+		digest.TopExpenses = append(digest.TopExpenses, expense)
+	}
+
+	members, err := h.buildMemberReport(householdID, month, end, "")
+	if err != nil {
+		return nil, err
+	}
+	digest.Members = members.Members
+
+	opts := RecommendationOptions{Months: 6, Method: recommendationMethodMedian}
+	suggestions, err := h.buildRecommendations(householdID, opts, end)
+	if err != nil {
+		return nil, err
+	}
+	if digest.Recommendations, err = h.withoutDecided(householdID, suggestions, end); err != nil {
+		return nil, err
+	}
+
+	return digest, nil
+}
+
+func formatMoney(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// sendDigest queues the digest for month to every member of the household,
+// unless it was already sent or nothing was spent. The delivery is claimed
+// in the same transaction that queues the emails, so several instances
+// running the scheduler never send it twice.
+func (h *Handlers) sendDigest(householdID string, month time.Time) (bool, error) {
+	digest, err := h.buildDigest(householdID, month)
+	if err != nil {
+		return false, err
+	}
+
+	sent := false
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		delivery := DigestDelivery{
+			ID:          uuid.New().String(),
+			HouseholdID: householdID,
+			Period:      month.Format("2006-01"),
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&delivery)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if len(digest.TopExpenses) == 0 {
+			return nil // Nothing was spent: no digest
+		}
+
+		var users []User
+		if err := tx.Where("id IN (?) AND digest_emails = ?", memberIDs(tx, householdID), true).Find(&users).Error; err != nil {
+			return err
+		}
+		for _, u := range users {
+			if u.Email == "" {
+				continue
+			}
+			if err := h.QueueDigestEmail(tx, string(u.Email), digest); err != nil {
+				return err
+			}
+		}
+		sent = true
+		return nil
+	})
+	return sent, err
+}
+
+// sendDueDigests sends last month's digest to every household that has not
+// received it yet.
+func (h *Handlers) sendDueDigests(now time.Time) {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+
+	var householdIDs []string
+	if err := h.db.Model(&Household{}).
+		Where("id NOT IN (?)", h.db.Model(&DigestDelivery{}).Select("household_id").Where("period = ?", month.Format("2006-01"))).
+		Pluck("id", &householdIDs).Error; err != nil {
+		log.Printf("Error listing households for digests: %v", err)
+		return
+	}
+
+	for _, id := range householdIDs {
+		if _, err := h.sendDigest(id, month); err != nil {
+			log.Printf("Error sending digest for household %s: %v", id, err)
+		}
+	}
+}
+
+// RunDigestScheduler sends monthly digests until ctx is cancelled. Digests
+// for the previous month go out on the first check after the month ends.
+func (h *Handlers) RunDigestScheduler(ctx context.Context) {
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+
+	for {
+		h.sendDueDigests(time.Now().UTC())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildDigest(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	cfg.AppURL = "https://keda.example.com"
+	h := NewHandlers(db, cfg)
+	householdID := "hh-digest"
+	month := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	db.Create(&Household{ID: householdID, Name: "Casa <3"})
+	db.Create(&User{ID: "u1", Name: "Alice", Email: "alice@example.com", Color: "#EF4444", HouseholdID: householdID})
+	db.Create(&User{ID: "u2", Name: "Bob", Email: "bob@example.com", HouseholdID: householdID})
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: householdID, MonthlyBudget: 100, IsActive: true})
+	db.Create(&Category{ID: "cat-2", Name: "Fun", HouseholdID: householdID, MonthlyBudget: 500, IsActive: true})
+
+	for i, amount := range []float64{50, 40, 30, 20, 10, 5} {
+		db.Create(&Transaction{ID: fmt.Sprintf("t%d", i), HouseholdID: householdID, CategoryID: "cat-1", UserID: "u1", Amount: amount, Date: month.AddDate(0, 0, i), Description: "Market"})
+	}
+	db.Create(&Transaction{ID: "tz", HouseholdID: householdID, CategoryID: "cat-2", UserID: "u2", Amount: 45, Date: month.AddDate(0, 0, 9), Description: "<b>Cinema</b>"})
+
+	digest, err := h.buildDigest(householdID, month)
+	require.NoError(t, err)
+
+	assert.Equal(t, 200.0, digest.Summary.TotalSpent)
+	require.Len(t, digest.OverBudget, 1)
+	assert.Equal(t, "Food", digest.OverBudget[0].Name)
+	require.Len(t, digest.TopExpenses, digestTopExpenses)
+	assert.Equal(t, 50.0, digest.TopExpenses[0].Amount)
+	assert.Equal(t, "Alice", digest.TopExpenses[0].Member)
+	assert.Equal(t, "<b>Cinema</b>", digest.TopExpenses[1].Note)
+	require.Len(t, digest.Members, 2)
+	assert.Equal(t, "Alice", digest.Members[0].Name)
+	assert.Equal(t, 155.0, digest.Members[0].Total)
+
+	// Food went over budget and Fun was well under it
+	assert.Len(t, digest.Recommendations, 2)
+
+	subject, text, html, err := renderEmail("digest", "es", digest)
+	require.NoError(t, err)
+	assert.Equal(t, "Resumen de Casa <3 - 05/2024", subject)
+	assert.Contains(t, text, "Este es el resumen de Casa <3 para 05/2024.")
+	assert.Contains(t, text, "- Food: 155.00 de 100.00 (55.00 de más)")
+	assert.Contains(t, text, "- 10/05 Fun - <b>Cinema</b>: 45.00 (Bob)")
+	assert.Contains(t, text, "- Alice: 155.00 (77.5%)")
+	assert.Contains(t, text, "- Food: aumentar el presupuesto a 200.00")
+	assert.Contains(t, html, "Resumen de Casa &lt;3")
+	assert.Contains(t, html, "&lt;b&gt;Cinema&lt;/b&gt;")
+	assert.Contains(t, html, `<a href="https://keda.example.com">`)
+}
+
+func TestSendDigest_OncePerMonth(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	month := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	db.Create(&Household{ID: "hh-1", Name: "Active"})
+	db.Create(&Household{ID: "hh-2", Name: "Quiet"})
+	db.Create(&Transaction{ID: "t1", HouseholdID: "hh-1", Amount: 10, Date: month.AddDate(0, 0, 3)})
+
+	sent, err := h.sendDigest("hh-1", month)
+	require.NoError(t, err)
+	assert.True(t, sent)
+
+	sent, err = h.sendDigest("hh-1", month)
+	require.NoError(t, err)
+	assert.False(t, sent)
+
+	// The scheduler claims the remaining household, even with nothing to send
+	h.sendDueDigests(month.AddDate(0, 1, 4))
+	var count int64
+	db.Model(&DigestDelivery{}).Where("period = ?", "2024-05").Count(&count)
+	assert.Equal(t, int64(2), count)
+}
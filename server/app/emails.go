@@ -0,0 +1,106 @@
+package app
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// defaultLocale is used when neither the recipient nor the household chose
+// a language.
+const defaultLocale = "es"
+
+// Email templates live in templates/emails/<locale>/<name>.txt, defining
+// "subject" and "text", and <name>.html, defining "html".
+//
+//go:embed templates/emails
+var emailFS embed.FS
+
+var emailFuncs = map[string]any{
+	"money": formatMoney,
+	"month": func(t time.Time) string { return t.Format("01/2006") },
+	"day":   func(t time.Time) string { return t.Format("02/01") },
+	"over":  func(c CategorySummary) string { return formatMoney(c.Spent - c.Budget) },
+}
+
+type emailTemplate struct {
+	text *template.Template
+	html *htmltemplate.Template
+}
+
+// emailTemplates maps locale and email name to its templates.
+var emailTemplates = loadEmailTemplates()
+
+func loadEmailTemplates() map[string]map[string]*emailTemplate {
+	templates := map[string]map[string]*emailTemplate{}
+	files, err := fs.Glob(emailFS, "templates/emails/*/*.txt")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		locale := path.Base(path.Dir(file))
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+		htmlFile := strings.TrimSuffix(file, ".txt") + ".html"
+
+		if templates[locale] == nil {
+			templates[locale] = map[string]*emailTemplate{}
+		}
+		templates[locale][name] = &emailTemplate{
+			text: template.Must(template.New(name).Funcs(emailFuncs).ParseFS(emailFS, file)),
+			html: htmltemplate.Must(htmltemplate.New(name).Funcs(emailFuncs).ParseFS(emailFS, htmlFile)),
+		}
+	}
+	return templates
+}
+
+// isSupportedLocale tells whether emails can be sent in locale.
+func isSupportedLocale(locale string) bool {
+	_, ok := emailTemplates[locale]
+	return ok
+}
+
+// renderEmail renders the subject, plain text and HTML body of an email in
+// the given locale, falling back to the default locale.
+func renderEmail(name, locale string, data any) (subject, text, html string, err error) {
+	tmpl := emailTemplates[locale][name]
+	if tmpl == nil {
+		tmpl = emailTemplates[defaultLocale][name]
+	}
+	if tmpl == nil {
+		return "", "", "", fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subjectBuf, textBuf, htmlBuf bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subjectBuf, "subject", data); err != nil {
+		return "", "", "", err
+	}
+	if err := tmpl.text.ExecuteTemplate(&textBuf, "text", data); err != nil {
+		return "", "", "", err
+	}
+	if err := tmpl.html.ExecuteTemplate(&htmlBuf, "html", data); err != nil {
+		return "", "", "", err
+	}
+	return strings.TrimSpace(subjectBuf.String()), textBuf.String(), htmlBuf.String(), nil
+}
+
+// emailLocale picks the language of an email: the recipient's own
+// preference if they have an account, else the household's locale.
+func emailLocale(db *gorm.DB, to, householdID string) string {
+	var user User
+	if err := db.Where("email_hash = ?", HashSensitive(to)).First(&user).Error; err == nil && isSupportedLocale(user.Locale) {
+		return user.Locale
+	}
+	var household Household
+	if err := db.First(&household, "id = ?", householdID).Error; err == nil && isSupportedLocale(household.Locale) {
+		return household.Locale
+	}
+	return defaultLocale
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderEmail_Locales(t *testing.T) {
+	data := invitationEmail{Code: "abc123", AppURL: "https://keda.example.com"}
+
+	subject, text, html, err := renderEmail("invitation", "en", data)
+	require.NoError(t, err)
+	assert.Equal(t, "You've been invited to join a household on Keda", subject)
+	assert.Contains(t, text, "Link: https://keda.example.com/invite?code=abc123")
+	assert.Contains(t, html, `<a href="https://keda.example.com/invite?code=abc123">`)
+
+	subject, text, _, err = renderEmail("invitation", "es", data)
+	require.NoError(t, err)
+	assert.Equal(t, "Te han invitado a unirte a un hogar en Keda", subject)
+	assert.Contains(t, text, "usa el código de invitación al loguearte: abc123")
+
+	// Unknown locales fall back to the default
+	fallback, _, _, err := renderEmail("invitation", "fr", data)
+	require.NoError(t, err)
+	assert.Equal(t, subject, fallback)
+
+	_, _, _, err = renderEmail("missing", "es", data)
+	assert.Error(t, err)
+
+	// Every template exists in every locale
+	for locale, templates := range emailTemplates {
+		assert.Len(t, templates, len(emailTemplates[defaultLocale]), locale)
+	}
+}
+
+func TestEmailLocale(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	db.Create(&Household{ID: "hh-en", Name: "Home", Locale: "en"})
+	db.Create(&Household{ID: "hh-default", Name: "Casa"})
+	db.Create(&User{ID: "u1", Email: "ana@example.com", HouseholdID: "hh-en", Locale: "es"})
+	db.Create(&User{ID: "u2", Email: "bob@example.com", HouseholdID: "hh-en"})
+
+	assert.Equal(t, "es", emailLocale(db, "ana@example.com", "hh-en"))
+	assert.Equal(t, "en", emailLocale(db, "bob@example.com", "hh-en"))
+	assert.Equal(t, "en", emailLocale(db, "new@example.com", "hh-en"))
+	assert.Equal(t, defaultLocale, emailLocale(db, "new@example.com", "hh-default"))
+}
+
+func TestBuildMessage_Multipart(t *testing.T) {
+	raw, err := buildMessage("noreply@keda.local", "ana@example.com", "Categorías excedidas", "Hola, ¿qué tal?", "<p>Hola, ¿qué tal?</p>")
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Categorías excedidas", subject)
+	assert.NotContains(t, msg.Header.Get("Subject"), "í")
+	assert.Equal(t, `"Keda" <noreply@keda.local>`, msg.Header.Get("From"))
+	assert.Equal(t, "<ana@example.com>", msg.Header.Get("To"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part) // quoted-printable is decoded by the reader
+		require.NoError(t, err)
+		types = append(types, strings.Split(part.Header.Get("Content-Type"), ";")[0])
+		bodies = append(bodies, string(body))
+	}
+	assert.Equal(t, []string{"text/plain", "text/html"}, types)
+	assert.Equal(t, []string{"Hola, ¿qué tal?", "<p>Hola, ¿qué tal?</p>"}, bodies)
+}
@@ -9,10 +9,19 @@ import (
 var Entities = []any{
 	&Household{},
 	&User{},
+	&Membership{},
 	&Account{},
 	&Category{},
 	&Transaction{},
 	&Invitation{},
+	&RecommendationDecision{},
+	&BudgetAlert{},
+	&DigestDelivery{},
+	&OutboxEmail{},
+	&Webhook{},
+	&WebhookDelivery{},
+	&ChangeCounter{},
+	&IdempotencyKey{},
 }
 
 type Household struct {
@@ -20,7 +29,13 @@ type Household struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ChangeSeq int64          `gorm:"not null;default:0;index" json:"-"`
 	Name      SecretString   `gorm:"type:text" json:"name"`
+	// AlertThresholds lists the budget percentages that trigger an alert,
+	// comma separated. Nil uses the defaults; empty disables alerts.
+	AlertThresholds *string `gorm:"type:varchar(255)" json:"-"`
+	// Locale is the default language of the household's emails.
+	Locale string `gorm:"type:varchar(10)" json:"locale"`
 }
 
 type User struct {
@@ -28,15 +43,32 @@ type User struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ChangeSeq int64          `gorm:"not null;default:0;index" json:"-"`
 	Email     SecretString   `gorm:"type:text" json:"email"`
 	// EmailHash stores a salted HMAC-SHA256 hash of the email.
 	// This allows for searchable lookups (e.g. login) without exposing the plaintext email in database indexes.
-	EmailHash   string       `gorm:"type:varchar(255);unique;index" json:"-"`
-	GoogleID    string       `gorm:"type:varchar(255);index" json:"google_id"`
-	Name        SecretString `gorm:"type:text" json:"name"`
-	PictureURL  string       `gorm:"type:text" json:"picture_url"`
-	Color       string       `gorm:"type:varchar(7)" json:"color"`
-	HouseholdID string       `gorm:"type:varchar(255)" json:"household_id"`
+	EmailHash string `gorm:"type:varchar(255);unique;index" json:"-"`
+	GoogleID  string `gorm:"type:varchar(255);index" json:"google_id"`
+	// Name is the name shown to others: the one the user chose, or else
+	// the one in their Google account.
+	Name SecretString `gorm:"type:text" json:"name"`
+	// GoogleName is the name in the user's Google account, updated on login.
+	GoogleName SecretString `gorm:"type:text" json:"-"`
+	// CustomName is set when the user chose their own name.
+	CustomName bool   `json:"custom_name"`
+	PictureURL string `gorm:"type:text" json:"picture_url"`
+	Color      string `gorm:"type:varchar(7)" json:"color"`
+	// HouseholdID is the household the user last used. Memberships list
+	// all the households they belong to.
+	HouseholdID string `gorm:"type:varchar(255)" json:"household_id"`
+	// BudgetAlerts opts the user in to budget threshold emails.
+	BudgetAlerts bool `json:"budget_alerts"`
+	// DigestEmails opts the user in to the monthly digest email.
+	DigestEmails bool `gorm:"not null;default:true" json:"digest_emails"`
+	// Locale is the user's preferred language. Empty uses the household's.
+	Locale string `gorm:"type:varchar(10)" json:"locale"`
+	// AnonymisedAt is when the personal data of a deleted user was erased.
+	AnonymisedAt *time.Time `json:"-"`
 }
 
 func (u *User) BeforeSave(tx *gorm.DB) error {
@@ -44,17 +76,52 @@ func (u *User) BeforeSave(tx *gorm.DB) error {
 	return nil
 }
 
+// AfterCreate makes a new user a member of their household.
+func (u *User) AfterCreate(tx *gorm.DB) error {
+	if u.HouseholdID == "" {
+		return nil
+	}
+	_, err := addMembership(tx.Session(&gorm.Session{NewDB: true}), u.ID, u.HouseholdID)
+	return err
+}
+
+// Membership makes a user a member of a household. A user can belong to
+// several households.
+type Membership struct {
+	ID          string         `gorm:"type:varchar(255);primaryKey" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ChangeSeq   int64          `gorm:"not null;default:0;index" json:"-"`
+	UserID      string         `gorm:"type:varchar(255);uniqueIndex:idx_membership" json:"user_id"`
+	HouseholdID string         `gorm:"type:varchar(255);uniqueIndex:idx_membership;index" json:"household_id"`
+	Role        string         `gorm:"type:varchar(20);not null;default:'member'" json:"role"`
+}
+
+// Membership roles, from most to least privileged.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
 type Account struct {
 	ID          string         `gorm:"type:varchar(255);primaryKey" json:"id"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ChangeSeq   int64          `gorm:"not null;default:0;index" json:"version"`
 	Type        string         `gorm:"type:varchar(255)" json:"type"`
 	Name        SecretString   `gorm:"type:text" json:"name"`
 	Brand       *SecretString  `gorm:"type:text" json:"brand,omitempty"`
 	Bank        *SecretString  `gorm:"type:text" json:"bank,omitempty"`
 	DisplayName string         `gorm:"-" json:"display_name"`
 	HouseholdID string         `gorm:"type:varchar(255)" json:"household_id"`
+	// LedgerBalance is the balance reported by the bank on the last statement
+	// import, used to reconcile the next one.
+	LedgerBalance   *float64   `gorm:"type:decimal(12,2)" json:"ledger_balance,omitempty"`
+	LedgerBalanceAt *time.Time `gorm:"type:timestamp" json:"ledger_balance_at,omitempty"`
 }
 
 type Category struct {
@@ -62,10 +129,14 @@ type Category struct {
 	CreatedAt     time.Time      `json:"created_at"`
 	UpdatedAt     time.Time      `json:"updated_at"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	ChangeSeq     int64          `gorm:"not null;default:0;index" json:"version"`
 	Name          SecretString   `gorm:"type:text" json:"name"`
 	MonthlyBudget float64        `gorm:"type:decimal(10,2)" json:"monthly_budget"`
 	IsActive      bool           `gorm:"type:boolean;default:true" json:"is_active"`
 	HouseholdID   string         `gorm:"type:varchar(255)" json:"household_id"`
+	// AlertThresholds overrides the household thresholds for this category.
+	// Nil inherits them; empty disables alerts.
+	AlertThresholds *string `gorm:"type:varchar(255)" json:"-"`
 }
 
 type Transaction struct {
@@ -73,6 +144,7 @@ type Transaction struct {
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ChangeSeq   int64          `gorm:"not null;default:0;index" json:"version"`
 	AccountID   string         `gorm:"type:varchar(255)" json:"account_id"`
 	CategoryID  string         `gorm:"type:varchar(255)" json:"category_id"`
 	UserID      string         `gorm:"type:varchar(255)" json:"user_id"`
@@ -86,6 +158,9 @@ type Transaction struct {
 	DescriptionHash       string  `gorm:"type:varchar(255);index" json:"-"`
 	HouseholdID           string  `gorm:"type:varchar(255)" json:"household_id"`
 	ReplacedTransactionID *string `gorm:"type:varchar(255)" json:"-"`
+	// ExternalID holds the bank-issued identifier (e.g. the OFX FITID) of
+	// imported transactions, so statements can be re-imported safely.
+	ExternalID string `gorm:"type:varchar(255);index" json:"external_id,omitempty"`
 }
 
 func (t *Transaction) BeforeSave(tx *gorm.DB) error {
@@ -98,16 +173,140 @@ type Invitation struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ChangeSeq int64          `gorm:"not null;default:0;index" json:"-"`
 	Code      string         `gorm:"type:varchar(255);unique;index" json:"code"`
 	Email     SecretString   `gorm:"type:text" json:"email"`
 	// EmailHash stores a salted HMAC-SHA256 hash of the email.
 	// This allows for searchable lookups without exposing the plaintext email in database indexes.
 	EmailHash   string `gorm:"type:varchar(255);index" json:"-"`
 	HouseholdID string `gorm:"type:varchar(255)" json:"household_id"`
-	Status      string `gorm:"type:varchar(50);default:'pending'" json:"status"` // pending, accepted, expired
+	Status      string `gorm:"type:varchar(50);default:'pending'" json:"status"` // pending, accepted, expired, revoked
+	// ExpiresAt is when the invitation can no longer be accepted. Nil never
+	// expires, which is only the case when invitations are set not to.
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	// SentAt is when the invitation email was last queued.
+	SentAt *time.Time `json:"sent_at,omitempty"`
 }
 
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationExpired  = "expired"
+	InvitationRevoked  = "revoked"
+)
+
 func (i *Invitation) BeforeSave(tx *gorm.DB) error {
 	i.EmailHash = HashSensitive(string(i.Email))
 	return nil
 }
+
+// RecommendationDecision records what a household did with a budget
+// suggestion. The latest decision per category is what counts.
+type RecommendationDecision struct {
+	ID          string    `gorm:"type:varchar(255);primaryKey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	HouseholdID string    `gorm:"type:varchar(255);index" json:"household_id"`
+	CategoryID  string    `gorm:"type:varchar(255);index" json:"category_id"`
+	UserID      string    `gorm:"type:varchar(255)" json:"user_id"`
+	Decision    string    `gorm:"type:varchar(50)" json:"decision"` // accepted, dismissed, snoozed
+	// Action and Amount are the suggestion the decision was about.
+	Action string  `gorm:"type:varchar(50)" json:"action"`
+	Amount float64 `gorm:"type:decimal(10,2)" json:"amount"`
+	// Budget is the category budget after the decision. Accepted and
+	// dismissed suggestions stay hidden until the budget changes.
+	Budget       float64    `gorm:"type:decimal(10,2)" json:"budget"`
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+}
+
+// BudgetAlert records a threshold reached by a category in a month, so each
+// threshold fires only once per period.
+type BudgetAlert struct {
+	ID          string    `gorm:"type:varchar(255);primaryKey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	HouseholdID string    `gorm:"type:varchar(255);uniqueIndex:idx_budget_alert" json:"household_id"`
+	CategoryID  string    `gorm:"type:varchar(255);uniqueIndex:idx_budget_alert" json:"category_id"`
+	Period      string    `gorm:"type:varchar(7);uniqueIndex:idx_budget_alert" json:"period"` // YYYY-MM
+	Threshold   int       `gorm:"uniqueIndex:idx_budget_alert" json:"threshold"`
+	Spent       float64   `gorm:"type:decimal(10,2)" json:"spent"`
+	Budget      float64   `gorm:"type:decimal(10,2)" json:"budget"`
+}
+
+// DigestDelivery marks the monthly digest of a household as sent.
+type DigestDelivery struct {
+	ID          string    `gorm:"type:varchar(255);primaryKey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	HouseholdID string    `gorm:"type:varchar(255);uniqueIndex:idx_digest_delivery" json:"household_id"`
+	Period      string    `gorm:"type:varchar(7);uniqueIndex:idx_digest_delivery" json:"period"` // YYYY-MM
+}
+
+const (
+	OutboxPending   = "pending"
+	OutboxSent      = "sent"
+	OutboxFailed    = "failed"    // Gave up after too many attempts
+	OutboxCancelled = "cancelled" // The recipient or household is gone
+)
+
+// OutboxEmail is an email waiting to be delivered, or already delivered, by
+// the outbox worker. It is rendered when enqueued so that delivery does not
+// depend on data that may change in the meantime.
+type OutboxEmail struct {
+	ID            string       `gorm:"type:varchar(255);primaryKey" json:"id"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+	HouseholdID   string       `gorm:"type:varchar(255);index" json:"household_id"`
+	To            SecretString `gorm:"type:text" json:"-"`
+	ToHash        string       `gorm:"type:varchar(255);index" json:"-"`
+	Template      string       `gorm:"type:varchar(50)" json:"template"`
+	Subject       SecretString `gorm:"type:text" json:"-"`
+	Text          SecretString `gorm:"type:text" json:"-"`
+	HTML          SecretString `gorm:"type:text" json:"-"`
+	Status        string       `gorm:"type:varchar(20);index:idx_outbox_due" json:"status"`
+	Attempts      int          `json:"attempts"`
+	NextAttemptAt time.Time    `gorm:"index:idx_outbox_due" json:"next_attempt_at"`
+	LastError     string       `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time   `json:"sent_at,omitempty"`
+}
+
+func (e *OutboxEmail) BeforeSave(tx *gorm.DB) error {
+	e.ToHash = HashSensitive(string(e.To))
+	return nil
+}
+
+// Webhook subscribes a URL to some of a household's events.
+type Webhook struct {
+	ID          string         `gorm:"type:varchar(255);primaryKey" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	HouseholdID string         `gorm:"type:varchar(255);index" json:"household_id"`
+	URL         SecretString   `gorm:"type:text" json:"url"`
+	// Secret signs the payloads. It is only shown when the webhook is created.
+	Secret SecretString `gorm:"type:text" json:"-"`
+	// Events lists the subscribed event types, comma separated.
+	Events string `gorm:"type:text" json:"-"`
+	Active bool   `json:"active"`
+}
+
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed" // Gave up after too many attempts
+)
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook.
+type WebhookDelivery struct {
+	ID             string       `gorm:"type:varchar(255);primaryKey" json:"id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	WebhookID      string       `gorm:"type:varchar(255);index" json:"webhook_id"`
+	HouseholdID    string       `gorm:"type:varchar(255);index" json:"household_id"`
+	EventID        string       `gorm:"type:varchar(255)" json:"event_id"`
+	Event          string       `gorm:"type:varchar(50)" json:"event"`
+	Payload        SecretString `gorm:"type:text" json:"-"`
+	Status         string       `gorm:"type:varchar(20);index:idx_webhook_delivery_due" json:"status"`
+	Attempts       int          `json:"attempts"`
+	NextAttemptAt  time.Time    `gorm:"index:idx_webhook_delivery_due" json:"next_attempt_at"`
+	ResponseStatus int          `json:"response_status,omitempty"`
+	LastError      string       `gorm:"type:text" json:"last_error,omitempty"`
+	DeliveredAt    *time.Time   `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// etag is the entity tag of a version of an entity: its change sequence,
+// which every change bumps.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// etagMatches tells whether an If-Match header allows changing the given
+// version. An empty header always matches.
+func etagMatches(ifMatch string, version int64) bool {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+	want := etag(version)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// versioned is implemented by entities with an ETag.
+type versioned interface {
+	version() int64
+}
+
+func (a Account) version() int64     { return a.ChangeSeq }
+func (c Category) version() int64    { return c.ChangeSeq }
+func (t Transaction) version() int64 { return t.ChangeSeq }
+
+// respondVersioned answers with an entity and its ETag.
+func respondVersioned(c *gin.Context, status int, entity versioned) {
+	c.Header("ETag", etag(entity.version()))
+	c.JSON(status, entity)
+}
+
+// preconditionFailed rejects a change made to a stale version, sending the
+// current one so the client can merge.
+func preconditionFailed(current versioned) *requestError {
+	return &requestError{
+		status:  http.StatusPreconditionFailed,
+		message: "It was changed by someone else",
+		current: current,
+	}
+}
+
+// latestTransaction follows the versions that replaced a transaction to the
+// live one, or returns nil if there is none.
+func latestTransaction(db *gorm.DB, householdID, id string) *Transaction {
+	for range 100 {
+		var next Transaction
+		if err := db.Unscoped().Where("household_id = ? AND replaced_transaction_id = ?", householdID, id).Order("change_seq DESC").First(&next).Error; err != nil {
+			return nil
+		}
+		if !next.DeletedAt.Valid {
+			db.Preload("User").First(&next, "id = ?", next.ID)
+			return &next
+		}
+		id = next.ID
+	}
+	return nil
+}
+
+// findLive returns the household's live entity with the given ID, or nil.
+func findLive[T any](db *gorm.DB, householdID, id string) *T {
+	var entity T
+	if err := db.Where("household_id = ?", householdID).First(&entity, "id = ?", id).Error; err != nil {
+		return nil
+	}
+	return &entity
+}
+
+// currentTransaction returns the live version of a transaction, which may
+// have replaced it, or nil if it was deleted.
+func currentTransaction(db *gorm.DB, householdID, id string) *Transaction {
+	var t Transaction
+	if err := db.Preload("User").Where("household_id = ?", householdID).First(&t, "id = ?", id).Error; err == nil {
+		return &t
+	}
+	return latestTransaction(db, householdID, id)
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestETagMatches(t *testing.T) {
+	assert.True(t, etagMatches("", 3))
+	assert.True(t, etagMatches("*", 3))
+	assert.True(t, etagMatches(`"3"`, 3))
+	assert.True(t, etagMatches(`W/"3"`, 3))
+	assert.True(t, etagMatches(`"2", "3"`, 3))
+	assert.False(t, etagMatches(`"2"`, 3))
+	assert.False(t, etagMatches(`3`, 3))
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	r := gin.New()
+	g := r.Group("/households/:household_id")
+	g.GET("/categories/:id", h.GetCategory)
+	g.PUT("/categories/:id", h.UpdateCategory)
+	g.DELETE("/categories/:id", h.DeleteCategory)
+	g.PUT("/accounts/:id", h.UpdateAccount)
+	g.GET("/transactions/:id", h.GetTransaction)
+	g.PUT("/transactions/:id", h.UpdateTransaction)
+	g.DELETE("/transactions/:id", h.DeleteTransaction)
+
+	householdID := "hh-etag"
+	db.Create(&Category{ID: "cat-1", Name: "Food", MonthlyBudget: 100, HouseholdID: householdID})
+	db.Create(&Account{ID: "acc-1", Type: "bank", Name: "Checking", HouseholdID: householdID})
+	db.Create(&Transaction{ID: "t1", CategoryID: "cat-1", Amount: 10, HouseholdID: householdID})
+
+	do := func(method, path, ifMatch, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/households/"+householdID+path, strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	type conflict struct {
+		Error   string         `json:"error"`
+		Current map[string]any `json:"current"`
+	}
+
+	// Reads return the version as ETag
+	w := do("GET", "/categories/cat-1", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	seen := w.Header().Get("ETag")
+	require.NotEmpty(t, seen)
+
+	// A partner edits it first
+	w = do("PUT", "/categories/cat-1", seen, `{"name": "Groceries", "monthly_budget": 200, "is_active": true}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, seen, w.Header().Get("ETag"))
+	latest := w.Header().Get("ETag")
+
+	// The stale edit is rejected with what it would overwrite
+	w = do("PUT", "/categories/cat-1", seen, `{"name": "Food", "monthly_budget": 150, "is_active": true}`)
+	require.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, latest, w.Header().Get("ETag"))
+	var resp conflict
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Groceries", resp.Current["name"])
+	assert.Equal(t, 200.0, resp.Current["monthly_budget"])
+
+	assert.Equal(t, http.StatusPreconditionFailed, do("DELETE", "/categories/cat-1", seen, "").Code)
+	assert.Equal(t, http.StatusOK, do("DELETE", "/categories/cat-1", latest, "").Code)
+	assert.Error(t, db.First(&Category{}, "id = ?", "cat-1").Error)
+
+	// Without If-Match the last write wins, as before
+	assert.Equal(t, http.StatusOK, do("PUT", "/accounts/acc-1", "", `{"type": "bank", "name": "Savings"}`).Code)
+	w = do("PUT", "/accounts/acc-1", `"1"`, `{"type": "bank", "name": "Other"}`)
+	require.Equal(t, http.StatusPreconditionFailed, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Savings", resp.Current["display_name"])
+
+	// Editing a transaction replaces it; a stale edit gets the replacement
+	seen = do("GET", "/transactions/t1", "", "").Header().Get("ETag")
+	w = do("PUT", "/transactions/t1", seen, `{"category_id": "cat-1", "amount": 12}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var replacement Transaction
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &replacement))
+
+	w = do("PUT", "/transactions/t1", seen, `{"category_id": "cat-1", "amount": 15}`)
+	require.Equal(t, http.StatusPreconditionFailed, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, replacement.ID, resp.Current["id"])
+	assert.Equal(t, 12.0, resp.Current["amount"])
+	assert.Equal(t, http.StatusPreconditionFailed, do("DELETE", "/transactions/t1", seen, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("PUT", "/transactions/t1", "", `{"category_id": "cat-1", "amount": 15}`).Code)
+
+	var live int64
+	db.Model(&Transaction{}).Where("household_id = ?", householdID).Count(&live)
+	assert.Equal(t, int64(1), live)
+}
@@ -0,0 +1,208 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Household event types.
+const (
+	EventTransactionCreated   = "transaction.created"
+	EventTransactionUpdated   = "transaction.updated"
+	EventTransactionDeleted   = "transaction.deleted"
+	EventCategoryCreated      = "category.created"
+	EventCategoryUpdated      = "category.updated"
+	EventCategoryDeleted      = "category.deleted"
+	EventAccountCreated       = "account.created"
+	EventAccountUpdated       = "account.updated"
+	EventAccountDeleted       = "account.deleted"
+	EventMemberInvited        = "member.invited"
+	EventMemberJoined         = "member.joined"
+	EventMemberRemoved        = "member.removed"
+	EventMemberUpdated        = "member.updated"
+	EventHouseholdUpdated     = "household.updated"
+	EventHouseholdDeleted     = "household.deleted"
+	EventBudgetAlertTriggered = "budget_alert.triggered"
+)
+
+var eventTypes = map[string]bool{
+	EventTransactionCreated:   true,
+	EventTransactionUpdated:   true,
+	EventTransactionDeleted:   true,
+	EventCategoryCreated:      true,
+	EventCategoryUpdated:      true,
+	EventCategoryDeleted:      true,
+	EventAccountCreated:       true,
+	EventAccountUpdated:       true,
+	EventAccountDeleted:       true,
+	EventMemberInvited:        true,
+	EventMemberJoined:         true,
+	EventMemberRemoved:        true,
+	EventMemberUpdated:        true,
+	EventHouseholdUpdated:     true,
+	EventHouseholdDeleted:     true,
+	EventBudgetAlertTriggered: true,
+}
+
+// Event is a change in a household, as sent to event streams and webhooks.
+type Event struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	HouseholdID string    `json:"household_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Data        any       `json:"data"`
+}
+
+// deletedResource is the data of the *.deleted and member.removed events.
+// Removing a pending invitation also sends member.removed, with its ID.
+type deletedResource struct {
+	ID string `json:"id"`
+}
+
+// memberJoined is the data of member.joined. The invitation the member used
+// leaves the member list at the same time.
+type memberJoined struct {
+	MemberResponse
+	InvitationID string `json:"invitation_id"`
+}
+
+// updatedTransaction is the data of transaction.updated. Edits create a new
+// version of the transaction, so the previous ID is included.
+type updatedTransaction struct {
+	Transaction
+	PreviousID string `json:"previous_id"`
+}
+
+// publishEvent sends a household event to the open event streams and
+// queues it for the webhooks subscribed to it. It is called once the change
+// was saved, so failures are only logged.
+func (h *Handlers) publishEvent(householdID, eventType string, data any) {
+	event := newEvent(householdID, eventType, data)
+	h.events.Publish(event)
+	h.queueWebhooks(h.db, event)
+}
+
+func newEvent(householdID, eventType string, data any) Event {
+	return Event{
+		ID:          uuid.New().String(),
+		Type:        eventType,
+		HouseholdID: householdID,
+		CreatedAt:   time.Now().UTC(),
+		Data:        data,
+	}
+}
+
+const (
+	// subscriberBuffer is how many events a slow client may fall behind
+	// before its stream is closed. Clients reconnect and refetch.
+	subscriberBuffer = 64
+	// streamKeepAlive keeps idle connections open through proxies.
+	streamKeepAlive = 25 * time.Second
+)
+
+// EventBroker fans household events out to the streams open on this
+// instance. The in-process broker only reaches local subscribers; a broker
+// for several instances would publish with Postgres NOTIFY and feed its
+// local subscribers from a LISTEN connection.
+type EventBroker interface {
+	Publish(event Event)
+	// Subscribe returns a channel of the household's events and a function
+	// that cancels the subscription. The channel is closed when the
+	// subscription is cancelled or the subscriber falls too far behind.
+	Subscribe(householdID string) (<-chan Event, func())
+}
+
+type memoryBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+func newMemoryBroker() EventBroker {
+	return &memoryBroker{subscribers: map[string]map[chan Event]struct{}{}}
+}
+
+func (b *memoryBroker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[event.HouseholdID] {
+		select {
+		case ch <- event:
+		default:
+			b.remove(event.HouseholdID, ch)
+		}
+	}
+}
+
+func (b *memoryBroker) Subscribe(householdID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	if b.subscribers[householdID] == nil {
+		b.subscribers[householdID] = map[chan Event]struct{}{}
+	}
+	b.subscribers[householdID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(householdID, ch)
+	}
+}
+
+// remove closes a subscriber's channel. b.mu must be held.
+func (b *memoryBroker) remove(householdID string, ch chan Event) {
+	if _, ok := b.subscribers[householdID][ch]; !ok {
+		return
+	}
+	delete(b.subscribers[householdID], ch)
+	if len(b.subscribers[householdID]) == 0 {
+		delete(b.subscribers, householdID)
+	}
+	close(ch)
+}
+
+// StreamEvents streams the household's events as Server-Sent Events, using
+// the same envelope as webhooks. The stream ends when the current user is
+// removed from the household.
+func (h *Handlers) StreamEvents(c *gin.Context) {
+	householdID := c.Param("household_id")
+	userID := c.GetString("user_id")
+
+	events, unsubscribe := h.events.Subscribe(householdID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			if event.Type == EventMemberRemoved || event.Type == EventHouseholdDeleted {
+				member, err := isMember(h.db, userID, householdID)
+				return err == nil && member
+			}
+			return true
+		}
+	})
+}
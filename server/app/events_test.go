@@ -0,0 +1,122 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	b := newMemoryBroker()
+
+	mine, cancelMine := b.Subscribe("hh-1")
+	other, cancelOther := b.Subscribe("hh-2")
+	defer cancelOther()
+
+	b.Publish(Event{ID: "e1", HouseholdID: "hh-1", Type: EventCategoryCreated})
+	select {
+	case e := <-mine:
+		assert.Equal(t, "e1", e.ID)
+	default:
+		t.Fatal("expected an event")
+	}
+	assert.Empty(t, other)
+
+	cancelMine()
+	_, open := <-mine
+	assert.False(t, open)
+	cancelMine() // Cancelling twice is harmless
+
+	// Slow subscribers are dropped instead of blocking publishers
+	slow, cancelSlow := b.Subscribe("hh-2")
+	defer cancelSlow()
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(Event{HouseholdID: "hh-2"})
+	}
+	for range slow {
+	}
+}
+
+// readEvent reads the next Server-Sent Event, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) (string, Event) {
+	t.Helper()
+	var name string
+	var event Event
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = line[len("event:"):]
+		case strings.HasPrefix(line, "data:"):
+			require.NoError(t, json.Unmarshal([]byte(line[len("data:"):]), &event))
+		case line == "" && name != "":
+			return name, event
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-stream"
+	db.Create(&User{ID: "u1", HouseholdID: householdID, Email: "me@example.com"})
+	db.Create(&User{ID: "u2", HouseholdID: householdID, Email: "partner@example.com"})
+
+	r := gin.New()
+	r.GET("/households/:household_id/events", func(c *gin.Context) {
+		c.Set("user_id", "u1")
+		h.StreamEvents(c)
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/households/"+householdID+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	body := bufio.NewReader(resp.Body)
+
+	// Wait for the subscription before publishing
+	require.Eventually(t, func() bool {
+		b := h.events.(*memoryBroker)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.subscribers[householdID]) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	h.publishEvent("other", EventCategoryCreated, Category{ID: "not-mine"})
+	h.publishEvent(householdID, EventCategoryCreated, Category{ID: "cat-1", HouseholdID: householdID})
+	name, event := readEvent(t, body)
+	assert.Equal(t, EventCategoryCreated, name)
+	assert.Equal(t, householdID, event.HouseholdID)
+	assert.Equal(t, "cat-1", event.Data.(map[string]any)["id"])
+
+	// Another member leaving keeps the stream open
+	db.Delete(&User{}, "id = ?", "u2")
+	h.publishEvent(householdID, EventMemberRemoved, deletedResource{ID: "u2"})
+	name, _ = readEvent(t, body)
+	assert.Equal(t, EventMemberRemoved, name)
+
+	// Being removed ends it
+	db.Delete(&User{}, "id = ?", "u1")
+	h.publishEvent(householdID, EventMemberRemoved, deletedResource{ID: "u1"})
+	name, _ = readEvent(t, body)
+	assert.Equal(t, EventMemberRemoved, name)
+	_, err = body.ReadString('\n')
+	assert.Error(t, err)
+}
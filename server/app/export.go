@@ -0,0 +1,300 @@
+package app
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushEvery controls how many rows are buffered before being pushed
+// to the client while streaming an export.
+const exportFlushEvery = 500
+
+// rowWriter is implemented by the CSV and XLSX exporters.
+type rowWriter interface {
+	WriteRow(values []any) error
+	Flush() error
+	Close() error
+}
+
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvRowWriter) WriteRow(values []any) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch n := v.(type) {
+		case float64:
+			record[i] = strconv.FormatFloat(n, 'f', 2, 64)
+		case string:
+			record[i] = escapeCSVFormula(n)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvRowWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvRowWriter) Close() error {
+	return c.Flush()
+}
+
+// escapeCSVFormula prevents spreadsheet applications from evaluating
+// user-entered text (e.g. notes) as a formula.
+func escapeCSVFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// startExport validates the requested format and writes the response headers.
+// It returns nil if the format is not supported, after replying with 400, or
+// if the export cannot be started, after replying with 500.
+func startExport(c *gin.Context, filename, sheetName string) rowWriter {
+	format := c.DefaultQuery("format", "csv")
+
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "xlsx":
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Use csv or xlsx"})
+		return nil
+	}
+
+	// Headers are only sent with the first byte, so they can still be
+	// replaced if the writer fails to start
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+
+	var w rowWriter = &csvRowWriter{w: csv.NewWriter(c.Writer)}
+	if format == "xlsx" {
+		xw, err := newXLSXWriter(c.Writer, sheetName)
+		if err != nil {
+			log.Printf("Error starting XLSX export: %v", err)
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Content-Type")
+				c.Writer.Header().Del("Content-Disposition")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+			}
+			return nil
+		}
+		w = xw
+	}
+	c.Status(http.StatusOK)
+	return w
+}
+
+// parseDateRange reads the from/to query parameters using the given layout.
+// "to" is inclusive; the returned end is exclusive. Missing values fall back
+// to defaultStart and defaultEnd (exclusive). With only "to", the range is
+// as long as the default one and ends there.
+func parseDateRange(c *gin.Context, layout string, defaultStart, defaultEnd time.Time) (time.Time, time.Time, error) {
+	start, end := defaultStart, defaultEnd
+
+	step := func(t time.Time, n int) time.Time { return t.AddDate(0, 0, n) }
+	length := int(defaultEnd.Sub(defaultStart).Hours() / 24)
+	if layout == "2006-01" {
+		step = func(t time.Time, n int) time.Time { return t.AddDate(0, n, 0) }
+		length = (defaultEnd.Year()-defaultStart.Year())*12 + int(defaultEnd.Month()-defaultStart.Month())
+	}
+
+	if from := c.Query("from"); from != "" {
+		parsed, err := time.Parse(layout, from)
+		if err != nil {
+			return start, end, err
+		}
+		start = parsed
+	}
+	if to := c.Query("to"); to != "" {
+		parsed, err := time.Parse(layout, to)
+		if err != nil {
+			return start, end, err
+		}
+		end = step(parsed, 1)
+		if c.Query("from") == "" && !defaultStart.IsZero() {
+			start = step(end, -length)
+		}
+	}
+	if !end.IsZero() && !end.After(start) {
+		return start, end, fmt.Errorf("to must not be before from")
+	}
+	return start, end, nil
+}
+
+// currentMonthStart returns the first day of the current month in UTC.
+func currentMonthStart() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// ExportTransactions streams the household's transactions in a date range as
+// CSV or XLSX, with decrypted notes and resolved category, account and
+// member names.
+func (h *Handlers) ExportTransactions(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	month := currentMonthStart()
+	start, end, err := parseDateRange(c, "2006-01-02", month, month.AddDate(0, 1, 0))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range. Use from/to as YYYY-MM-DD"})
+		return
+	}
+
+	// Lookup tables are small compared to transactions, so keep them in memory.
+	var categories []Category
+	if err := h.db.Unscoped().Where("household_id = ?", householdID).Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+	categoryNames := make(map[string]string, len(categories))
+	for _, cat := range categories {
+		categoryNames[cat.ID] = string(cat.Name)
+	}
+
+	var accounts []Account
+	if err := h.db.Unscoped().Where("household_id = ?", householdID).Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+		return
+	}
+	accountNames := make(map[string]string, len(accounts))
+	for i := range accounts {
+		h.populateAccountDisplayName(&accounts[i])
+		accountNames[accounts[i].ID] = accounts[i].DisplayName
+	}
+
+	var users []User
+	if err := h.db.Unscoped().Where("id IN (?)", h.db.Model(&Transaction{}).Select("user_id").Where("household_id = ?", householdID)).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+	memberNames := make(map[string]string, len(users))
+	for _, u := range users {
+		memberNames[u.ID] = string(u.Name)
+	}
+
+	rows, err := h.db.Model(&Transaction{}).
+		Where("household_id = ? AND date >= ? AND date < ?", householdID, start, end).
+		Order("date ASC, created_at ASC").
+		Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	filename := fmt.Sprintf("keda-transactions-%s-%s", start.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02"))
+	w := startExport(c, filename, "Transactions")
+	if w == nil {
+		return
+	}
+
+	if err := w.WriteRow([]any{"id", "date", "amount", "category", "account", "member", "note"}); err != nil {
+		log.Printf("Error writing transaction export: %v", err)
+		return
+	}
+
+	n := 0
+	for rows.Next() {
+		var t Transaction
+		if err := h.db.ScanRows(rows, &t); err != nil {
+			log.Printf("Error scanning transaction for export: %v", err)
+			return
+		}
+		err := w.WriteRow([]any{
+			t.ID,
+			t.Date.UTC().Format("2006-01-02"),
+			t.Amount,
+			categoryNames[t.CategoryID],
+			accountNames[t.AccountID],
+			memberNames[t.UserID],
+			string(t.Description),
+		})
+		if err != nil {
+			log.Printf("Error writing transaction export: %v", err)
+			return
+		}
+		n++
+		if n%exportFlushEvery == 0 {
+			if err := w.Flush(); err != nil {
+				log.Printf("Error flushing transaction export: %v", err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		log.Printf("Error closing transaction export: %v", err)
+	}
+}
+
+// ExportSummaries streams one row per category and month with budget, spent
+// and remaining amounts, followed by a total row per month.
+func (h *Handlers) ExportSummaries(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	month := currentMonthStart()
+	start, end, err := parseDateRange(c, "2006-01", month, month.AddDate(0, 1, 0))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month range. Use from/to as YYYY-MM"})
+		return
+	}
+	if months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month()); months > maxTrendMonths {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Range too large. Maximum is 36 months"})
+		return
+	}
+
+	filename := fmt.Sprintf("keda-summary-%s-%s", start.Format("2006-01"), end.AddDate(0, -1, 0).Format("2006-01"))
+	w := startExport(c, filename, "Summary")
+	if w == nil {
+		return
+	}
+
+	if err := w.WriteRow([]any{"month", "category", "budget", "spent", "remaining"}); err != nil {
+		log.Printf("Error writing summary export: %v", err)
+		return
+	}
+
+	// Months are computed one at a time so only a single month is held in memory.
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		summary, err := h.buildMonthlySummary(householdID, month)
+		if err != nil {
+			log.Printf("Error building summary for export: %v", err)
+			return
+		}
+		for _, cat := range summary.Categories {
+			if err := w.WriteRow([]any{summary.Month, cat.Name, cat.Budget, cat.Spent, cat.Remaining}); err != nil {
+				log.Printf("Error writing summary export: %v", err)
+				return
+			}
+		}
+		if err := w.WriteRow([]any{summary.Month, "TOTAL", summary.TotalBudget, summary.TotalSpent, summary.TotalBudget - summary.TotalSpent}); err != nil {
+			log.Printf("Error writing summary export: %v", err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("Error flushing summary export: %v", err)
+			return
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		log.Printf("Error closing summary export: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupExportData(t *testing.T) (*Handlers, *gin.Engine, string) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-export"
+
+	db.Create(&User{ID: "u1", Name: "Alice", HouseholdID: householdID, Email: "alice@example.com"})
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: householdID, MonthlyBudget: 300})
+	db.Create(&Account{ID: "acc-1", Type: "card", Brand: ptrSecret("Visa"), Bank: ptrSecret("ACME"), HouseholdID: householdID})
+	db.Create(&Transaction{ID: "t1", HouseholdID: householdID, CategoryID: "cat-1", AccountID: "acc-1", UserID: "u1", Amount: 12.5, Date: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), Description: "Lunch"})
+	db.Create(&Transaction{ID: "t2", HouseholdID: householdID, CategoryID: "cat-1", AccountID: "acc-1", UserID: "u1", Amount: 40, Date: time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC), Description: "=SUM(A1)"})
+	db.Create(&Transaction{ID: "t3", HouseholdID: householdID, CategoryID: "cat-1", AccountID: "acc-1", UserID: "u1", Amount: 99, Date: time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC), Description: "Outside range"})
+
+	r := gin.Default()
+	r.GET("/households/:household_id/export/transactions", h.ExportTransactions)
+	r.GET("/households/:household_id/export/summaries", h.ExportSummaries)
+	return h, r, householdID
+}
+
+func ptrSecret(s string) *SecretString {
+	v := SecretString(s)
+	return &v
+}
+
+func TestExportTransactionsCSV(t *testing.T) {
+	_, r, householdID := setupExportData(t)
+
+	req, _ := http.NewRequest("GET", "/households/"+householdID+"/export/transactions?from=2024-01-01&to=2024-01-31", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "keda-transactions-2024-01-01-2024-01-31.csv")
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"id", "date", "amount", "category", "account", "member", "note"}, records[0])
+	assert.Equal(t, []string{"t1", "2024-01-10", "12.50", "Food", "Visa - ACME", "Alice", "Lunch"}, records[1])
+	assert.Equal(t, "'=SUM(A1)", records[2][6])
+}
+
+func TestExportTransactionsXLSX(t *testing.T) {
+	_, r, householdID := setupExportData(t)
+
+	req, _ := http.NewRequest("GET", "/households/"+householdID+"/export/transactions?from=2024-01-01&to=2024-02-29&format=xlsx", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			content, _ := io.ReadAll(rc)
+			_ = rc.Close()
+			sheet = string(content)
+		}
+	}
+	assert.Contains(t, sheet, "Lunch")
+	assert.Contains(t, sheet, "Outside range")
+	assert.Contains(t, sheet, `<c r="C2"><v>12.5</v></c>`)
+}
+
+func TestExportSummariesCSV(t *testing.T) {
+	_, r, householdID := setupExportData(t)
+
+	req, _ := http.NewRequest("GET", "/households/"+householdID+"/export/summaries?from=2024-01&to=2024-02", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"month", "category", "budget", "spent", "remaining"},
+		{"2024-01", "Food", "300.00", "52.50", "247.50"},
+		{"2024-01", "TOTAL", "300.00", "52.50", "247.50"},
+		{"2024-02", "Food", "300.00", "99.00", "201.00"},
+		{"2024-02", "TOTAL", "300.00", "99.00", "201.00"},
+	}, records)
+}
+
+func TestExportErrors(t *testing.T) {
+	_, r, householdID := setupExportData(t)
+
+	for _, url := range []string{
+		"/households/" + householdID + "/export/transactions?format=pdf",
+		"/households/" + householdID + "/export/transactions?from=yesterday",
+		"/households/" + householdID + "/export/transactions?from=2024-02-01&to=2024-01-01",
+		"/households/" + householdID + "/export/summaries?from=2024-13",
+		"/households/" + householdID + "/export/summaries?from=2020-01&to=2024-01",
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumn(0))
+	assert.Equal(t, "Z", xlsxColumn(25))
+	assert.Equal(t, "AA", xlsxColumn(26))
+	assert.Equal(t, "AZ", xlsxColumn(51))
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"math"
+	"time"
+)
+
+// forecastHistoryMonths is how many previous months are used to learn
+// spending patterns and recurring items.
+const forecastHistoryMonths = 3
+
+// recurringAmountTolerance is how far, as a share of the last amount, the
+// amounts of a recurring item may vary between months.
+const recurringAmountTolerance = 0.1
+
+// Forecast projects the end-of-month spending of a category, or of the whole
+// household, while the month is in progress.
+type Forecast struct {
+	ProjectedSpent float64 `json:"projected_spent"`
+	// ProjectedRemaining is negative when the month is projected to end over
+	// budget.
+	ProjectedRemaining float64 `json:"projected_remaining"`
+	// Recurring is the part of the projection coming from recurring items,
+	// whether already posted or still expected this month.
+	Recurring float64 `json:"recurring"`
+}
+
+type forecastTransaction struct {
+	CategoryID      string
+	DescriptionHash string
+	Amount          float64
+	Date            time.Time
+}
+
+// recurringItem is a transaction posted once a month, such as rent or a
+// subscription, identified by its category and note.
+type recurringItem struct {
+	categoryID string
+	hash       string
+}
+
+// forecastMonth projects end-of-month spending per category as of asOf,
+// which must fall within the month starting at startOfMonth. Recurring
+// items are counted once: as posted if they already were this month, or at
+// their last amount otherwise, and never extrapolated. The remaining,
+// variable spending is projected from the average of the current daily pace
+// and how much was historically spent in the rest of the month.
+func (h *Handlers) forecastMonth(householdID string, startOfMonth, asOf time.Time) (map[string]Forecast, error) {
+	endOfMonth := startOfMonth.AddDate(0, 1, 0)
+	historyStart := startOfMonth.AddDate(0, -forecastHistoryMonths, 0)
+
+	var transactions []forecastTransaction
+	if err := h.db.Model(&Transaction{}).
+		Select("category_id, description_hash, amount, date").
+		Where("household_id = ? AND date >= ? AND date < ?", householdID, historyStart, endOfMonth).
+		Scan(&transactions).Error; err != nil {
+		return nil, err
+	}
+
+	daysInMonth := endOfMonth.Sub(startOfMonth).Hours() / 24
+	daysElapsed := float64(asOf.Day())
+	elapsed := daysElapsed / daysInMonth
+
+	// Recurring items: notes posted once in each of the latest history months
+	amounts := map[recurringItem]map[string][]float64{}
+	lastAmount := map[recurringItem]float64{}
+	lastDate := map[recurringItem]time.Time{}
+	for _, t := range transactions {
+		if t.DescriptionHash == "" || !t.Date.Before(startOfMonth) {
+			continue
+		}
+		item := recurringItem{t.CategoryID, t.DescriptionHash}
+		if amounts[item] == nil {
+			amounts[item] = map[string][]float64{}
+		}
+		month := t.Date.Format("2006-01")
+		amounts[item][month] = append(amounts[item][month], t.Amount)
+		if !t.Date.Before(lastDate[item]) {
+			lastDate[item] = t.Date
+			lastAmount[item] = t.Amount
+		}
+	}
+	recurring := map[recurringItem]bool{}
+	for item, months := range amounts {
+		if isRecurring(months, startOfMonth, lastAmount[item]) {
+			recurring[item] = true
+		}
+	}
+
+	type categoryState struct {
+		variable      float64 // non-recurring spending so far this month
+		recurring     float64 // recurring spending counted once
+		historyTotal  float64 // non-recurring spending over the history months
+		historyToDate float64 // same, up to the elapsed share of each month
+	}
+	states := map[string]*categoryState{}
+	state := func(id string) *categoryState {
+		if s, ok := states[id]; ok {
+			return s
+		}
+		s := &categoryState{}
+		states[id] = s
+		return s
+	}
+
+	posted := map[recurringItem]bool{}
+	historyMonths := map[string]bool{}
+	for _, t := range transactions {
+		item := recurringItem{t.CategoryID, t.DescriptionHash}
+		s := state(t.CategoryID)
+
+		if !t.Date.Before(startOfMonth) {
+			if recurring[item] {
+				s.recurring += t.Amount
+				posted[item] = true
+			} else {
+				s.variable += t.Amount
+			}
+			continue
+		}
+
+		historyMonths[t.Date.Format("2006-01")] = true
+		if recurring[item] {
+			continue
+		}
+		s.historyTotal += t.Amount
+		monthStart := time.Date(t.Date.Year(), t.Date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		monthDays := monthStart.AddDate(0, 1, 0).Sub(monthStart).Hours() / 24
+		if float64(t.Date.Day())/monthDays <= elapsed {
+			s.historyToDate += t.Amount
+		}
+	}
+
+	// Recurring items not posted yet are expected once at their last amount
+	for item := range recurring {
+		if !posted[item] {
+			state(item.categoryID).recurring += lastAmount[item]
+		}
+	}
+
+	forecasts := make(map[string]Forecast, len(states))
+	for id, s := range states {
+		remaining := s.variable / daysElapsed * (daysInMonth - daysElapsed)
+		if len(historyMonths) > 0 {
+			historical := (s.historyTotal - s.historyToDate) / float64(len(historyMonths))
+			remaining = (remaining + historical) / 2
+		}
+		forecasts[id] = Forecast{
+			ProjectedSpent: round2(s.variable + remaining + s.recurring),
+			Recurring:      round2(s.recurring),
+		}
+	}
+	return forecasts, nil
+}
+
+// isRecurring tells whether an item with the given amounts per month
+// ("2006-01") recurs into the month starting at startOfMonth: it was posted
+// once in each history month since it first appeared, at least two of them,
+// and always within recurringAmountTolerance of its last amount.
+func isRecurring(amounts map[string][]float64, startOfMonth time.Time, last float64) bool {
+	months := 0
+	for i := 1; i <= forecastHistoryMonths; i++ {
+		posted, ok := amounts[startOfMonth.AddDate(0, -i, 0).Format("2006-01")]
+		if !ok {
+			break
+		}
+		if len(posted) != 1 || math.Abs(posted[0]-last) > recurringAmountTolerance*math.Abs(last) {
+			return false
+		}
+		months++
+	}
+	return months >= 2 && months == len(amounts)
+}
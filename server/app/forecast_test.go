@@ -0,0 +1,115 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonthlySummaryForecast(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-forecast"
+
+	db.Create(&Category{ID: "cat-food", Name: "Food", HouseholdID: householdID, MonthlyBudget: 300})
+	db.Create(&Category{ID: "cat-home", Name: "Home", HouseholdID: householdID, MonthlyBudget: 1000})
+	db.Create(&Category{ID: "cat-fun", Name: "Fun", HouseholdID: householdID, MonthlyBudget: 50})
+
+	n := 0
+	add := func(categoryID, note string, amount float64, month time.Month, day int) {
+		n++
+		require.NoError(t, db.Create(&Transaction{
+			ID:          fmt.Sprintf("t%d", n),
+			HouseholdID: householdID,
+			CategoryID:  categoryID,
+			Description: SecretString(note),
+			Amount:      amount,
+			Date:        time.Date(2024, month, day, 12, 0, 0, 0, time.UTC),
+		}).Error)
+	}
+
+	for _, m := range []time.Month{time.February, time.March, time.April} {
+		add("cat-home", "Rent", 1000, m, 1)
+		add("cat-food", "", 100, m, 5)
+		add("cat-food", "", 200, m, 25)
+	}
+	add("cat-fun", "Netflix", 15, time.March, 20)
+	add("cat-fun", "Netflix", 15, time.April, 20)
+
+	add("cat-home", "rent ", 1000, time.May, 1)
+	add("cat-food", "", 150, time.May, 10)
+
+	may := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	summary, err := h.buildMonthlySummaryAt(householdID, may, time.Date(2024, time.May, 15, 18, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	forecasts := map[string]Forecast{}
+	for _, cat := range summary.Categories {
+		require.NotNil(t, cat.Forecast, cat.Name)
+		forecasts[cat.ID] = *cat.Forecast
+	}
+
+	// Food: 150 spent by day 15 of 31. Pace adds 160, history adds 200
+	// (two thirds of the usual 300 comes later in the month), averaged.
+	assert.Equal(t, Forecast{ProjectedSpent: 330, ProjectedRemaining: -30}, forecasts["cat-food"])
+	// Rent is already posted and not extrapolated
+	assert.Equal(t, Forecast{ProjectedSpent: 1000, ProjectedRemaining: 0, Recurring: 1000}, forecasts["cat-home"])
+	// Netflix is still expected once
+	assert.Equal(t, Forecast{ProjectedSpent: 15, ProjectedRemaining: 35, Recurring: 15}, forecasts["cat-fun"])
+
+	require.NotNil(t, summary.Forecast)
+	assert.Equal(t, Forecast{ProjectedSpent: 1345, ProjectedRemaining: 5, Recurring: 1015}, *summary.Forecast)
+
+	// Past months have no forecast
+	april := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	summary, err = h.buildMonthlySummaryAt(householdID, april, time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Nil(t, summary.Forecast)
+	assert.Nil(t, summary.Categories[0].Forecast)
+}
+
+func TestForecastRecurringItems(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-recurring"
+
+	n := 0
+	add := func(categoryID, note string, amount float64, month time.Month, day int) {
+		n++
+		require.NoError(t, db.Create(&Transaction{
+			ID:          fmt.Sprintf("r%d", n),
+			HouseholdID: householdID,
+			CategoryID:  categoryID,
+			Description: SecretString(note),
+			Amount:      amount,
+			Date:        time.Date(2024, month, day, 12, 0, 0, 0, time.UTC),
+		}).Error)
+	}
+
+	for _, m := range []time.Month{time.February, time.March, time.April} {
+		add("cat-coffee", "Coffee", 10, m, 5)
+		add("cat-coffee", "Coffee", 10, m, 25)
+	}
+	add("cat-coffee", "Coffee", 10, time.May, 5)
+
+	add("cat-gym", "Gym", 30, time.February, 1)
+	add("cat-gym", "Gym", 60, time.March, 1)
+	add("cat-gym", "Gym", 45, time.April, 1)
+
+	add("cat-rent", "Rent", 1000, time.February, 1)
+	add("cat-rent", "Rent", 1000, time.April, 1)
+
+	may := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	forecasts, err := h.forecastMonth(householdID, may, time.Date(2024, time.May, 15, 18, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	// Several purchases a month are spending, not a recurring item: the 10
+	// spent is extrapolated by pace (10.67) and history (10), averaged.
+	assert.Equal(t, Forecast{ProjectedSpent: 20.33}, forecasts["cat-coffee"])
+	// Amounts that vary too much, or a skipped month, are not recurring
+	assert.Zero(t, forecasts["cat-gym"].Recurring)
+	assert.Zero(t, forecasts["cat-rent"].Recurring)
+}
@@ -2,14 +2,14 @@ package app
 
 import (
 	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math"
 	"math/big"
 	"net/http"
 	"net/mail"
+	"net/url"
 	"time"
 
 	"github.com/schoren/keda/server/config"
@@ -44,6 +44,9 @@ type Handlers struct {
 	db           *gorm.DB
 	cfg          *config.Config
 	googleAPIURL string
+	events       EventBroker
+	// inviteAttempts locks out users guessing invitation codes.
+	inviteAttempts *attemptLimiter
 }
 
 func NewHandlers(db *gorm.DB, cfg *config.Config) *Handlers {
@@ -51,9 +54,38 @@ func NewHandlers(db *gorm.DB, cfg *config.Config) *Handlers {
 		db:           db,
 		cfg:          cfg,
 		googleAPIURL: "https://www.googleapis.com/oauth2/v3/userinfo",
+		events:       newMemoryBroker(),
+
+		inviteAttempts: newAttemptLimiter(inviteAttemptLimit, inviteAttemptWindow),
 	}
 }
 
+// requestError is a rejected change, with the status and message to answer
+// with. Changes that can also be made in a batch return it, so both answer
+// the same way.
+type requestError struct {
+	status  int
+	message string
+	// current is the entity as it is now, when the change was made to a
+	// stale version.
+	current versioned
+}
+
+func (e *requestError) Error() string { return e.message }
+
+func (e *requestError) respond(c *gin.Context) {
+	if e.current == nil {
+		c.JSON(e.status, gin.H{"error": e.message})
+		return
+	}
+	c.Header("ETag", etag(e.current.version()))
+	c.JSON(e.status, gin.H{"error": e.message, "current": e.current})
+}
+
+// errStaleVersion rolls back a change made to a version that changed
+// meanwhile.
+var errStaleVersion = errors.New("stale version")
+
 // ============================================================================
 // HOUSEHOLDS
 // ============================================================================
@@ -65,7 +97,24 @@ func (h *Handlers) CreateHousehold(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Create(&household).Error; err != nil {
+	if household.Locale != "" && !isSupportedLocale(household.Locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale"})
+		return
+	}
+
+	if household.ID == "" {
+		household.ID = uuid.New().String()
+	}
+
+	// The caller owns the household they create
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&household).Error; err != nil {
+			return err
+		}
+		_, err := addMembership(tx, c.GetString("user_id"), household.ID)
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create household"})
 		return
 	}
@@ -93,40 +142,48 @@ func (h *Handlers) CreateInvitation(c *gin.Context) {
 	}
 
 	// Check for duplicate pending invitation
+	now := time.Now().UTC()
 	var existingInvitation Invitation
-	if err := h.db.Where("household_id = ? AND email_hash = ? AND status = ?", householdID, HashSensitive(req.Email), "pending").First(&existingInvitation).Error; err == nil {
+	if err := h.db.Scopes(pendingInvitations(now)).Where("household_id = ? AND email_hash = ?", householdID, HashSensitive(req.Email)).First(&existingInvitation).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Invitation already pending for this email"})
 		return
 	}
 
-	// Generate a 6-char random hex code
-	b := make([]byte, 3)
-	if _, err := rand.Read(b); err != nil {
+	code, err := newInvitationCode()
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation code"})
 		return
 	}
-	code := hex.EncodeToString(b)
 
 	invitation := Invitation{
 		ID:          uuid.New().String(),
 		Code:        code,
 		Email:       SecretString(req.Email),
 		HouseholdID: householdID,
-		Status:      "pending",
+		Status:      InvitationPending,
+		ExpiresAt:   h.invitationExpiry(now),
+		SentAt:      &now,
 	}
 
-	if err := h.db.Create(&invitation).Error; err != nil {
+	// The email is delivered by the outbox worker, so it survives SMTP
+	// outages and restarts.
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invitation).Error; err != nil {
+			return err
+		}
+		return h.QueueInvitationEmail(tx, req.Email, code, householdID)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
 		return
 	}
 
-	// Send email asyc
-	go func() {
-		err := h.SendInvitationEmail(req.Email, code)
-		if err != nil {
-			log.Printf("Error sending invitation email to %s: %v", req.Email, err)
-		}
-	}()
+	h.publishEvent(householdID, EventMemberInvited, MemberResponse{
+		ID:     invitation.ID,
+		Name:   "Invitado",
+		Email:  req.Email,
+		Status: "pending",
+	})
 
 	c.JSON(http.StatusCreated, invitation)
 }
@@ -142,6 +199,7 @@ type MemberResponse struct {
 	PictureURL string `json:"picture_url"`
 	Color      string `json:"color"`
 	Status     string `json:"status"` // "active" or "pending"
+	Role       string `json:"role,omitempty"`
 	InviteCode string `json:"invite_code,omitempty"`
 }
 
@@ -150,14 +208,19 @@ func (h *Handlers) GetMembers(c *gin.Context) {
 
 	// 1. Get Users (active members)
 	var users []User
-	if err := h.db.Where("household_id = ?", householdID).Find(&users).Error; err != nil {
+	if err := h.db.Where("id IN (?)", memberIDs(h.db, householdID)).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+	roles, err := memberRoles(h.db, householdID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
 		return
 	}
 
 	// 2. Get Pending Invitations
 	var invitations []Invitation
-	if err := h.db.Where("household_id = ? AND status = ?", householdID, "pending").Find(&invitations).Error; err != nil {
+	if err := h.db.Scopes(pendingInvitations(time.Now().UTC())).Where("household_id = ?", householdID).Find(&invitations).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
 		return
 	}
@@ -166,14 +229,7 @@ func (h *Handlers) GetMembers(c *gin.Context) {
 	var response []MemberResponse
 
 	for _, user := range users {
-		response = append(response, MemberResponse{
-			ID:         user.ID,
-			Name:       string(user.Name),
-			Email:      string(user.Email),
-			PictureURL: user.PictureURL,
-			Color:      user.Color,
-			Status:     "active",
-		})
+		response = append(response, activeMember(user, roles[user.ID]))
 	}
 
 	for _, invite := range invitations {
@@ -202,13 +258,14 @@ func (h *Handlers) RemoveMember(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove invitation"})
 			return
 		}
+		h.publishEvent(householdID, EventMemberRemoved, deletedResource{ID: invitation.ID})
 		c.JSON(http.StatusOK, gin.H{"message": "Invitation removed"})
 		return
 	}
 
-	// 2. Check if it's a user
-	var user User
-	if err := h.db.Where("id = ? AND household_id = ?", targetID, householdID).First(&user).Error; err != nil {
+	// 2. Check if it's a member
+	var membership Membership
+	if err := h.db.Where("user_id = ? AND household_id = ?", targetID, householdID).First(&membership).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Member or invitation not found"})
 		} else {
@@ -217,12 +274,28 @@ func (h *Handlers) RemoveMember(c *gin.Context) {
 		return
 	}
 
-	// Soft delete the user
-	if err := h.db.Delete(&user).Error; err != nil {
+	if membership.Role == RoleOwner && c.GetString("role") != RoleOwner {
+		requiresRole(RoleOwner).respond(c)
+		return
+	}
+
+	// Soft delete the membership: the user keeps their other households
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&membership).Error; err != nil {
+			return err
+		}
+		return ensureOwner(tx, householdID)
+	})
+	if errors.Is(err, errLastOwner) {
+		lastOwnerError().respond(c)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
 		return
 	}
 
+	h.publishEvent(householdID, EventMemberRemoved, deletedResource{ID: membership.UserID})
 	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
 }
 
@@ -240,6 +313,15 @@ func (h *Handlers) GetCategories(c *gin.Context) {
 	c.JSON(http.StatusOK, categories)
 }
 
+func (h *Handlers) GetCategory(c *gin.Context) {
+	category := findLive[Category](h.db, c.Param("household_id"), c.Param("id"))
+	if category == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	respondVersioned(c, http.StatusOK, *category)
+}
+
 func (h *Handlers) CreateCategory(c *gin.Context) {
 	householdID := c.Param("household_id")
 	var category Category
@@ -248,24 +330,32 @@ func (h *Handlers) CreateCategory(c *gin.Context) {
 		return
 	}
 
+	category, rerr := createCategory(h.db, householdID, category)
+	if rerr != nil {
+		rerr.respond(c)
+		return
+	}
+
+	h.publishEvent(householdID, EventCategoryCreated, category)
+	respondVersioned(c, http.StatusCreated, category)
+}
+
+func createCategory(db *gorm.DB, householdID string, category Category) (Category, *requestError) {
 	if category.ID == "" {
 		category.ID = uuid.New().String()
 	}
 	category.HouseholdID = householdID
-	if err := h.db.Create(&category).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
-		return
+	if err := db.Create(&category).Error; err != nil {
+		return category, &requestError{status: http.StatusInternalServerError, message: "Failed to create category"}
 	}
-
-	c.JSON(http.StatusCreated, category)
+	return category, nil
 }
 
 func (h *Handlers) UpdateCategory(c *gin.Context) {
 	householdID := c.Param("household_id")
 	id := c.Param("id")
 
-	var category Category
-	if err := h.db.Where("household_id = ?", householdID).First(&category, "id = ?", id).Error; err != nil {
+	if err := h.db.Where("household_id = ?", householdID).First(&Category{}, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
 		return
 	}
@@ -276,31 +366,89 @@ func (h *Handlers) UpdateCategory(c *gin.Context) {
 		return
 	}
 
+	category, rerr := updateCategory(h.db, householdID, id, c.GetHeader("If-Match"), updates)
+	if rerr != nil {
+		rerr.respond(c)
+		return
+	}
+
+	h.publishEvent(householdID, EventCategoryUpdated, category)
+	respondVersioned(c, http.StatusOK, category)
+}
+
+// updateCategory changes a category, if ifMatch matches its version.
+func updateCategory(db *gorm.DB, householdID, id, ifMatch string, updates Category) (Category, *requestError) {
+	var category Category
+	if err := db.Where("household_id = ?", householdID).First(&category, "id = ?", id).Error; err != nil {
+		return category, &requestError{status: http.StatusNotFound, message: "Category not found"}
+	}
+	if !etagMatches(ifMatch, category.ChangeSeq) {
+		return category, preconditionFailed(category)
+	}
+
 	// Update fields
 	category.Name = updates.Name
 	category.MonthlyBudget = updates.MonthlyBudget
 	category.IsActive = updates.IsActive
 
-	if err := h.db.Save(&category).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
-		return
+	query := db.Model(&category)
+	if ifMatch != "" {
+		query = query.Where("change_seq = ?", category.ChangeSeq)
 	}
-
-	c.JSON(http.StatusOK, category)
+	result := query.Select("name", "monthly_budget", "is_active").Updates(&category)
+	if result.Error != nil {
+		return category, &requestError{status: http.StatusInternalServerError, message: "Failed to update category"}
+	}
+	if result.RowsAffected == 0 {
+		if current := findLive[Category](db, householdID, id); current != nil {
+			return *current, preconditionFailed(*current)
+		}
+		return category, &requestError{status: http.StatusNotFound, message: "Category not found"}
+	}
+	return category, nil
 }
 
 func (h *Handlers) DeleteCategory(c *gin.Context) {
 	householdID := c.Param("household_id")
 	id := c.Param("id")
 
-	if err := h.db.Where("household_id = ?", householdID).Delete(&Category{}, "id = ?", id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+	deleted, rerr := deleteCategory(h.db, householdID, id, c.GetHeader("If-Match"))
+	if rerr != nil {
+		rerr.respond(c)
 		return
 	}
+	if deleted {
+		h.publishEvent(householdID, EventCategoryDeleted, deletedResource{ID: id})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Category deleted"})
 }
 
+// deleteCategory reports whether the category existed. With ifMatch, only
+// that version is deleted.
+func deleteCategory(db *gorm.DB, householdID, id, ifMatch string) (bool, *requestError) {
+	query := db.Where("household_id = ?", householdID)
+	if ifMatch != "" {
+		if current := findLive[Category](db, householdID, id); current != nil {
+			if !etagMatches(ifMatch, current.ChangeSeq) {
+				return false, preconditionFailed(*current)
+			}
+			query = query.Where("change_seq = ?", current.ChangeSeq)
+		}
+	}
+
+	result := query.Delete(&Category{}, "id = ?", id)
+	if result.Error != nil {
+		return false, &requestError{status: http.StatusInternalServerError, message: "Failed to delete category"}
+	}
+	if result.RowsAffected == 0 && ifMatch != "" {
+		if current := findLive[Category](db, householdID, id); current != nil {
+			return false, preconditionFailed(*current)
+		}
+	}
+	return result.RowsAffected > 0, nil
+}
+
 // ============================================================================
 // ACCOUNTS
 // ============================================================================
@@ -318,6 +466,16 @@ func (h *Handlers) GetAccounts(c *gin.Context) {
 	c.JSON(http.StatusOK, accounts)
 }
 
+func (h *Handlers) GetAccount(c *gin.Context) {
+	account := findLive[Account](h.db, c.Param("household_id"), c.Param("id"))
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+	h.populateAccountDisplayName(account)
+	respondVersioned(c, http.StatusOK, *account)
+}
+
 func (h *Handlers) CreateAccount(c *gin.Context) {
 	householdID := c.Param("household_id")
 	var account Account
@@ -326,12 +484,22 @@ func (h *Handlers) CreateAccount(c *gin.Context) {
 		return
 	}
 
+	account, rerr := h.createAccount(h.db, householdID, account)
+	if rerr != nil {
+		rerr.respond(c)
+		return
+	}
+
+	h.publishEvent(householdID, EventAccountCreated, account)
+	respondVersioned(c, http.StatusCreated, account)
+}
+
+func (h *Handlers) createAccount(db *gorm.DB, householdID string, account Account) (Account, *requestError) {
 	if account.Type == "cash" {
 		var count int64
-		h.db.Model(&Account{}).Where("household_id = ? AND type = ?", householdID, "cash").Count(&count)
+		db.Model(&Account{}).Where("household_id = ? AND type = ?", householdID, "cash").Count(&count)
 		if count > 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot create additional cash accounts"})
-			return
+			return account, &requestError{status: http.StatusBadRequest, message: "Cannot create additional cash accounts"}
 		}
 	}
 
@@ -339,13 +507,12 @@ func (h *Handlers) CreateAccount(c *gin.Context) {
 		account.ID = uuid.New().String()
 	}
 	account.HouseholdID = householdID
-	if err := h.db.Create(&account).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
-		return
+	if err := db.Create(&account).Error; err != nil {
+		return account, &requestError{status: http.StatusInternalServerError, message: "Failed to create account"}
 	}
 
 	h.populateAccountDisplayName(&account)
-	c.JSON(http.StatusCreated, account)
+	return account, nil
 }
 
 func (h *Handlers) UpdateAccount(c *gin.Context) {
@@ -358,15 +525,29 @@ func (h *Handlers) UpdateAccount(c *gin.Context) {
 		return
 	}
 
-	var existing Account
-	if err := h.db.First(&existing, "id = ? AND household_id = ?", id, householdID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	account, rerr := h.updateAccount(h.db, householdID, id, c.GetHeader("If-Match"), updates)
+	if rerr != nil {
+		rerr.respond(c)
 		return
 	}
 
+	h.publishEvent(householdID, EventAccountUpdated, account)
+	respondVersioned(c, http.StatusOK, account)
+}
+
+// updateAccount changes an account, if ifMatch matches its version.
+func (h *Handlers) updateAccount(db *gorm.DB, householdID, id, ifMatch string, updates Account) (Account, *requestError) {
+	var existing Account
+	if err := db.First(&existing, "id = ? AND household_id = ?", id, householdID).Error; err != nil {
+		return existing, &requestError{status: http.StatusNotFound, message: "Account not found"}
+	}
+
 	if existing.Type == "cash" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot edit mandatory cash account"})
-		return
+		return existing, &requestError{status: http.StatusForbidden, message: "Cannot edit mandatory cash account"}
+	}
+	if !etagMatches(ifMatch, existing.ChangeSeq) {
+		h.populateAccountDisplayName(&existing)
+		return existing, preconditionFailed(existing)
 	}
 
 	// Update fields
@@ -375,13 +556,24 @@ func (h *Handlers) UpdateAccount(c *gin.Context) {
 	existing.Brand = updates.Brand
 	existing.Bank = updates.Bank
 
-	if err := h.db.Save(&existing).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
-		return
+	query := db.Model(&existing)
+	if ifMatch != "" {
+		query = query.Where("change_seq = ?", existing.ChangeSeq)
+	}
+	result := query.Select("type", "name", "brand", "bank").Updates(&existing)
+	if result.Error != nil {
+		return existing, &requestError{status: http.StatusInternalServerError, message: "Failed to update account"}
+	}
+	if result.RowsAffected == 0 {
+		if current := findLive[Account](db, householdID, id); current != nil {
+			h.populateAccountDisplayName(current)
+			return *current, preconditionFailed(*current)
+		}
+		return existing, &requestError{status: http.StatusNotFound, message: "Account not found"}
 	}
 
 	h.populateAccountDisplayName(&existing)
-	c.JSON(http.StatusOK, existing)
+	return existing, nil
 }
 
 func (h *Handlers) createDefaultCashAccount(householdID string) {
@@ -429,23 +621,47 @@ func (h *Handlers) DeleteAccount(c *gin.Context) {
 	householdID := c.Param("household_id")
 	id := c.Param("id")
 
-	var account Account
-	if err := h.db.First(&account, "id = ? AND household_id = ?", id, householdID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	if rerr := h.deleteAccount(h.db, householdID, id, c.GetHeader("If-Match")); rerr != nil {
+		rerr.respond(c)
 		return
 	}
 
-	if account.Type == "cash" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot delete mandatory cash account"})
-		return
+	h.publishEvent(householdID, EventAccountDeleted, deletedResource{ID: id})
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// deleteAccount deletes an account, if ifMatch matches its version.
+func (h *Handlers) deleteAccount(db *gorm.DB, householdID, id, ifMatch string) *requestError {
+	var account Account
+	if err := db.First(&account, "id = ? AND household_id = ?", id, householdID).Error; err != nil {
+		return &requestError{status: http.StatusNotFound, message: "Account not found"}
 	}
 
-	if err := h.db.Delete(&account).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
-		return
+	if account.Type == "cash" {
+		return &requestError{status: http.StatusForbidden, message: "Cannot delete mandatory cash account"}
+	}
+	stale := func(current Account) *requestError {
+		h.populateAccountDisplayName(&current)
+		return preconditionFailed(current)
+	}
+	if !etagMatches(ifMatch, account.ChangeSeq) {
+		return stale(account)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+	query := db
+	if ifMatch != "" {
+		query = query.Where("change_seq = ?", account.ChangeSeq)
+	}
+	result := query.Delete(&account)
+	if result.Error != nil {
+		return &requestError{status: http.StatusInternalServerError, message: "Failed to delete account"}
+	}
+	if result.RowsAffected == 0 && ifMatch != "" {
+		if current := findLive[Account](db, householdID, id); current != nil {
+			return stale(*current)
+		}
+	}
+	return nil
 }
 
 // ============================================================================
@@ -477,6 +693,15 @@ func (h *Handlers) GetTransactions(c *gin.Context) {
 	c.JSON(http.StatusOK, transactions)
 }
 
+func (h *Handlers) GetTransaction(c *gin.Context) {
+	var transaction Transaction
+	if err := h.db.Preload("User").Where("household_id = ?", c.Param("household_id")).First(&transaction, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	respondVersioned(c, http.StatusOK, transaction)
+}
+
 func (h *Handlers) GetSuggestedNotes(c *gin.Context) {
 	householdID := c.Param("household_id")
 	categoryID := c.Param("id")
@@ -515,34 +740,44 @@ func (h *Handlers) CreateTransaction(c *gin.Context) {
 		return
 	}
 
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(string)
+	transaction, rerr := createTransaction(h.db, householdID, id, transaction)
+	if rerr != nil {
+		rerr.respond(c)
+		return
+	}
+
+	h.afterTransactionSaved(transaction)
+	h.publishEvent(householdID, EventTransactionCreated, transaction)
+	respondVersioned(c, http.StatusCreated, transaction)
+}
+
+func createTransaction(db *gorm.DB, householdID, userID string, transaction Transaction) (Transaction, *requestError) {
 	if transaction.ID == "" {
 		transaction.ID = uuid.New().String()
 	}
 	transaction.HouseholdID = householdID
 	transaction.Date = transaction.Date.UTC()
-
-	userID, _ := c.Get("user_id")
-	if id, ok := userID.(string); ok {
-		transaction.UserID = id
+	if userID != "" {
+		transaction.UserID = userID
 	}
 
-	if err := h.db.Create(&transaction).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction"})
-		return
+	if err := db.Create(&transaction).Error; err != nil {
+		return transaction, &requestError{status: http.StatusInternalServerError, message: "Failed to create transaction"}
 	}
 
 	// Preload user for consistent frontend experience
-	h.db.Preload("User").First(&transaction, "id = ?", transaction.ID)
-
-	c.JSON(http.StatusCreated, transaction)
+	db.Preload("User").First(&transaction, "id = ?", transaction.ID)
+	return transaction, nil
 }
 
 func (h *Handlers) UpdateTransaction(c *gin.Context) {
 	householdID := c.Param("household_id")
 	id := c.Param("id")
 
-	var oldTransaction Transaction
-	if err := h.db.Where("household_id = ?", householdID).First(&oldTransaction, "id = ?", id).Error; err != nil {
+	ifMatch := c.GetHeader("If-Match")
+	if current := currentTransaction(h.db, householdID, id); current == nil || (current.ID != id && ifMatch == "") {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
@@ -553,12 +788,48 @@ func (h *Handlers) UpdateTransaction(c *gin.Context) {
 		return
 	}
 
+	newTransaction, rerr := updateTransaction(h.db, householdID, id, ifMatch, updates)
+	if rerr != nil {
+		rerr.respond(c)
+		return
+	}
+
+	h.afterTransactionSaved(newTransaction)
+	h.publishEvent(householdID, EventTransactionUpdated, updatedTransaction{Transaction: newTransaction, PreviousID: id})
+	respondVersioned(c, http.StatusOK, newTransaction)
+}
+
+// updateTransaction replaces the transaction with a new version, keeping the
+// old one soft deleted. A version that was replaced meanwhile is never
+// replaced twice; with ifMatch, the newer one is returned to merge with.
+func updateTransaction(db *gorm.DB, householdID, id, ifMatch string, updates Transaction) (Transaction, *requestError) {
+	stale := func() *requestError {
+		if ifMatch != "" {
+			if current := currentTransaction(db, householdID, id); current != nil {
+				return preconditionFailed(*current)
+			}
+		}
+		return &requestError{status: http.StatusNotFound, message: "Transaction not found"}
+	}
+
+	var oldTransaction Transaction
+	if err := db.Where("household_id = ?", householdID).First(&oldTransaction, "id = ?", id).Error; err != nil {
+		return oldTransaction, stale()
+	}
+	if !etagMatches(ifMatch, oldTransaction.ChangeSeq) {
+		return oldTransaction, stale()
+	}
+
 	// Use transaction for atomicity
 	var newTransaction Transaction
-	err := h.db.Transaction(func(tx *gorm.DB) error {
-		// Soft delete original record
-		if err := tx.Delete(&oldTransaction).Error; err != nil {
-			return err
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Soft delete original record, unless it changed since it was read
+		result := tx.Where("change_seq = ?", oldTransaction.ChangeSeq).Delete(&oldTransaction)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStaleVersion
 		}
 
 		// Create new record
@@ -572,6 +843,7 @@ func (h *Handlers) UpdateTransaction(c *gin.Context) {
 			Description:           updates.Description,
 			HouseholdID:           householdID,
 			ReplacedTransactionID: &oldTransaction.ID,
+			ExternalID:            oldTransaction.ExternalID,
 		}
 
 		if err := tx.Create(&newTransaction).Error; err != nil {
@@ -581,39 +853,71 @@ func (h *Handlers) UpdateTransaction(c *gin.Context) {
 		return nil
 	})
 
+	if errors.Is(err, errStaleVersion) {
+		return newTransaction, stale()
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction version"})
-		return
+		return newTransaction, &requestError{status: http.StatusInternalServerError, message: "Failed to update transaction version"}
 	}
 
 	// Preload user for consistent frontend experience
-	h.db.Preload("User").First(&newTransaction, "id = ?", newTransaction.ID)
-
-	c.JSON(http.StatusOK, newTransaction)
+	db.Preload("User").First(&newTransaction, "id = ?", newTransaction.ID)
+	return newTransaction, nil
 }
 
 func (h *Handlers) DeleteTransaction(c *gin.Context) {
 	householdID := c.Param("household_id")
 	id := c.Param("id")
 
-	if err := h.db.Where("household_id = ?", householdID).Delete(&Transaction{}, "id = ?", id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete transaction"})
+	deleted, rerr := deleteTransaction(h.db, householdID, id, c.GetHeader("If-Match"))
+	if rerr != nil {
+		rerr.respond(c)
 		return
 	}
+	if deleted {
+		h.publishEvent(householdID, EventTransactionDeleted, deletedResource{ID: id})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Transaction deleted"})
 }
 
+// deleteTransaction reports whether the transaction existed. With ifMatch,
+// only that version is deleted.
+func deleteTransaction(db *gorm.DB, householdID, id, ifMatch string) (bool, *requestError) {
+	query := db.Where("household_id = ?", householdID)
+	if ifMatch != "" {
+		current := currentTransaction(db, householdID, id)
+		if current != nil && (current.ID != id || !etagMatches(ifMatch, current.ChangeSeq)) {
+			return false, preconditionFailed(*current)
+		}
+		if current != nil {
+			query = query.Where("change_seq = ?", current.ChangeSeq)
+		}
+	}
+
+	result := query.Delete(&Transaction{}, "id = ?", id)
+	if result.Error != nil {
+		return false, &requestError{status: http.StatusInternalServerError, message: "Failed to delete transaction"}
+	}
+	if result.RowsAffected == 0 && ifMatch != "" {
+		if current := currentTransaction(db, householdID, id); current != nil {
+			return false, preconditionFailed(*current)
+		}
+	}
+	return result.RowsAffected > 0, nil
+}
+
 // ============================================================================
 // MONTHLY SUMMARY
 // ============================================================================
 
 type CategorySummary struct {
-	ID        string  `json:"id"`
-	Name      string  `json:"name"`
-	Budget    float64 `json:"budget"`
-	Spent     float64 `json:"spent"`
-	Remaining float64 `json:"remaining"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Budget    float64   `json:"budget"`
+	Spent     float64   `json:"spent"`
+	Remaining float64   `json:"remaining"`
+	Forecast  *Forecast `json:"forecast,omitempty"`
 }
 
 type MonthlySummary struct {
@@ -621,6 +925,8 @@ type MonthlySummary struct {
 	TotalBudget float64           `json:"total_budget"`
 	TotalSpent  float64           `json:"total_spent"`
 	Categories  []CategorySummary `json:"categories"`
+	// Forecast is only set for the month in progress
+	Forecast *Forecast `json:"forecast,omitempty"`
 }
 
 func (h *Handlers) GetMonthlySummary(c *gin.Context) {
@@ -637,16 +943,41 @@ func (h *Handlers) GetMonthlySummary(c *gin.Context) {
 		return
 	}
 
-	startOfMonth := parsed
+	summary, err := h.buildMonthlySummary(householdID, parsed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// buildMonthlySummary computes budget vs. spent per category for the month
+// starting at startOfMonth, with an end-of-month forecast if the month is in
+// progress.
+func (h *Handlers) buildMonthlySummary(householdID string, startOfMonth time.Time) (MonthlySummary, error) {
+	return h.buildMonthlySummaryAt(householdID, startOfMonth, time.Now().UTC())
+}
+
+func (h *Handlers) buildMonthlySummaryAt(householdID string, startOfMonth, now time.Time) (MonthlySummary, error) {
 	endOfMonth := startOfMonth.AddDate(0, 1, 0)
 
 	// Get all categories for this household
 	var categories []Category
 	if err := h.db.Where("household_id = ?", householdID).Find(&categories).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
-		return
+		return MonthlySummary{}, err
 	}
 
+	var forecasts map[string]Forecast
+	inProgress := !now.Before(startOfMonth) && now.Before(endOfMonth)
+	if inProgress {
+		var err error
+		if forecasts, err = h.forecastMonth(householdID, startOfMonth, now); err != nil {
+			return MonthlySummary{}, err
+		}
+	}
+	var total Forecast
+
 	// Calculate summary for each category
 	var categorySummaries []CategorySummary
 	var totalBudget, totalSpent float64
@@ -658,95 +989,39 @@ func (h *Handlers) GetMonthlySummary(c *gin.Context) {
 			Select("COALESCE(SUM(amount), 0)").
 			Scan(&spent)
 
-		categorySummaries = append(categorySummaries, CategorySummary{
+		summary := CategorySummary{
 			ID:        cat.ID,
 			Name:      string(cat.Name),
 			Budget:    cat.MonthlyBudget,
 			Spent:     spent,
 			Remaining: cat.MonthlyBudget - spent,
-		})
+		}
+		if inProgress {
+			forecast := forecasts[cat.ID]
+			forecast.ProjectedRemaining = round2(cat.MonthlyBudget - forecast.ProjectedSpent)
+			summary.Forecast = &forecast
+			total.ProjectedSpent += forecast.ProjectedSpent
+			total.Recurring += forecast.Recurring
+		}
+		categorySummaries = append(categorySummaries, summary)
 
 		totalBudget += cat.MonthlyBudget
 		totalSpent += spent
 	}
 
-	summary := MonthlySummary{
-		Month:       monthStr,
+	result := MonthlySummary{
+		Month:       startOfMonth.Format("2006-01"),
 		TotalBudget: totalBudget,
 		TotalSpent:  totalSpent,
 		Categories:  categorySummaries,
 	}
-
-	c.JSON(http.StatusOK, summary)
-}
-
-func (h *Handlers) GetRecommendations(c *gin.Context) {
-	householdID := c.Param("household_id")
-
-	// Default to previous month
-	now := time.Now()
-	firstOfCurrentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
-	startOfPrevMonth := firstOfCurrentMonth.AddDate(0, -1, 0)
-	endOfPrevMonth := firstOfCurrentMonth
-
-	// Get all categories for this household
-	var categories []Category
-	if err := h.db.Where("household_id = ?", householdID).Find(&categories).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
-		return
-	}
-
-	type Suggestion struct {
-		CategoryID string  `json:"category_id"`
-		Category   string  `json:"category"`
-		Action     string  `json:"action"`
-		Amount     float64 `json:"amount"`
+	if inProgress {
+		total.ProjectedSpent = round2(total.ProjectedSpent)
+		total.Recurring = round2(total.Recurring)
+		total.ProjectedRemaining = round2(totalBudget - total.ProjectedSpent)
+		result.Forecast = &total
 	}
-
-	suggestions := []Suggestion{}
-
-	for _, cat := range categories {
-		if cat.MonthlyBudget == 0 {
-			continue
-		}
-
-		var spent float64
-		h.db.Model(&Transaction{}).
-			Where("category_id = ? AND date >= ? AND date < ?", cat.ID, startOfPrevMonth, endOfPrevMonth).
-			Select("COALESCE(SUM(amount), 0)").
-			Scan(&spent)
-
-		delta := (spent - cat.MonthlyBudget) / cat.MonthlyBudget
-		if delta > 0.1 || delta < -0.1 {
-			action := "increase"
-			if spent < cat.MonthlyBudget {
-				action = "decrease"
-			}
-
-			// Dynamic rounding: round based on the number's magnitude
-			// 10-99 → round to 10, 100-999 → round to 100, 1000-9999 → round to 1000
-			// Cap at 10,000 to avoid over-rounding very large numbers
-			roundingFactor := 10.0
-			if spent >= 100 {
-				magnitude := math.Floor(math.Log10(spent))
-				roundingFactor = math.Pow(10, magnitude)
-				// Cap at 10,000 for better granularity on large numbers
-				if roundingFactor > 10000 {
-					roundingFactor = 10000
-				}
-			}
-			roundedAmount := math.Round(spent/roundingFactor) * roundingFactor
-
-			suggestions = append(suggestions, Suggestion{
-				CategoryID: cat.ID,
-				Category:   string(cat.Name),
-				Action:     action,
-				Amount:     roundedAmount,
-			})
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+	return result, nil
 }
 
 // ============================================================================
@@ -800,9 +1075,55 @@ func (h *Handlers) HandleSync(c *gin.Context) {
 	})
 }
 
+// JWTMiddleware authorises requests to the household the token was issued
+// for, while the user is still one of its members.
 func (h *Handlers) JWTMiddleware() gin.HandlerFunc {
+	return h.authMiddleware(true)
+}
+
+// UserMiddleware authorises requests about the user themselves, whichever
+// household the token was issued for.
+func (h *Handlers) UserMiddleware() gin.HandlerFunc {
+	return h.authMiddleware(false)
+}
+
+// AccessLogger logs requests like gin's default logger, but with the
+// access tokens of event streams masked.
+func AccessLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			redactAccessToken(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
+
+// redactAccessToken masks the access_token query parameter of a request
+// path.
+func redactAccessToken(path string) string {
+	u, err := url.Parse(path)
+	if err != nil || !u.Query().Has("access_token") {
+		return path
+	}
+	query := u.Query()
+	query.Set("access_token", "REDACTED")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (h *Handlers) authMiddleware(household bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		// EventSource cannot set headers: event streams may pass the token
+		// in the query string instead
+		if authHeader == "" && c.GetHeader("Accept") == "text/event-stream" && c.Query("access_token") != "" {
+			authHeader = "Bearer " + c.Query("access_token")
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 			c.Abort()
@@ -835,6 +1156,7 @@ func (h *Handlers) JWTMiddleware() gin.HandlerFunc {
 			// Set context with test user details
 			c.Set("user_id", "test-user-id")
 			c.Set("household_id", householdID)
+			c.Set("role", RoleOwner)
 			c.Next()
 			return
 		}
@@ -861,9 +1183,21 @@ func (h *Handlers) JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if !household {
+			c.Set("user_id", userID)
+			c.Set("household_id", tokenHouseholdID)
+			c.Next()
+			return
+		}
+
 		// 2. Verify user still belongs to the household in the token
-		if user.HouseholdID != tokenHouseholdID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "User is no longer a member of this household"})
+		var membership Membership
+		if err := h.db.Where("user_id = ? AND household_id = ?", userID, tokenHouseholdID).First(&membership).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "User is no longer a member of this household"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
 			c.Abort()
 			return
 		}
@@ -878,6 +1212,7 @@ func (h *Handlers) JWTMiddleware() gin.HandlerFunc {
 
 		c.Set("user_id", userID)
 		c.Set("household_id", tokenHouseholdID)
+		c.Set("role", membership.Role)
 
 		c.Next()
 	}
@@ -891,6 +1226,8 @@ type GoogleLoginRequest struct {
 	IDToken     string `json:"id_token"`
 	AccessToken string `json:"access_token"`
 	InviteCode  string `json:"invite_code"`
+	// Locale is the app language, used for emails if the user has none yet
+	Locale string `json:"locale"`
 }
 
 type UserResponse struct {
@@ -958,23 +1295,35 @@ func (h *Handlers) AuthGoogle(c *gin.Context) {
 	if result.Error == gorm.ErrRecordNotFound {
 		// Really New User logic (Create Household, etc.)
 		householdID := ""
+		invitationID := ""
 
 		// Check if there is an invite code
 		if req.InviteCode != "" {
-			var invitation Invitation
-			if err := h.db.Where("code = ? AND status = ?", req.InviteCode, "pending").First(&invitation).Error; err == nil {
+			invitation, rerr := h.redeemableInvitation(h.db, req.InviteCode, email)
+			if rerr != nil {
+				rerr.respond(c)
+				return
+			}
+			if invitation != nil {
 				householdID = invitation.HouseholdID
+				invitationID = invitation.ID
 				// Mark invitation as accepted
-				invitation.Status = "accepted"
-				h.db.Save(&invitation)
+				invitation.Status = InvitationAccepted
+				h.db.Save(invitation)
 			}
 		}
 
+		locale := ""
+		if isSupportedLocale(req.Locale) {
+			locale = req.Locale
+		}
+
 		if householdID == "" {
 			// Create new household if no valid invite code
 			household := Household{
-				ID:   uuid.New().String(),
-				Name: SecretString(name + "'s Household"),
+				ID:     uuid.New().String(),
+				Name:   SecretString(name + "'s Household"),
+				Locale: locale,
 			}
 
 			if err := h.db.Create(&household).Error; err != nil {
@@ -989,28 +1338,45 @@ func (h *Handlers) AuthGoogle(c *gin.Context) {
 			ID:          uuid.New().String(),
 			Email:       SecretString(email),
 			Name:        SecretString(name),
+			GoogleName:  SecretString(name),
 			GoogleID:    googleID,
 			PictureURL:  pictureURL,
 			Color:       getRandomColor(),
 			HouseholdID: householdID,
+			Locale:      locale,
 		}
 
 		if err := h.db.Create(&user).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 			return
 		}
+
+		if invitationID != "" {
+			h.publishMemberJoined(householdID, user, invitationID)
+		}
 	} else if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	} else {
-		// User found (might be deleted)
+		// User found (might be deleted): signing in within the reactivation
+		// window brings the account back
 		if user.DeletedAt.Valid {
-			c.JSON(http.StatusForbidden, gin.H{"error": "User account has been deleted. Contact support to restore."})
-			return
+			if !time.Now().Before(h.reactivationDeadline(user.DeletedAt.Time)) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "This account was deleted"})
+				return
+			}
+			if err := h.reactivateUser(&user); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reactivate account"})
+				return
+			}
 		}
-		// Update user info if it changed
+		// Update user info if it changed. Names the user chose are kept.
 		needsUpdate := false
-		if string(user.Name) != name {
+		if string(user.GoogleName) != name {
+			user.GoogleName = SecretString(name)
+			needsUpdate = true
+		}
+		if !user.CustomName && string(user.Name) != name {
 			user.Name = SecretString(name)
 			needsUpdate = true
 		}
@@ -1022,31 +1388,40 @@ func (h *Handlers) AuthGoogle(c *gin.Context) {
 			user.Color = getRandomColor()
 			needsUpdate = true
 		}
+		if user.Locale == "" && isSupportedLocale(req.Locale) {
+			user.Locale = req.Locale
+			needsUpdate = true
+		}
 		if needsUpdate {
 			h.db.Save(&user)
 		}
-	}
-
-	// Generate JWT
-	token, err := h.generateJWT(user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
 
-	response := AuthResponse{
-		Token: token,
-		User: UserResponse{
-			ID:         user.ID,
-			Email:      string(user.Email),
-			Name:       string(user.Name),
-			PictureURL: user.PictureURL,
-			Color:      user.Color,
-		},
-		HouseholdID: user.HouseholdID,
+		// Existing users join the household they were invited to, on top
+		// of the ones they belong to
+		var invitation *Invitation
+		if req.InviteCode != "" {
+			var rerr *requestError
+			if invitation, rerr = h.redeemableInvitation(h.db, req.InviteCode, email); rerr != nil {
+				rerr.respond(c)
+				return
+			}
+		}
+		if invitation != nil {
+			joined, rerr := acceptInvitation(h.db, &user, *invitation)
+			if rerr != nil {
+				rerr.respond(c)
+				return
+			}
+			if joined {
+				h.publishMemberJoined(invitation.HouseholdID, user, invitation.ID)
+			}
+		} else if err := h.loginHousehold(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, response)
+	h.authResponse(c, user)
 }
 
 func (h *Handlers) generateJWT(user User) (string, error) {
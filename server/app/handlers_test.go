@@ -25,6 +25,7 @@ func setupTestDB(t *testing.T) (*gorm.DB, *config.Config) {
 	require.NoError(t, err)
 
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, db.Use(ChangeTracking{}))
 	if err := db.AutoMigrate(Entities...); err != nil {
 		panic(err)
 	}
@@ -381,6 +382,18 @@ func TestJWTMiddleware(t *testing.T) {
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 
+	// 4b. Event streams may pass the token in the query string, other
+	// requests may not
+	req, _ = http.NewRequest("GET", "/protected/hh1?access_token="+token, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req.Header.Set("Accept", "text/event-stream")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
 	// 5. User Soft-Deleted (Revoked Access)
 	db.Delete(&user) // Soft delete
 	req, _ = http.NewRequest("GET", "/protected/hh1", nil)
@@ -389,24 +402,42 @@ func TestJWTMiddleware(t *testing.T) {
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 
-	// 6. User Changed Household (DB says hh2, Token says hh1)
+	// 6. User Removed From Household (Token still says hh1)
 	// Restore user first
 	db.Unscoped().Model(&user).Update("deleted_at", nil) // Un-delete
-	db.Model(&user).Update("household_id", "hh2")        // Change household
+	db.Where("user_id = ? AND household_id = ?", user.ID, "hh1").Delete(&Membership{})
 
 	req, _ = http.NewRequest("GET", "/protected/hh1", nil)
-	req.Header.Set("Authorization", "Bearer "+token) // Token still has hh1
+	req.Header.Set("Authorization", "Bearer "+token)
 	w = httptest.NewRecorder()
-	r.ServeHTTP(w, req) // Matches token vs URL, but fails DB check
+	r.ServeHTTP(w, req) // Matches token vs URL, but fails membership check
 	assert.Equal(t, http.StatusForbidden, w.Code)
 }
 
+func TestAccessLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	defaultWriter := gin.DefaultWriter
+	gin.DefaultWriter = &logs
+	defer func() { gin.DefaultWriter = defaultWriter }()
+
+	r := gin.New()
+	r.Use(AccessLogger())
+	r.GET("/events", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events?access_token=secret-token&since=3", nil))
+
+	assert.NotContains(t, logs.String(), "secret-token")
+	assert.Contains(t, logs.String(), "access_token=REDACTED")
+	assert.Contains(t, logs.String(), "since=3")
+}
+
 func TestHouseholdAndInvitation(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	db, cfg := setupTestDB(t)
 	h := NewHandlers(db, cfg)
 
 	r := gin.Default()
+	r.Use(func(c *gin.Context) { c.Set("user_id", "u1") })
 	r.POST("/households", h.CreateHousehold)
 	r.POST("/households/:household_id/invitations", h.CreateInvitation)
 	r.GET("/households/:household_id/members", h.GetMembers)
@@ -419,6 +450,9 @@ func TestHouseholdAndInvitation(t *testing.T) {
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusCreated, w.Code)
+	roles, err := memberRoles(db, "hh-new")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"u1": RoleOwner}, roles)
 
 	// Create Invitation
 	invReq := struct{ Email string }{Email: "test@example.com"}
@@ -430,13 +464,14 @@ func TestHouseholdAndInvitation(t *testing.T) {
 
 	// Get Members
 	db.Create(&User{ID: "u1", Name: SecretString("User 1"), HouseholdID: "hh-new", Email: SecretString("u1@hh-new.com")})
+	db.Create(&User{ID: "u2", Name: SecretString("User 2"), HouseholdID: "hh-new", Email: SecretString("u2@hh-new.com")})
 	req, _ = http.NewRequest("GET", "/households/hh-new/members", nil)
 	w = httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	// Remove Member
-	req, _ = http.NewRequest("DELETE", "/households/hh-new/members/u1", nil)
+	// Remove Member (u1 is the owner, u2 a member)
+	req, _ = http.NewRequest("DELETE", "/households/hh-new/members/u2", nil)
 	w = httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -590,9 +625,9 @@ func TestAuthGoogle(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "hh-target", resp.HouseholdID)
 
-	// 4. Soft-deleted user
-	// 4. Soft-deleted user
-	db.Model(&User{}).Where("email_hash = ?", HashSensitive("test@gmail.com")).Update("deleted_at", gorm.DeletedAt{Time: time.Now(), Valid: true})
+	// 4. Soft-deleted user, past the reactivation window
+	deletedAt := time.Now().AddDate(0, 0, -cfg.AccountReactivationDays-1)
+	db.Model(&User{}).Where("email_hash = ?", HashSensitive("test@gmail.com")).Update("deleted_at", gorm.DeletedAt{Time: deletedAt, Valid: true})
 	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userInfo := GoogleUserInfo{ID: "google-id-123", Email: "test@gmail.com", Name: "Test User"}
 		_ = json.NewEncoder(w).Encode(userInfo)
@@ -0,0 +1,328 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const householdPurgeInterval = time.Hour
+
+// householdData are the soft-deletable rows of a household, deleted and
+// restored with it.
+var householdData = []any{
+	&Membership{},
+	&Invitation{},
+	&Account{},
+	&Category{},
+	&Transaction{},
+	&Webhook{},
+}
+
+// householdRecords are the other rows of a household, only removed when it
+// is purged.
+var householdRecords = []any{
+	&RecommendationDecision{},
+	&BudgetAlert{},
+	&DigestDelivery{},
+	&OutboxEmail{},
+	&WebhookDelivery{},
+	&IdempotencyKey{},
+}
+
+// HouseholdResponse is a household as seen by one of its members.
+type HouseholdResponse struct {
+	Household
+	Role    string `json:"role"`
+	Members int64  `json:"members"`
+}
+
+// DeletedHouseholdResponse tells until when a deleted household can be
+// restored.
+type DeletedHouseholdResponse struct {
+	ID      string    `json:"id"`
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// deleteHousehold soft deletes the household and its data within tx.
+// Everything is deleted at the same time, now, so that restoring it does
+// not bring back what was deleted before.
+func deleteHousehold(tx *gorm.DB, householdID string, now time.Time) error {
+	result := tx.Model(&Household{}).Where("id = ?", householdID).Update("deleted_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	for _, model := range householdData {
+		if err := tx.Model(model).Where("household_id = ?", householdID).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&OutboxEmail{}).
+		Where("household_id = ? AND status = ?", householdID, OutboxPending).
+		Update("status", OutboxCancelled).Error
+}
+
+// purgeAt returns when a household deleted at deletedAt is purged.
+func (h *Handlers) purgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(time.Duration(h.cfg.HouseholdPurgeDays) * 24 * time.Hour)
+}
+
+// GetHousehold returns the current household.
+func (h *Handlers) GetHousehold(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var household Household
+	if err := h.db.First(&household, "id = ?", householdID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found"})
+		return
+	}
+	var members int64
+	if err := h.db.Model(&User{}).Where("id IN (?)", memberIDs(h.db, householdID)).Count(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch household"})
+		return
+	}
+
+	c.JSON(http.StatusOK, HouseholdResponse{Household: household, Role: c.GetString("role"), Members: members})
+}
+
+// UpdateHousehold renames the household or changes its locale. Fields left
+// out are kept.
+func (h *Handlers) UpdateHousehold(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var req struct {
+		Name   *string `json:"name"`
+		Locale *string `json:"locale"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var household Household
+	if err := h.db.First(&household, "id = ?", householdID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found"})
+		return
+	}
+	if req.Name != nil {
+		if *req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
+			return
+		}
+		household.Name = SecretString(*req.Name)
+	}
+	if req.Locale != nil {
+		if *req.Locale != "" && !isSupportedLocale(*req.Locale) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale"})
+			return
+		}
+		household.Locale = *req.Locale
+	}
+
+	if err := h.db.Model(&household).Select("name", "locale").Updates(&household).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update household"})
+		return
+	}
+
+	h.publishEvent(householdID, EventHouseholdUpdated, household)
+	c.JSON(http.StatusOK, household)
+}
+
+// TransferOwnership makes another member an owner, and the current owner
+// an admin.
+func (h *Handlers) TransferOwnership(c *gin.Context) {
+	householdID := c.Param("household_id")
+	userID := c.GetString("user_id")
+
+	var req struct {
+		UserID string `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already own this household"})
+		return
+	}
+
+	var target User
+	if err := h.db.Where("id = ? AND id IN (?)", req.UserID, memberIDs(h.db, householdID)).First(&target).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	var owner User
+	if err := h.db.First(&owner, "id = ?", userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Membership{}).Where("user_id = ? AND household_id = ?", target.ID, householdID).Update("role", RoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Membership{}).Where("user_id = ? AND household_id = ?", owner.ID, householdID).Update("role", RoleAdmin).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+
+	h.publishEvent(householdID, EventMemberUpdated, activeMember(target, RoleOwner))
+	h.publishEvent(householdID, EventMemberUpdated, activeMember(owner, RoleAdmin))
+	c.JSON(http.StatusOK, activeMember(target, RoleOwner))
+}
+
+// DeleteHousehold deletes the household with all its data. Owners can
+// restore it until it is purged.
+func (h *Handlers) DeleteHousehold(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	// Queued before its webhooks are deleted along with it
+	event := newEvent(householdID, EventHouseholdDeleted, deletedResource{ID: householdID})
+	now := time.Now().UTC()
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		h.queueWebhooks(tx, event)
+		return deleteHousehold(tx, householdID, now)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete household"})
+		return
+	}
+
+	h.events.Publish(event)
+	c.JSON(http.StatusOK, DeletedHouseholdResponse{ID: householdID, PurgeAt: h.purgeAt(now)})
+}
+
+// LeaveHousehold removes the current user from one of their households.
+// The last owner has to transfer ownership or delete the household instead.
+func (h *Handlers) LeaveHousehold(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var membership Membership
+	if err := h.db.Where("user_id = ? AND household_id = ?", c.GetString("user_id"), householdID).First(&membership).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found"})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&membership).Error; err != nil {
+			return err
+		}
+		return ensureOwner(tx, householdID)
+	})
+	if errors.Is(err, errLastOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Transfer ownership or delete the household before leaving it"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave household"})
+		return
+	}
+
+	h.publishEvent(householdID, EventMemberRemoved, deletedResource{ID: membership.UserID})
+	c.Status(http.StatusNoContent)
+}
+
+// RestoreHousehold brings back a deleted household with its data, for one
+// of its owners, until it is purged.
+func (h *Handlers) RestoreHousehold(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var household Household
+	err := h.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", householdID).First(&household).Error
+	if err != nil || !time.Now().Before(h.purgeAt(household.DeletedAt.Time)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted household not found"})
+		return
+	}
+	deletedAt := household.DeletedAt.Time
+
+	var owners int64
+	h.db.Unscoped().Model(&Membership{}).
+		Where("user_id = ? AND household_id = ? AND role = ? AND deleted_at >= ?", c.GetString("user_id"), householdID, RoleOwner, deletedAt).
+		Count(&owners)
+	if owners == 0 {
+		requiresRole(RoleOwner).respond(c)
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&household).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		for _, model := range householdData {
+			if err := tx.Unscoped().Model(model).Where("household_id = ? AND deleted_at >= ?", householdID, deletedAt).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore household"})
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// purgeHouseholds removes the data of the households deleted before the
+// grace period and returns how many there were. These are hard deletes: no
+// one can sync a deleted household, so no tombstones are needed.
+func (h *Handlers) purgeHouseholds(now time.Time) int {
+	var due []string
+	cutoff := now.Add(-time.Duration(h.cfg.HouseholdPurgeDays) * 24 * time.Hour)
+	if err := h.db.Unscoped().Model(&Household{}).Where("deleted_at <= ?", cutoff).Pluck("id", &due).Error; err != nil {
+		log.Printf("Error finding households to purge: %v", err)
+		return 0
+	}
+
+	purged := 0
+	for _, householdID := range due {
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			for _, models := range [][]any{householdRecords, householdData} {
+				for _, model := range models {
+					if err := tx.Unscoped().Where("household_id = ?", householdID).Delete(model).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return tx.Unscoped().Where("id = ?", householdID).Delete(&Household{}).Error
+		})
+		if err != nil {
+			log.Printf("Error purging household %s: %v", householdID, err)
+			continue
+		}
+		purged++
+	}
+	return purged
+}
+
+// RunHouseholdPurge purges deleted households until ctx is cancelled.
+func (h *Handlers) RunHouseholdPurge(ctx context.Context) {
+	ticker := time.NewTicker(householdPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if n := h.purgeHouseholds(time.Now().UTC()); n > 0 {
+			log.Printf("Purged %d deleted households", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHouseholdManagement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	cfg.JWTSecret = "test_secret"
+	cfg.HouseholdPurgeDays = 30
+	h := NewHandlers(db, cfg)
+
+	r := gin.New()
+	me := r.Group("/me")
+	me.Use(h.UserMiddleware())
+	me.POST("/households/:household_id/leave", h.LeaveHousehold)
+	me.POST("/households/:household_id/restore", h.RestoreHousehold)
+	g := r.Group("/households/:household_id")
+	g.Use(h.JWTMiddleware(), h.PermissionMiddleware())
+	g.GET("", h.GetHousehold)
+	g.PATCH("", h.RequireRole(RoleAdmin), h.UpdateHousehold)
+	g.DELETE("", h.RequireRole(RoleOwner), h.DeleteHousehold)
+	g.POST("/transfer-ownership", h.RequireRole(RoleOwner), h.TransferOwnership)
+
+	householdID := "hh-manage"
+	db.Create(&Household{ID: householdID, Name: "Home", Locale: "es"})
+	tokens := map[string]string{}
+	for _, id := range []string{"ana", "bob", "cy"} {
+		user := User{ID: id, Name: SecretString(id), Email: SecretString(id + "@example.com"), HouseholdID: householdID}
+		require.NoError(t, db.Create(&user).Error)
+		token, err := h.generateJWT(user)
+		require.NoError(t, err)
+		tokens[id] = token
+	}
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: householdID})
+	db.Create(&Transaction{ID: "t1", CategoryID: "cat-1", Amount: 10, HouseholdID: householdID})
+	db.Create(&Transaction{ID: "t0", CategoryID: "cat-1", Amount: 3, HouseholdID: householdID})
+	db.Delete(&Transaction{}, "id = ?", "t0")
+
+	do := func(as, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tokens[as])
+		r.ServeHTTP(w, req)
+		return w
+	}
+	base := "/households/" + householdID
+
+	// Any member can read it
+	w := do("cy", "GET", base, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var household HouseholdResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &household))
+	assert.Equal(t, "Home", string(household.Name))
+	assert.Equal(t, RoleMember, household.Role)
+	assert.Equal(t, int64(3), household.Members)
+
+	// Only admins update it, keeping what is left out
+	assert.Equal(t, http.StatusForbidden, do("cy", "PATCH", base, `{"name": "Mine"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("ana", "PATCH", base, `{"locale": "xx"}`).Code)
+	w = do("ana", "PATCH", base, `{"name": "Casa"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var updated Household
+	require.NoError(t, db.First(&updated, "id = ?", householdID).Error)
+	assert.Equal(t, "Casa", string(updated.Name))
+	assert.Equal(t, "es", updated.Locale)
+
+	// Members leave on their own, but the last owner cannot
+	assert.Equal(t, http.StatusNoContent, do("cy", "POST", "/me/households/"+householdID+"/leave", "").Code)
+	assert.Equal(t, http.StatusForbidden, do("cy", "GET", base, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("cy", "POST", "/me/households/"+householdID+"/leave", "").Code)
+	assert.Equal(t, http.StatusConflict, do("ana", "POST", "/me/households/"+householdID+"/leave", "").Code)
+
+	// Transferring ownership swaps roles
+	assert.Equal(t, http.StatusForbidden, do("bob", "POST", base+"/transfer-ownership", `{"user_id": "bob"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do("ana", "POST", base+"/transfer-ownership", `{"user_id": "cy"}`).Code)
+	assert.Equal(t, http.StatusOK, do("ana", "POST", base+"/transfer-ownership", `{"user_id": "bob"}`).Code)
+	roles, err := memberRoles(db, householdID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ana": RoleAdmin, "bob": RoleOwner}, roles)
+
+	// Deleting it removes its data, which owners can restore
+	var received []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received = append(received, req.Header.Get("X-Keda-Event"))
+	}))
+	defer receiver.Close()
+	db.Create(&Webhook{ID: "wh-1", HouseholdID: householdID, URL: SecretString(receiver.URL), Secret: "s", Events: EventHouseholdDeleted, Active: true})
+	db.Create(&OutboxEmail{ID: "mail-1", HouseholdID: householdID, To: "cy@example.com", Status: OutboxPending})
+
+	assert.Equal(t, http.StatusForbidden, do("ana", "DELETE", base, "").Code)
+	w = do("bob", "DELETE", base, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var deleted DeletedHouseholdResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deleted))
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), deleted.PurgeAt, time.Minute)
+
+	// Its webhooks still hear about it, and its emails are not sent
+	assert.Equal(t, 1, h.deliverWebhooks(time.Now().UTC().Add(time.Second), receiver.Client()))
+	assert.Equal(t, []string{EventHouseholdDeleted}, received)
+	var mail OutboxEmail
+	require.NoError(t, db.First(&mail, "id = ?", "mail-1").Error)
+	assert.Equal(t, OutboxCancelled, mail.Status)
+
+	assert.Equal(t, http.StatusForbidden, do("bob", "GET", base, "").Code)
+	var live int64
+	db.Model(&Transaction{}).Where("household_id = ?", householdID).Count(&live)
+	assert.Zero(t, live)
+
+	assert.Equal(t, http.StatusForbidden, do("ana", "POST", "/me/households/"+householdID+"/restore", "").Code)
+	assert.Equal(t, http.StatusOK, do("bob", "POST", "/me/households/"+householdID+"/restore", "").Code)
+	assert.Equal(t, http.StatusOK, do("ana", "GET", base, "").Code)
+	assert.Equal(t, http.StatusForbidden, do("cy", "GET", base, "").Code)
+	var ids []string
+	db.Model(&Transaction{}).Where("household_id = ?", householdID).Pluck("id", &ids)
+	assert.Equal(t, []string{"t1"}, ids)
+
+	// After the grace period it is purged
+	require.Equal(t, http.StatusOK, do("bob", "DELETE", base, "").Code)
+	assert.Equal(t, 0, h.purgeHouseholds(time.Now().UTC()))
+	assert.Equal(t, 1, h.purgeHouseholds(time.Now().UTC().Add(31*24*time.Hour)))
+	assert.Equal(t, http.StatusNotFound, do("bob", "POST", "/me/households/"+householdID+"/restore", "").Code)
+
+	var remaining int64
+	db.Unscoped().Model(&Transaction{}).Where("household_id = ?", householdID).Count(&remaining)
+	assert.Zero(t, remaining)
+	db.Unscoped().Model(&Membership{}).Where("household_id = ?", householdID).Count(&remaining)
+	assert.Zero(t, remaining)
+	db.Unscoped().Model(&Household{}).Where("id = ?", householdID).Count(&remaining)
+	assert.Zero(t, remaining)
+}
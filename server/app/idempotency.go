@@ -0,0 +1,204 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// idempotencyRetention is how long responses are kept for replay.
+	idempotencyRetention = 24 * time.Hour
+	// idempotencyLockTimeout is after how long a request that never
+	// finished, e.g. because the server restarted, may be run again.
+	idempotencyLockTimeout = time.Minute
+	// maxIdempotentResponse is the largest response stored for replay.
+	// Larger ones, like backups, are produced again on retries.
+	maxIdempotentResponse = 1 << 20
+	maxIdempotencyKey     = 255
+	idempotencyCleanup    = time.Hour
+)
+
+// IdempotencyKey stores the response to a request made with an
+// Idempotency-Key header. Status is zero while the request is running.
+type IdempotencyKey struct {
+	ID          string    `gorm:"type:varchar(255);primaryKey"`
+	CreatedAt   time.Time `gorm:"index"`
+	HouseholdID string    `gorm:"type:varchar(255);uniqueIndex:idx_idempotency_user_key"`
+	UserID      string    `gorm:"type:varchar(255);uniqueIndex:idx_idempotency_user_key"`
+	Key         string    `gorm:"type:varchar(255);uniqueIndex:idx_idempotency_user_key"`
+	RequestHash string    `gorm:"type:varchar(64)"`
+	Status      int
+	ContentType string       `gorm:"type:varchar(255)"`
+	Body        SecretString `gorm:"type:text"`
+}
+
+// recordingWriter keeps a copy of the response for replay.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *recordingWriter) record(b []byte) {
+	if w.overflow || w.body.Len()+len(b) > maxIdempotentResponse {
+		w.overflow = true
+		return
+	}
+	w.body.Write(b)
+}
+
+// requestHash identifies a request by method, path and body, so that a key
+// reused for a different request is detected.
+func requestHash(method, path string, body []byte) string {
+	sum := sha256.New()
+	io.WriteString(sum, method+" "+path+"\n")
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// IdempotencyMiddleware makes mutating requests with an Idempotency-Key
+// header safe to retry. The first response is stored per household, user
+// and key and replayed to repeated requests for a day; reusing a key for a
+// different request is a conflict. Server errors are not stored, so the
+// request can be retried.
+func (h *Handlers) IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		householdID := c.Param("household_id")
+		hash := requestHash(c.Request.Method, c.Request.URL.Path, body)
+		record := IdempotencyKey{
+			ID:          uuid.New().String(),
+			HouseholdID: householdID,
+			UserID:      c.GetString("user_id"),
+			Key:         key,
+			RequestHash: hash,
+		}
+
+		claimed, existing, err := h.claimIdempotencyKey(&record)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		}
+		if !claimed {
+			switch {
+			case existing.RequestHash != hash:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case existing.Status == 0:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is in progress"})
+			default:
+				c.Header("Idempotency-Replayed", "true")
+				c.Data(existing.Status, existing.ContentType, []byte(existing.Body))
+				c.Abort()
+			}
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || writer.overflow {
+			h.db.Delete(&IdempotencyKey{}, "id = ?", record.ID)
+			return
+		}
+		if err := h.db.Model(&IdempotencyKey{}).Where("id = ?", record.ID).Updates(map[string]any{
+			"status":       status,
+			"content_type": writer.Header().Get("Content-Type"),
+			"body":         SecretString(writer.body.String()),
+		}).Error; err != nil {
+			log.Printf("Error storing response for idempotency key %s: %v", record.ID, err)
+		}
+	}
+}
+
+// claimIdempotencyKey stores record unless the key was already used, in
+// which case it returns the stored record. Expired and abandoned records
+// are replaced.
+func (h *Handlers) claimIdempotencyKey(record *IdempotencyKey) (bool, *IdempotencyKey, error) {
+	now := time.Now().UTC()
+	for attempt := 0; attempt < 2; attempt++ {
+		record.CreatedAt = now
+		result := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return false, nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return true, nil, nil
+		}
+
+		var existing IdempotencyKey
+		if err := h.db.Where("household_id = ? AND user_id = ? AND key = ?", record.HouseholdID, record.UserID, record.Key).First(&existing).Error; err != nil {
+			return false, nil, err
+		}
+		expired := existing.CreatedAt.Before(now.Add(-idempotencyRetention))
+		abandoned := existing.Status == 0 && existing.CreatedAt.Before(now.Add(-idempotencyLockTimeout))
+		if !expired && !abandoned {
+			return false, &existing, nil
+		}
+		// Of several concurrent retries, only one claims the key again
+		if err := h.db.Delete(&IdempotencyKey{}, "id = ?", existing.ID).Error; err != nil {
+			return false, nil, err
+		}
+	}
+	return false, nil, errIdempotencyContention
+}
+
+var errIdempotencyContention = errors.New("idempotency key is being reclaimed concurrently")
+
+// RunIdempotencyCleanup deletes expired idempotency keys until ctx is
+// cancelled.
+func (h *Handlers) RunIdempotencyCleanup(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyCleanup)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().UTC().Add(-idempotencyRetention)
+		if err := h.db.Where("created_at < ?", cutoff).Delete(&IdempotencyKey{}).Error; err != nil {
+			log.Printf("Error deleting expired idempotency keys: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
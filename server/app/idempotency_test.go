@@ -0,0 +1,90 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+
+	calls := 0
+	user := "u1"
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", user) })
+	g := r.Group("/households/:household_id", h.IdempotencyMiddleware())
+	g.POST("/things", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{"call": calls})
+	})
+	g.POST("/broken", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "boom"})
+	})
+
+	post := func(household, path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/households/"+household+path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without a key every request runs
+	post("hh-1", "/things", "", `{}`)
+	post("hh-1", "/things", "", `{}`)
+	assert.Equal(t, 2, calls)
+
+	// Retries replay the first response
+	first := post("hh-1", "/things", "k1", `{"amount":10}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+	retry := post("hh-1", "/things", "k1", `{"amount":10}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.JSONEq(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotency-Replayed"))
+	assert.Equal(t, 3, calls)
+
+	// Keys are per household and user
+	assert.Equal(t, http.StatusCreated, post("hh-2", "/things", "k1", `{"amount":10}`).Code)
+	assert.Equal(t, 4, calls)
+	user = "u2"
+	other := post("hh-1", "/things", "k1", `{"amount":10}`)
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.Empty(t, other.Header().Get("Idempotency-Replayed"))
+	assert.Equal(t, 5, calls)
+	user = "u1"
+
+	// Reusing a key for another request is a conflict
+	assert.Equal(t, http.StatusConflict, post("hh-1", "/things", "k1", `{"amount":20}`).Code)
+	assert.Equal(t, 5, calls)
+
+	// Server errors are not stored
+	assert.Equal(t, http.StatusInternalServerError, post("hh-1", "/broken", "k2", `{}`).Code)
+	assert.Equal(t, http.StatusInternalServerError, post("hh-1", "/broken", "k2", `{}`).Code)
+	assert.Equal(t, 7, calls)
+
+	// Requests still running are a conflict until they are abandoned
+	db.Create(&IdempotencyKey{ID: "running", HouseholdID: "hh-1", UserID: "u1", Key: "k3", RequestHash: requestHash("POST", "/households/hh-1/things", []byte(`{}`)), CreatedAt: time.Now().UTC()})
+	assert.Equal(t, http.StatusConflict, post("hh-1", "/things", "k3", `{}`).Code)
+	db.Model(&IdempotencyKey{}).Where("id = ?", "running").Update("created_at", time.Now().UTC().Add(-2*idempotencyLockTimeout))
+	assert.Equal(t, http.StatusCreated, post("hh-1", "/things", "k3", `{}`).Code)
+	assert.Equal(t, 8, calls)
+
+	// Expired keys can be used again
+	db.Model(&IdempotencyKey{}).Where("key = ?", "k1").Update("created_at", time.Now().UTC().Add(-2*idempotencyRetention))
+	assert.Equal(t, http.StatusCreated, post("hh-1", "/things", "k1", `{"amount":20}`).Code)
+	assert.Equal(t, 9, calls)
+
+	assert.Equal(t, http.StatusBadRequest, post("hh-1", "/things", strings.Repeat("k", maxIdempotencyKey+1), `{}`).Code)
+}
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	invitationExpiryInterval = time.Hour
+	// invitationResendInterval is how long to wait before sending an
+	// invitation again.
+	invitationResendInterval = time.Minute
+	// invitationCodeBytes is the randomness of invitation codes, enough
+	// that they cannot be guessed.
+	invitationCodeBytes = 16
+	// inviteAttemptLimit is how many unknown codes someone may try within
+	// inviteAttemptWindow before they are locked out until it ends.
+	inviteAttemptLimit  = 10
+	inviteAttemptWindow = 15 * time.Minute
+)
+
+// newInvitationCode returns a random invitation code.
+func newInvitationCode() (string, error) {
+	b := make([]byte, invitationCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// attemptLimiter counts failed attempts per key in fixed windows. It is kept
+// in memory, so each instance locks out on its own.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	attempts map[string]*attemptWindow
+}
+
+type attemptWindow struct {
+	start    time.Time
+	failures int
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{limit: limit, window: window, attempts: map[string]*attemptWindow{}}
+}
+
+// locked tells whether key used up its attempts in the current window.
+func (l *attemptLimiter) locked(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.attempts[key]
+	return ok && now.Before(w.start.Add(l.window)) && w.failures >= l.limit
+}
+
+// fail records a failed attempt of key.
+func (l *attemptLimiter) fail(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, w := range l.attempts {
+		if !now.Before(w.start.Add(l.window)) {
+			delete(l.attempts, k)
+		}
+	}
+	w, ok := l.attempts[key]
+	if !ok {
+		w = &attemptWindow{start: now}
+		l.attempts[key] = w
+	}
+	w.failures++
+}
+
+// invitationExpiry returns when an invitation sent at now expires, or nil
+// if invitations do not expire.
+func (h *Handlers) invitationExpiry(now time.Time) *time.Time {
+	if h.cfg.InvitationTTLHours <= 0 {
+		return nil
+	}
+	expiresAt := now.Add(time.Duration(h.cfg.InvitationTTLHours) * time.Hour)
+	return &expiresAt
+}
+
+// pendingInvitations scopes a query to invitations that can still be
+// accepted, including those the expiry job has not marked yet.
+func pendingInvitations(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? AND (expires_at IS NULL OR expires_at > ?)", InvitationPending, now)
+	}
+}
+
+// invitedEmailMatches tells whether email is the one the invitation was
+// sent to.
+func invitedEmailMatches(invitation Invitation, email string) bool {
+	return invitation.EmailHash == HashSensitive(email) || strings.EqualFold(strings.TrimSpace(string(invitation.Email)), strings.TrimSpace(email))
+}
+
+// expireInvitations marks the pending invitations past their expiry as
+// expired and returns how many there were.
+func (h *Handlers) expireInvitations(now time.Time) int {
+	var due []Invitation
+	if err := h.db.Where("status = ? AND expires_at <= ?", InvitationPending, now).Find(&due).Error; err != nil {
+		log.Printf("Error finding expired invitations: %v", err)
+		return 0
+	}
+
+	expired := 0
+	for _, invitation := range due {
+		result := h.db.Model(&Invitation{}).
+			Where("id = ? AND status = ?", invitation.ID, InvitationPending).
+			Update("status", InvitationExpired)
+		if result.Error != nil {
+			log.Printf("Error expiring invitation %s: %v", invitation.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 1 {
+			expired++
+			h.publishEvent(invitation.HouseholdID, EventMemberRemoved, deletedResource{ID: invitation.ID})
+		}
+	}
+	return expired
+}
+
+// RunInvitationExpiry expires stale invitations until ctx is cancelled.
+func (h *Handlers) RunInvitationExpiry(ctx context.Context) {
+	ticker := time.NewTicker(invitationExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		if n := h.expireInvitations(time.Now().UTC()); n > 0 {
+			log.Printf("Expired %d invitations", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ResendInvitation sends a pending or expired invitation again, with a new
+// expiry.
+func (h *Handlers) ResendInvitation(c *gin.Context) {
+	householdID := c.Param("household_id")
+	id := c.Param("id")
+
+	var invitation Invitation
+	if err := h.db.Where("id = ? AND household_id = ?", id, householdID).First(&invitation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+	if invitation.Status != InvitationPending && invitation.Status != InvitationExpired {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation was already " + invitation.Status})
+		return
+	}
+
+	now := time.Now().UTC()
+	if invitation.SentAt != nil && now.Sub(*invitation.SentAt) < invitationResendInterval {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Invitation was sent less than a minute ago"})
+		return
+	}
+	if invitation.Status == InvitationExpired {
+		var count int64
+		h.db.Model(&Invitation{}).Scopes(pendingInvitations(now)).
+			Where("household_id = ? AND email_hash = ?", householdID, invitation.EmailHash).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Invitation already pending for this email"})
+			return
+		}
+	}
+
+	wasExpired := invitation.Status == InvitationExpired
+	invitation.Status = InvitationPending
+	invitation.ExpiresAt = h.invitationExpiry(now)
+	invitation.SentAt = &now
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&invitation).Select("status", "expires_at", "sent_at").Updates(&invitation).Error; err != nil {
+			return err
+		}
+		return h.QueueInvitationEmail(tx, string(invitation.Email), invitation.Code, householdID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resend invitation"})
+		return
+	}
+
+	if wasExpired {
+		h.publishEvent(householdID, EventMemberInvited, MemberResponse{
+			ID:     invitation.ID,
+			Name:   "Invitado",
+			Email:  string(invitation.Email),
+			Status: "pending",
+		})
+	}
+	c.JSON(http.StatusOK, invitation)
+}
+
+// RevokeInvitation cancels a pending invitation, keeping it for the record.
+func (h *Handlers) RevokeInvitation(c *gin.Context) {
+	householdID := c.Param("household_id")
+	id := c.Param("id")
+
+	var invitation Invitation
+	if err := h.db.Where("id = ? AND household_id = ?", id, householdID).First(&invitation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+	if invitation.Status == InvitationAccepted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation was already accepted"})
+		return
+	}
+
+	result := h.db.Model(&Invitation{}).
+		Where("id = ? AND status IN ?", invitation.ID, []string{InvitationPending, InvitationExpired}).
+		Update("status", InvitationRevoked)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+	if result.RowsAffected > 0 && invitation.Status == InvitationPending {
+		h.publishEvent(householdID, EventMemberRemoved, deletedResource{ID: invitation.ID})
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpireInvitations(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	db.Create(&Invitation{ID: "stale", Code: "c1", Email: "a@example.com", HouseholdID: "hh-1", Status: InvitationPending, ExpiresAt: &past})
+	db.Create(&Invitation{ID: "fresh", Code: "c2", Email: "b@example.com", HouseholdID: "hh-1", Status: InvitationPending, ExpiresAt: &future})
+	db.Create(&Invitation{ID: "forever", Code: "c3", Email: "c@example.com", HouseholdID: "hh-1", Status: InvitationPending})
+
+	events, cancel := h.events.Subscribe("hh-1")
+	defer cancel()
+
+	assert.Equal(t, 1, h.expireInvitations(now))
+	assert.Equal(t, 0, h.expireInvitations(now))
+
+	status := func(id string) string {
+		var invitation Invitation
+		require.NoError(t, db.First(&invitation, "id = ?", id).Error)
+		return invitation.Status
+	}
+	assert.Equal(t, InvitationExpired, status("stale"))
+	assert.Equal(t, InvitationPending, status("fresh"))
+	assert.Equal(t, InvitationPending, status("forever"))
+
+	require.Len(t, events, 1)
+	e := <-events
+	assert.Equal(t, EventMemberRemoved, e.Type)
+	assert.Equal(t, deletedResource{ID: "stale"}, e.Data)
+}
+
+func TestInvitationLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	cfg.InvitationTTLHours = 24
+	h := NewHandlers(db, cfg)
+	r := gin.New()
+	r.POST("/households/:household_id/invites", h.CreateInvitation)
+	r.POST("/households/:household_id/invites/:id/resend", h.ResendInvitation)
+	r.POST("/households/:household_id/invites/:id/revoke", h.RevokeInvitation)
+	r.GET("/households/:household_id/members", h.GetMembers)
+
+	householdID := "hh-invites"
+	db.Create(&Household{ID: householdID, Name: "Home"})
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/households/"+householdID+path, strings.NewReader(body)))
+		return w
+	}
+	queued := func() int64 {
+		var count int64
+		db.Model(&OutboxEmail{}).Where("template = ?", "invitation").Count(&count)
+		return count
+	}
+
+	w := post("/invites", `{"email": "friend@example.com"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var invitation Invitation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &invitation))
+	require.NotNil(t, invitation.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), *invitation.ExpiresAt, time.Minute)
+	assert.Equal(t, int64(1), queued())
+
+	// Resending right away is throttled
+	assert.Equal(t, http.StatusTooManyRequests, post("/invites/"+invitation.ID+"/resend", "").Code)
+
+	// Once expired, it is no longer a member and can be sent again
+	past := time.Now().UTC().Add(-time.Hour)
+	db.Model(&Invitation{}).Where("id = ?", invitation.ID).Updates(map[string]any{"expires_at": past, "sent_at": past})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/households/"+householdID+"/members", nil))
+	assert.Equal(t, "null", w.Body.String())
+
+	h.expireInvitations(time.Now().UTC())
+	w = post("/invites/"+invitation.ID+"/resend", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &invitation))
+	assert.Equal(t, InvitationPending, invitation.Status)
+	assert.True(t, invitation.ExpiresAt.After(time.Now()))
+	assert.Equal(t, int64(2), queued())
+
+	// Revoking keeps the record but it cannot be sent again
+	assert.Equal(t, http.StatusNoContent, post("/invites/"+invitation.ID+"/revoke", "").Code)
+	var revoked Invitation
+	require.NoError(t, db.First(&revoked, "id = ?", invitation.ID).Error)
+	assert.Equal(t, InvitationRevoked, revoked.Status)
+	assert.Equal(t, http.StatusConflict, post("/invites/"+invitation.ID+"/resend", "").Code)
+	assert.Equal(t, http.StatusNotFound, post("/invites/missing/revoke", "").Code)
+}
+
+func TestAuthGoogle_InvitationChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	cfg.InvitationRequireEmailMatch = true
+	h := NewHandlers(db, cfg)
+
+	email := "invited@gmail.com"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(GoogleUserInfo{ID: "google-" + email, Email: email, Name: "Invited"})
+	}))
+	defer server.Close()
+	h.googleAPIURL = server.URL
+	r := gin.New()
+	r.POST("/auth/google", h.AuthGoogle)
+
+	login := func(code string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := `{"access_token": "fake", "invite_code": "` + code + `"}`
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/auth/google", strings.NewReader(body)))
+		return w
+	}
+
+	past := time.Now().UTC().Add(-time.Minute)
+	db.Create(&Invitation{ID: "expired", Code: "EXPIRED", Email: SecretString(email), HouseholdID: "hh-target", Status: InvitationPending, ExpiresAt: &past})
+	db.Create(&Invitation{ID: "revoked", Code: "REVOKED", Email: SecretString(email), HouseholdID: "hh-target", Status: InvitationRevoked})
+	db.Create(&Invitation{ID: "other", Code: "OTHER", Email: "someone@gmail.com", HouseholdID: "hh-target", Status: InvitationPending})
+	db.Create(&Invitation{ID: "mine", Code: "MINE", Email: "Invited@Gmail.com", HouseholdID: "hh-target", Status: InvitationPending})
+
+	assert.Equal(t, http.StatusGone, login("EXPIRED").Code)
+	assert.Equal(t, http.StatusGone, login("REVOKED").Code)
+	assert.Equal(t, http.StatusForbidden, login("OTHER").Code)
+
+	w := login("MINE")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "hh-target", resp.HouseholdID)
+}
+
+func TestMigrateInvitationExpiry(t *testing.T) {
+	db, _ := setupTestDB(t)
+	old := time.Now().UTC().Add(-30 * 24 * time.Hour)
+	db.Create(&Invitation{ID: "legacy", Code: "aaa111", HouseholdID: "hh-1", Status: InvitationPending, CreatedAt: old})
+	db.Create(&Invitation{ID: "used", Code: "bbb222", HouseholdID: "hh-1", Status: InvitationAccepted, CreatedAt: old})
+
+	require.NoError(t, MigrateInvitationExpiry(db, 0))
+	var legacy Invitation
+	require.NoError(t, db.First(&legacy, "id = ?", "legacy").Error)
+	assert.Nil(t, legacy.ExpiresAt)
+
+	require.NoError(t, MigrateInvitationExpiry(db, 168))
+	require.NoError(t, db.First(&legacy, "id = ?", "legacy").Error)
+	require.NotNil(t, legacy.ExpiresAt)
+	assert.WithinDuration(t, old.Add(168*time.Hour), *legacy.ExpiresAt, time.Second)
+	var used Invitation
+	require.NoError(t, db.First(&used, "id = ?", "used").Error)
+	assert.Nil(t, used.ExpiresAt)
+}
@@ -0,0 +1,365 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Journal formats supported by ExportJournal. "ledger" output is also valid
+// hledger input.
+const (
+	journalLedger    = "ledger"
+	journalBeancount = "beancount"
+)
+
+// journalAccount is an account in the double-entry journal, either backing
+// a Keda account (assets/liabilities) or a category (expenses).
+type journalAccount struct {
+	name   string
+	opened time.Time
+}
+
+type journalWriter struct {
+	format   string
+	currency string
+	w        *bufio.Writer
+}
+
+// JournalOptions controls the rendering of a household journal.
+type JournalOptions struct {
+	Format   string
+	Currency string
+	From     time.Time
+	To       time.Time // exclusive
+}
+
+// writeJournal renders a household's accounts, categories and transactions
+// as a plain-text double-entry journal. Output is fully determined by the
+// data: entries are sorted and account names are derived from stable
+// inputs, so repeated exports diff cleanly.
+func (h *Handlers) writeJournal(householdID string, opts JournalOptions, out io.Writer) error {
+	db := h.db
+
+	var household Household
+	if err := db.First(&household, "id = ?", householdID).Error; err != nil {
+		return err
+	}
+
+	// Deleted accounts and categories may still be referenced by transactions
+	var accounts []Account
+	if err := db.Unscoped().Where("household_id = ?", householdID).Order("id").Find(&accounts).Error; err != nil {
+		return err
+	}
+	for i := range accounts {
+		h.populateAccountDisplayName(&accounts[i])
+	}
+	var categories []Category
+	if err := db.Unscoped().Where("household_id = ?", householdID).Order("id").Find(&categories).Error; err != nil {
+		return err
+	}
+	var users []User
+	if err := db.Unscoped().Where("id IN (?)", db.Model(&Transaction{}).Select("user_id").Where("household_id = ?", householdID)).Find(&users).Error; err != nil {
+		return err
+	}
+	memberNames := make(map[string]string, len(users))
+	for _, u := range users {
+		memberNames[u.ID] = string(u.Name)
+	}
+
+	jw := &journalWriter{format: opts.Format, currency: opts.Currency, w: bufio.NewWriter(out)}
+
+	accountNames := jw.accountNames(accounts)
+	categoryNames := jw.categoryNames(categories)
+	uncategorized := jw.join("Expenses", "Uncategorized")
+	unknownAccount := jw.join("Assets", "Unknown")
+
+	query := db.Where("household_id = ?", householdID)
+	if !opts.From.IsZero() {
+		query = query.Where("date >= ?", opts.From)
+	}
+	if !opts.To.IsZero() {
+		query = query.Where("date < ?", opts.To)
+	}
+	var transactions []Transaction
+	if err := query.Order("date ASC, created_at ASC, id ASC").Find(&transactions).Error; err != nil {
+		return err
+	}
+
+	// Journal accounts are opened on the earliest date they are used, or
+	// when they were created in Keda if that is earlier.
+	used := map[string]*journalAccount{}
+	touch := func(name string, date time.Time) {
+		date = truncateDay(date)
+		if a, ok := used[name]; ok {
+			if date.Before(a.opened) {
+				a.opened = date
+			}
+			return
+		}
+		used[name] = &journalAccount{name: name, opened: date}
+	}
+	for _, a := range accounts {
+		if !a.DeletedAt.Valid {
+			touch(accountNames[a.ID], a.CreatedAt)
+		}
+	}
+	for _, cat := range categories {
+		if !cat.DeletedAt.Valid {
+			touch(categoryNames[cat.ID], cat.CreatedAt)
+		}
+	}
+	for _, t := range transactions {
+		if name, ok := accountNames[t.AccountID]; ok {
+			touch(name, t.Date)
+		} else {
+			touch(unknownAccount, t.Date)
+		}
+		if name, ok := categoryNames[t.CategoryID]; ok {
+			touch(name, t.Date)
+		} else {
+			touch(uncategorized, t.Date)
+		}
+	}
+
+	declared := make([]*journalAccount, 0, len(used))
+	for _, a := range used {
+		declared = append(declared, a)
+	}
+	sort.Slice(declared, func(i, j int) bool { return declared[i].name < declared[j].name })
+
+	jw.header(string(household.Name))
+	for _, a := range declared {
+		jw.open(a)
+	}
+
+	for _, t := range transactions {
+		account, ok := accountNames[t.AccountID]
+		if !ok {
+			account = unknownAccount
+		}
+		category, ok := categoryNames[t.CategoryID]
+		if !ok {
+			category = uncategorized
+		}
+		jw.transaction(t, memberNames[t.UserID], category, account)
+	}
+
+	return jw.w.Flush()
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// accountNames maps Keda accounts to asset (cash, bank) or liability (card)
+// journal accounts.
+func (jw *journalWriter) accountNames(accounts []Account) map[string]string {
+	names := make(map[string]string, len(accounts))
+	taken := map[string]bool{}
+	for _, a := range accounts {
+		var name string
+		switch a.Type {
+		case "cash":
+			name = jw.join("Assets", "Cash")
+		case "card":
+			name = jw.join("Liabilities", "Card", a.DisplayName)
+		case "bank":
+			name = jw.join("Assets", "Bank", a.DisplayName)
+		default:
+			name = jw.join("Assets", a.DisplayName)
+		}
+		names[a.ID] = jw.unique(name, a.ID, taken)
+	}
+	return names
+}
+
+// categoryNames maps categories to expense accounts.
+func (jw *journalWriter) categoryNames(categories []Category) map[string]string {
+	names := make(map[string]string, len(categories))
+	taken := map[string]bool{}
+	for _, cat := range categories {
+		names[cat.ID] = jw.unique(jw.join("Expenses", string(cat.Name)), cat.ID, taken)
+	}
+	return names
+}
+
+// unique disambiguates accounts whose names collide after sanitizing by
+// appending a prefix of their (stable) ID.
+func (jw *journalWriter) unique(name, id string, taken map[string]bool) string {
+	if taken[name] {
+		suffix := id
+		if len(suffix) > 8 {
+			suffix = suffix[:8]
+		}
+		if jw.format == journalBeancount {
+			name += "-" + jw.component(suffix)
+		} else {
+			name += " " + suffix
+		}
+	}
+	taken[name] = true
+	return name
+}
+
+func (jw *journalWriter) join(parts ...string) string {
+	components := make([]string, len(parts))
+	for i, p := range parts {
+		components[i] = jw.component(p)
+	}
+	return strings.Join(components, ":")
+}
+
+// component sanitizes a single segment of an account name.
+func (jw *journalWriter) component(s string) string {
+	if jw.format == journalBeancount {
+		// Beancount: must start with an uppercase letter or digit and may only
+		// contain letters, digits and dashes.
+		var b strings.Builder
+		dash := false
+		for _, r := range s {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				if dash && b.Len() > 0 {
+					b.WriteByte('-')
+				}
+				dash = false
+				b.WriteRune(r)
+			} else {
+				dash = true
+			}
+		}
+		out := []rune(b.String())
+		if len(out) == 0 {
+			return "Unnamed"
+		}
+		out[0] = unicode.ToUpper(out[0])
+		if !unicode.IsUpper(out[0]) && !unicode.IsDigit(out[0]) {
+			return "X" + string(out)
+		}
+		return string(out)
+	}
+
+	// Ledger: ":" separates components and two spaces end the account name.
+	s = strings.ReplaceAll(s, ":", "-")
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return "Unnamed"
+	}
+	return s
+}
+
+func (jw *journalWriter) amount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64) + " " + jw.currency
+}
+
+func (jw *journalWriter) header(title string) {
+	if jw.format == journalBeancount {
+		fmt.Fprintf(jw.w, "option \"title\" %s\n", strconv.Quote(title))
+		fmt.Fprintf(jw.w, "option \"operating_currency\" \"%s\"\n\n", jw.currency)
+		return
+	}
+	fmt.Fprintf(jw.w, "; %s\n", strings.Join(strings.Fields(title), " "))
+	fmt.Fprintf(jw.w, "commodity %s\n\n", jw.currency)
+}
+
+func (jw *journalWriter) open(a *journalAccount) {
+	if jw.format == journalBeancount {
+		fmt.Fprintf(jw.w, "%s open %s %s\n", a.opened.Format("2006-01-02"), a.name, jw.currency)
+		return
+	}
+	fmt.Fprintf(jw.w, "account %s\n", a.name)
+}
+
+func (jw *journalWriter) transaction(t Transaction, member, expense, source string) {
+	date := t.Date.UTC().Format("2006-01-02")
+	note := strings.Join(strings.Fields(string(t.Description)), " ")
+
+	fmt.Fprintln(jw.w)
+	if jw.format == journalBeancount {
+		fmt.Fprintf(jw.w, "%s * %s\n", date, strconv.Quote(note))
+		fmt.Fprintf(jw.w, "  keda_id: %s\n", strconv.Quote(t.ID))
+		if member != "" {
+			fmt.Fprintf(jw.w, "  member: %s\n", strconv.Quote(member))
+		}
+		fmt.Fprintf(jw.w, "  %-50s %15s\n", expense, jw.amount(t.Amount))
+		fmt.Fprintf(jw.w, "  %-50s %15s\n", source, jw.amount(-t.Amount))
+		return
+	}
+
+	fmt.Fprintf(jw.w, "%s * %s\n", date, note)
+	fmt.Fprintf(jw.w, "    ; keda_id: %s\n", t.ID)
+	if member != "" {
+		fmt.Fprintf(jw.w, "    ; member: %s\n", strings.Join(strings.Fields(member), " "))
+	}
+	fmt.Fprintf(jw.w, "    %-50s  %15s\n", expense, jw.amount(t.Amount))
+	fmt.Fprintf(jw.w, "    %-50s  %15s\n", source, jw.amount(-t.Amount))
+}
+
+// ExportJournal downloads the household as a ledger/hledger or beancount
+// journal. Without from/to the whole history is exported.
+func (h *Handlers) ExportJournal(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	opts := JournalOptions{
+		Format:   c.DefaultQuery("format", journalLedger),
+		Currency: strings.ToUpper(c.DefaultQuery("currency", "USD")),
+	}
+	if opts.Format != journalLedger && opts.Format != journalBeancount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Use ledger or beancount"})
+		return
+	}
+	if !isCommodity(opts.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency"})
+		return
+	}
+
+	if c.Query("from") != "" || c.Query("to") != "" {
+		start, end, err := parseDateRange(c, "2006-01-02", time.Time{}, time.Time{})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range. Use from/to as YYYY-MM-DD"})
+			return
+		}
+		opts.From, opts.To = start, end
+	}
+
+	var household Household
+	if err := h.db.First(&household, "id = ?", householdID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found"})
+		return
+	}
+
+	extension := "journal"
+	if opts.Format == journalBeancount {
+		extension = "beancount"
+	}
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="keda.%s"`, extension))
+	c.Status(http.StatusOK)
+
+	if err := h.writeJournal(householdID, opts, c.Writer); err != nil {
+		log.Printf("Error writing journal for household %s: %v", householdID, err)
+	}
+}
+
+// isCommodity accepts currency codes valid in both ledger and beancount.
+func isCommodity(s string) bool {
+	if len(s) < 2 || len(s) > 24 {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return s[0] >= 'A' && s[0] <= 'Z'
+}
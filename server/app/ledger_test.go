@@ -0,0 +1,113 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupJournalRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-journal"
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db.Create(&Household{ID: householdID, Name: "The Smiths"})
+	db.Create(&User{ID: "u1", Name: "Alice", HouseholdID: householdID, Email: "alice@example.com"})
+	db.Create(&Account{ID: "acc-cash", Type: "cash", Name: "Cash", HouseholdID: householdID, CreatedAt: created})
+	db.Create(&Account{ID: "acc-card", Type: "card", Brand: ptrSecret("Visa"), Bank: ptrSecret("ACME: Bank"), HouseholdID: householdID, CreatedAt: created})
+	db.Create(&Category{ID: "cat-1", Name: "Eating out", HouseholdID: householdID, CreatedAt: created})
+	db.Create(&Category{ID: "cat-2", Name: "eating-out", HouseholdID: householdID, CreatedAt: created})
+	db.Create(&Transaction{ID: "t2", HouseholdID: householdID, CategoryID: "cat-1", AccountID: "acc-card", UserID: "u1", Amount: 30, Date: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC), Description: `Dinner "Luigi's"`})
+	db.Create(&Transaction{ID: "t1", HouseholdID: householdID, CategoryID: "cat-2", AccountID: "acc-cash", UserID: "u1", Amount: 4.5, Date: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), Description: "Coffee"})
+
+	r := gin.Default()
+	r.GET("/households/:household_id/export/journal", h.ExportJournal)
+	return r
+}
+
+func TestExportJournal_Ledger(t *testing.T) {
+	r := setupJournalRouter(t)
+
+	req, _ := http.NewRequest("GET", "/households/hh-journal/export/journal?currency=eur", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	expected := `; The Smiths
+commodity EUR
+
+account Assets:Cash
+account Expenses:Eating out
+account Expenses:eating-out
+account Liabilities:Card:Visa - ACME- Bank
+
+2024-01-10 * Coffee
+    ; keda_id: t1
+    ; member: Alice
+    Expenses:eating-out                                        4.50 EUR
+    Assets:Cash                                               -4.50 EUR
+
+2024-01-12 * Dinner "Luigi's"
+    ; keda_id: t2
+    ; member: Alice
+    Expenses:Eating out                                       30.00 EUR
+    Liabilities:Card:Visa - ACME- Bank                       -30.00 EUR
+`
+	assert.Equal(t, expected, w.Body.String())
+
+	// Exporting again yields the same bytes
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, req)
+	assert.Equal(t, w.Body.String(), w2.Body.String())
+}
+
+func TestExportJournal_Beancount(t *testing.T) {
+	r := setupJournalRouter(t)
+
+	req, _ := http.NewRequest("GET", "/households/hh-journal/export/journal?format=beancount&from=2024-01-11&to=2024-01-31", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	expected := `option "title" "The Smiths"
+option "operating_currency" "USD"
+
+2024-01-01 open Assets:Cash USD
+2024-01-01 open Expenses:Eating-out USD
+2024-01-01 open Expenses:Eating-out-Cat-2 USD
+2024-01-01 open Liabilities:Card:Visa-ACME-Bank USD
+
+2024-01-12 * "Dinner \"Luigi's\""
+  keda_id: "t2"
+  member: "Alice"
+  Expenses:Eating-out                                      30.00 USD
+  Liabilities:Card:Visa-ACME-Bank                         -30.00 USD
+`
+	assert.Equal(t, expected, w.Body.String())
+}
+
+func TestExportJournal_Errors(t *testing.T) {
+	r := setupJournalRouter(t)
+
+	for _, url := range []string{
+		"/households/hh-journal/export/journal?format=qif",
+		"/households/hh-journal/export/journal?currency=$",
+		"/households/hh-journal/export/journal?from=bad",
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+
+	req, _ := http.NewRequest("GET", "/households/none/export/journal", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
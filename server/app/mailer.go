@@ -1,29 +1,58 @@
 package app
 
 import (
+	"bytes"
 	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/mail"
 	"net/smtp"
+	"net/textproto"
+	"time"
+
+	"gorm.io/gorm"
 )
 
-func (h *Handlers) SendInvitationEmail(to, code string) error {
+type invitationEmail struct {
+	Code   string
+	AppURL string
+}
+
+// QueueInvitationEmail enqueues the invitation email as part of tx.
+func (h *Handlers) QueueInvitationEmail(tx *gorm.DB, to, code, householdID string) error {
+	return h.enqueueEmail(tx, to, householdID, "invitation", invitationEmail{Code: code, AppURL: h.cfg.AppURL})
+}
+
+type budgetAlertEmail struct {
+	Category string
+	Alert    BudgetAlert
+	AppURL   string
+}
+
+func (h *Handlers) QueueBudgetAlertEmail(tx *gorm.DB, to string, alert BudgetAlert, categoryName string) error {
+	data := budgetAlertEmail{Category: categoryName, Alert: alert, AppURL: h.cfg.AppURL}
+	return h.enqueueEmail(tx, to, alert.HouseholdID, "budget_alert", data)
+}
+
+func (h *Handlers) QueueDigestEmail(tx *gorm.DB, to string, d *Digest) error {
+	return h.enqueueEmail(tx, to, d.HouseholdID, "digest", d)
+}
+
+// sendMail sends an email through the configured SMTP server. When html is
+// set, the message is multipart/alternative with body as the plain text
+// part.
+func (h *Handlers) sendMail(to, subject, body, html string) error {
 	host := h.cfg.SMTPHost
 	port := h.cfg.SMTPPort
 	user := h.cfg.SMTPUser
 	pass := h.cfg.SMTPPass
 	from := h.cfg.SMTPFrom
-	appURL := h.cfg.AppURL
-
-	subject := "Te han invitado a unirte a un hogar en Keda"
-	body := fmt.Sprintf("Hola!\n\nTe han invitado a compartir los gastos de un hogar en Keda.\n\nPara unirte, haz click en el siguiente enlace o usa el código de invitación al loguearte: %s\n\nLink: %s/invite?code=%s\n\n¡Te esperamos!", code, appURL, code)
 
-	toAddr := mail.Address{Address: to}
-	message := []byte(fmt.Sprintf("To: %s\r\n"+
-		"Subject: %s\r\n"+
-		"MIME-Version: 1.0\r\n"+
-		"Content-Type: text/plain; charset=\"utf-8\"\r\n"+
-		"\r\n"+
-		"%s\r\n", toAddr.String(), subject, body))
+	message, err := buildMessage(from, to, subject, body, html)
+	if err != nil {
+		return err
+	}
 
 	auth := smtp.PlainAuth("", user, pass, host)
 
@@ -32,10 +61,54 @@ func (h *Handlers) SendInvitationEmail(to, code string) error {
 	}
 
 	addr := fmt.Sprintf("%s:%s", host, port)
-	err := smtp.SendMail(addr, auth, from, []string{to}, message)
+	err = smtp.SendMail(addr, auth, from, []string{to}, message)
 	if err != nil {
 		return fmt.Errorf("failed to send email: %v", err)
 	}
 
 	return nil
 }
+
+// buildMessage formats an email with RFC 2047 encoded headers.
+func buildMessage(from, to, subject, body, html string) ([]byte, error) {
+	fromAddr := mail.Address{Name: "Keda", Address: from}
+	toAddr := mail.Address{Address: to}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", fromAddr.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", toAddr.String())
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if html == "" {
+		buf.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+		buf.WriteString(body + "\r\n")
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain", body},
+		{"text/html", html},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=\"utf-8\""},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,316 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// addMembership makes the user a member of the household, restoring a
+// membership they left. The first member of a household is its owner. It
+// reports whether they were not a member yet.
+func addMembership(db *gorm.DB, userID, householdID string) (bool, error) {
+	var membership Membership
+	err := db.Unscoped().Where("user_id = ? AND household_id = ?", userID, householdID).First(&membership).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	if err == nil && !membership.DeletedAt.Valid {
+		return false, nil
+	}
+
+	var members int64
+	if err := db.Model(&Membership{}).Where("household_id = ?", householdID).Count(&members).Error; err != nil {
+		return false, err
+	}
+	role := RoleMember
+	if members == 0 {
+		role = RoleOwner
+	}
+
+	if membership.ID == "" {
+		return true, db.Create(&Membership{ID: uuid.New().String(), UserID: userID, HouseholdID: householdID, Role: role}).Error
+	}
+	return true, db.Unscoped().Model(&membership).Updates(map[string]any{"deleted_at": nil, "role": role}).Error
+}
+
+// memberIDs is a subquery of the IDs of the household's members.
+func memberIDs(db *gorm.DB, householdID string) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Model(&Membership{}).Select("user_id").Where("household_id = ?", householdID)
+}
+
+// isMember tells whether the user exists and belongs to the household.
+func isMember(db *gorm.DB, userID, householdID string) (bool, error) {
+	var count int64
+	err := db.Model(&User{}).Where("id = ? AND id IN (?)", userID, memberIDs(db, householdID)).Count(&count).Error
+	return count > 0, err
+}
+
+// memberRoles maps the household's members to their roles.
+func memberRoles(db *gorm.DB, householdID string) (map[string]string, error) {
+	var memberships []Membership
+	if err := db.Where("household_id = ?", householdID).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	roles := make(map[string]string, len(memberships))
+	for _, m := range memberships {
+		roles[m.UserID] = m.Role
+	}
+	return roles, nil
+}
+
+// redeemableInvitation returns the invitation with the code if email may
+// accept it. Unknown and used codes return nil, as if no code was given.
+// Trying too many unknown codes locks the email out for a while.
+func (h *Handlers) redeemableInvitation(db *gorm.DB, code, email string) (*Invitation, *requestError) {
+	now := time.Now()
+	key := strings.ToLower(email)
+	if h.inviteAttempts.locked(key, now) {
+		return nil, &requestError{status: http.StatusTooManyRequests, message: "Too many invitation codes tried, try again later"}
+	}
+	var invitation Invitation
+	if err := db.Where("code = ?", code).First(&invitation).Error; err != nil {
+		h.inviteAttempts.fail(key, now)
+		return nil, nil
+	}
+	switch {
+	case invitation.Status == InvitationRevoked:
+		return nil, &requestError{status: http.StatusGone, message: "Invitation was revoked"}
+	case invitation.Status == InvitationExpired || (invitation.Status == InvitationPending && invitation.ExpiresAt != nil && !time.Now().Before(*invitation.ExpiresAt)):
+		return nil, &requestError{status: http.StatusGone, message: "Invitation has expired"}
+	case invitation.Status != InvitationPending:
+		return nil, nil
+	case h.cfg.InvitationRequireEmailMatch && !invitedEmailMatches(invitation, email):
+		return nil, &requestError{status: http.StatusForbidden, message: "Invitation was sent to a different email address"}
+	}
+	return &invitation, nil
+}
+
+// acceptInvitation makes an existing user a member of the invitation's
+// household and switches them to it. It reports whether they joined, as
+// opposed to being a member already.
+func acceptInvitation(db *gorm.DB, user *User, invitation Invitation) (bool, *requestError) {
+	joined := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Invitation{}).
+			Where("id = ? AND status = ?", invitation.ID, InvitationPending).
+			Update("status", InvitationAccepted)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStaleVersion
+		}
+		var err error
+		if joined, err = addMembership(tx, user.ID, invitation.HouseholdID); err != nil {
+			return err
+		}
+		return tx.Model(user).Update("household_id", invitation.HouseholdID).Error
+	})
+	if errors.Is(err, errStaleVersion) {
+		return false, &requestError{status: http.StatusConflict, message: "Invitation was already used"}
+	}
+	if err != nil {
+		return false, &requestError{status: http.StatusInternalServerError, message: "Failed to accept invitation"}
+	}
+	return joined, nil
+}
+
+// loginHousehold picks the household an existing user signs in to: the one
+// they last used if they are still a member, or else any other. Users who
+// were removed from all their households get a new one.
+func (h *Handlers) loginHousehold(user *User) error {
+	if user.HouseholdID != "" {
+		if member, err := isMember(h.db, user.ID, user.HouseholdID); err != nil || member {
+			return err
+		}
+	}
+
+	var membership Membership
+	err := h.db.Where("user_id = ?", user.ID).Order("created_at DESC").First(&membership).Error
+	if err == nil {
+		return h.db.Model(user).Update("household_id", membership.HouseholdID).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	household := Household{
+		ID:     uuid.New().String(),
+		Name:   SecretString(string(user.Name) + "'s Household"),
+		Locale: user.Locale,
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&household).Error; err != nil {
+			return err
+		}
+		if _, err := addMembership(tx, user.ID, household.ID); err != nil {
+			return err
+		}
+		return tx.Model(user).Update("household_id", household.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+	h.createDefaultCashAccount(household.ID)
+	return nil
+}
+
+// authResponse signs the user in to their current household.
+func (h *Handlers) authResponse(c *gin.Context, user User) {
+	token, err := h.generateJWT(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User: UserResponse{
+			ID:         user.ID,
+			Email:      string(user.Email),
+			Name:       string(user.Name),
+			PictureURL: user.PictureURL,
+			Color:      user.Color,
+		},
+		HouseholdID: user.HouseholdID,
+	})
+}
+
+// publishMemberJoined tells the household that the user joined it.
+func (h *Handlers) publishMemberJoined(householdID string, user User, invitationID string) {
+	var membership Membership
+	h.db.Where("user_id = ? AND household_id = ?", user.ID, householdID).First(&membership)
+	h.publishEvent(householdID, EventMemberJoined, memberJoined{
+		MemberResponse: activeMember(user, membership.Role),
+		InvitationID:   invitationID,
+	})
+}
+
+// activeMember describes a user who belongs to the household.
+func activeMember(user User, role string) MemberResponse {
+	return MemberResponse{
+		ID:         user.ID,
+		Name:       string(user.Name),
+		Email:      string(user.Email),
+		PictureURL: user.PictureURL,
+		Color:      user.Color,
+		Status:     "active",
+		Role:       role,
+	}
+}
+
+// ============================================================================
+// MY HOUSEHOLDS
+// ============================================================================
+
+type HouseholdMembership struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+	// Current is set for the household the request's token is for.
+	Current bool `json:"current"`
+}
+
+// GetMyHouseholds lists the households the current user belongs to.
+func (h *Handlers) GetMyHouseholds(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var memberships []Membership
+	if err := h.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch households"})
+		return
+	}
+
+	households := []HouseholdMembership{}
+	for _, m := range memberships {
+		var household Household
+		if err := h.db.First(&household, "id = ?", m.HouseholdID).Error; err != nil {
+			continue
+		}
+		households = append(households, HouseholdMembership{
+			ID:       household.ID,
+			Name:     string(household.Name),
+			Role:     m.Role,
+			JoinedAt: m.CreatedAt,
+			Current:  household.ID == c.GetString("household_id"),
+		})
+	}
+
+	c.JSON(http.StatusOK, households)
+}
+
+// SwitchHousehold signs the current user in to another of their
+// households. The new token only gives access to that household.
+func (h *Handlers) SwitchHousehold(c *gin.Context) {
+	var req struct {
+		HouseholdID string `json:"household_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user User
+	if err := h.db.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	member, err := isMember(h.db, user.ID, req.HouseholdID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !member {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this household"})
+		return
+	}
+
+	if err := h.db.Model(&user).Update("household_id", req.HouseholdID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch household"})
+		return
+	}
+	h.authResponse(c, user)
+}
+
+// AcceptInvitation lets the current user join another household with an
+// invitation code, and signs them in to it.
+func (h *Handlers) AcceptInvitation(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user User
+	if err := h.db.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	invitation, rerr := h.redeemableInvitation(h.db, req.Code, string(user.Email))
+	if rerr == nil && invitation == nil {
+		rerr = &requestError{status: http.StatusNotFound, message: "Invitation not found"}
+	}
+	if rerr != nil {
+		rerr.respond(c)
+		return
+	}
+
+	joined, rerr := acceptInvitation(h.db, &user, *invitation)
+	if rerr != nil {
+		rerr.respond(c)
+		return
+	}
+	if joined {
+		h.publishMemberJoined(invitation.HouseholdID, user, invitation.ID)
+	}
+	h.authResponse(c, user)
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemberships(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	cfg.JWTSecret = "test_secret"
+	h := NewHandlers(db, cfg)
+
+	email := "both@gmail.com"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(GoogleUserInfo{ID: "google-both", Email: email, Name: "Both"})
+	}))
+	defer server.Close()
+	h.googleAPIURL = server.URL
+
+	r := gin.New()
+	r.POST("/auth/google", h.AuthGoogle)
+	me := r.Group("/me")
+	me.Use(h.UserMiddleware())
+	me.GET("/households", h.GetMyHouseholds)
+	me.POST("/households/switch", h.SwitchHousehold)
+	me.POST("/invitations/accept", h.AcceptInvitation)
+	scoped := r.Group("/households/:household_id")
+	scoped.Use(h.JWTMiddleware())
+	scoped.GET("/members", h.GetMembers)
+	scoped.DELETE("/members/:user_id", h.RemoveMember)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	auth := func(w *httptest.ResponseRecorder) AuthResponse {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp AuthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// The first login creates a household
+	home := auth(do("POST", "/auth/google", "", `{"access_token": "fake"}`))
+	require.NotEmpty(t, home.HouseholdID)
+
+	db.Create(&Household{ID: "hh-a", Name: "A"})
+	db.Create(&Household{ID: "hh-b", Name: "B"})
+	db.Create(&User{ID: "owner-a", Name: "Owner A", HouseholdID: "hh-a"})
+	db.Create(&Invitation{ID: "inv-a", Code: "JOIN-A", Email: SecretString(email), HouseholdID: "hh-a", Status: InvitationPending})
+	db.Create(&Invitation{ID: "inv-b", Code: "JOIN-B", Email: SecretString(email), HouseholdID: "hh-b", Status: InvitationPending})
+
+	// An existing user joins another household when logging in with a code
+	resp := auth(do("POST", "/auth/google", "", `{"access_token": "fake", "invite_code": "JOIN-A"}`))
+	assert.Equal(t, "hh-a", resp.HouseholdID)
+	assert.Equal(t, home.User.ID, resp.User.ID)
+
+	// ...or through the endpoint, without logging in again
+	resp = auth(do("POST", "/me/invitations/accept", resp.Token, `{"code": "JOIN-B"}`))
+	assert.Equal(t, "hh-b", resp.HouseholdID)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/me/invitations/accept", resp.Token, `{"code": "JOIN-B"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/me/invitations/accept", resp.Token, `{"code": "NOPE"}`).Code)
+
+	w := do("GET", "/me/households", resp.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var households []HouseholdMembership
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &households))
+	require.Len(t, households, 3)
+	assert.Equal(t, home.HouseholdID, households[0].ID)
+	assert.Equal(t, "hh-b", households[2].ID)
+	assert.True(t, households[2].Current)
+
+	// Tokens are per household, and switching gives a new one
+	tokenB := resp.Token
+	assert.Equal(t, http.StatusForbidden, do("GET", "/households/hh-a/members", tokenB, "").Code)
+	tokenA := auth(do("POST", "/me/households/switch", tokenB, `{"household_id": "hh-a"}`)).Token
+	assert.Equal(t, http.StatusOK, do("GET", "/households/hh-a/members", tokenA, "").Code)
+	assert.Equal(t, http.StatusOK, do("GET", "/households/hh-b/members", tokenB, "").Code)
+	assert.Equal(t, http.StatusForbidden, do("POST", "/me/households/switch", tokenA, `{"household_id": "hh-other"}`).Code)
+
+	// Being removed from one household keeps the others
+	assert.Equal(t, http.StatusOK, do("DELETE", "/households/hh-a/members/"+home.User.ID, tokenA, "").Code)
+	assert.Equal(t, http.StatusForbidden, do("GET", "/households/hh-a/members", tokenA, "").Code)
+	assert.Equal(t, http.StatusOK, do("GET", "/households/hh-b/members", tokenB, "").Code)
+	assert.Equal(t, http.StatusOK, do("GET", "/me/households", tokenA, "").Code)
+
+	// Logging in falls back to a household they still belong to
+	resp = auth(do("POST", "/auth/google", "", `{"access_token": "fake"}`))
+	assert.Equal(t, "hh-b", resp.HouseholdID)
+
+	// Once removed from all of them, they get a new one
+	db.Where("user_id = ?", home.User.ID).Delete(&Membership{})
+	resp = auth(do("POST", "/auth/google", "", `{"access_token": "fake"}`))
+	assert.NotContains(t, []string{home.HouseholdID, "hh-a", "hh-b"}, resp.HouseholdID)
+	member, err := isMember(db, home.User.ID, resp.HouseholdID)
+	require.NoError(t, err)
+	assert.True(t, member)
+}
+
+func TestAcceptInvitationLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	cfg.JWTSecret = "test_secret"
+	h := NewHandlers(db, cfg)
+
+	email := "guesser@gmail.com"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(GoogleUserInfo{ID: "google-guesser", Email: email, Name: "Guesser"})
+	}))
+	defer server.Close()
+	h.googleAPIURL = server.URL
+
+	r := gin.New()
+	r.POST("/auth/google", h.AuthGoogle)
+	me := r.Group("/me")
+	me.Use(h.UserMiddleware())
+	me.POST("/invitations/accept", h.AcceptInvitation)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/auth/google", "", `{"access_token": "fake"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	db.Create(&Household{ID: "hh-a", Name: "A"})
+	db.Create(&Invitation{ID: "inv-a", Code: "JOIN-A", Email: SecretString(email), HouseholdID: "hh-a", Status: InvitationPending})
+
+	for i := 0; i < inviteAttemptLimit; i++ {
+		assert.Equal(t, http.StatusNotFound, do("POST", "/me/invitations/accept", resp.Token, `{"code": "NOPE"}`).Code)
+	}
+	// Once locked out, even the right code is refused
+	assert.Equal(t, http.StatusTooManyRequests, do("POST", "/me/invitations/accept", resp.Token, `{"code": "JOIN-A"}`).Code)
+
+	// The lock ends with the window
+	h.inviteAttempts.attempts[email].start = time.Now().Add(-inviteAttemptWindow)
+	assert.Equal(t, http.StatusOK, do("POST", "/me/invitations/accept", resp.Token, `{"code": "JOIN-A"}`).Code)
+}
+
+func TestMigrateMemberships(t *testing.T) {
+	db, _ := setupTestDB(t)
+	db.Create(&User{ID: "legacy", Name: "Legacy", HouseholdID: "hh-1"})
+	db.Exec("DELETE FROM memberships WHERE user_id = ?", "legacy")
+
+	require.NoError(t, MigrateMemberships(db))
+	require.NoError(t, MigrateMemberships(db))
+
+	var memberships []Membership
+	db.Where("user_id = ? AND household_id = ?", "legacy", "hh-1").Find(&memberships)
+	require.Len(t, memberships, 1)
+	assert.Equal(t, RoleMember, memberships[0].Role)
+}
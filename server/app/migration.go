@@ -1,18 +1,25 @@
 package app
 
 import (
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // MigrateToEncryption handles encrypting existing plain-text data in the database.
+// Rows already encrypted are left alone, and rewriting the others does not
+// change what clients see, so they keep their change sequence.
 func MigrateToEncryption(db *gorm.DB) error {
 	log.Println("🔍 Checking for data migration to encryption...")
+	db = withoutChangeSeq(db)
 
 	// 1. Household names
 	var households []Household
-	db.Find(&households)
+	db.Scopes(plaintext("name")).Find(&households)
 	for _, h := range households {
 		// Just saving will trigger the Value() method of SecretString
 		// We use Select to only update the encrypted fields and UpdatedAt
@@ -23,7 +30,7 @@ func MigrateToEncryption(db *gorm.DB) error {
 
 	// 2. User data
 	var users []User
-	db.Find(&users)
+	db.Scopes(plaintext("email", "name")).Find(&users)
 	for _, u := range users {
 		if err := db.Select("Email", "EmailHash", "Name", "UpdatedAt").Save(&u).Error; err != nil {
 			return err
@@ -32,7 +39,7 @@ func MigrateToEncryption(db *gorm.DB) error {
 
 	// 3. Accounts
 	var accounts []Account
-	db.Find(&accounts)
+	db.Scopes(plaintext("name", "brand", "bank")).Find(&accounts)
 	for _, a := range accounts {
 		if err := db.Select("Name", "Brand", "Bank", "UpdatedAt").Save(&a).Error; err != nil {
 			return err
@@ -41,7 +48,7 @@ func MigrateToEncryption(db *gorm.DB) error {
 
 	// 4. Categories
 	var categories []Category
-	db.Find(&categories)
+	db.Scopes(plaintext("name")).Find(&categories)
 	for _, c := range categories {
 		if err := db.Select("Name", "UpdatedAt").Save(&c).Error; err != nil {
 			return err
@@ -50,7 +57,7 @@ func MigrateToEncryption(db *gorm.DB) error {
 
 	// 5. Transactions
 	var transactions []Transaction
-	db.Find(&transactions)
+	db.Scopes(plaintext("description")).Find(&transactions)
 	for _, t := range transactions {
 		if err := db.Select("Description", "DescriptionHash", "UpdatedAt").Save(&t).Error; err != nil {
 			return err
@@ -59,7 +66,7 @@ func MigrateToEncryption(db *gorm.DB) error {
 
 	// 6. Invitations
 	var invitations []Invitation
-	db.Find(&invitations)
+	db.Scopes(plaintext("email")).Find(&invitations)
 	for _, i := range invitations {
 		if err := db.Select("Email", "EmailHash", "UpdatedAt").Save(&i).Error; err != nil {
 			return err
@@ -69,3 +76,133 @@ func MigrateToEncryption(db *gorm.DB) error {
 	log.Println("✅ Encryption migration check completed")
 	return nil
 }
+
+// plaintext scopes a query to the rows with any of the columns not
+// encrypted yet.
+func plaintext(columns ...string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		conditions := make([]string, len(columns))
+		for i, column := range columns {
+			conditions[i] = fmt.Sprintf("(%s <> '' AND %s NOT LIKE '%s%%')", column, column, encryptionPrefix)
+		}
+		return db.Where(strings.Join(conditions, " OR "))
+	}
+}
+
+// MigrateMemberships makes users members of the household they belonged to
+// before users could belong to several. MigrateOwners picks the owners
+// afterwards.
+func MigrateMemberships(db *gorm.DB) error {
+	var users []User
+	err := db.Where("household_id <> '' AND id NOT IN (?)", db.Unscoped().Model(&Membership{}).Select("user_id")).
+		Order("created_at ASC").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		membership := Membership{ID: uuid.New().String(), UserID: u.ID, HouseholdID: u.HouseholdID, Role: RoleMember}
+		if err := db.Create(&membership).Error; err != nil {
+			return err
+		}
+	}
+	if len(users) > 0 {
+		log.Printf("✅ Added memberships for %d users", len(users))
+	}
+	return nil
+}
+
+// MigrateOwners makes the member of each household without an owner who
+// signed up first its owner, as households had no roles before.
+func MigrateOwners(db *gorm.DB) error {
+	var householdIDs []string
+	err := db.Model(&Membership{}).Distinct("household_id").
+		Where("household_id NOT IN (?)", db.Model(&Membership{}).Select("household_id").Where("role = ?", RoleOwner)).
+		Pluck("household_id", &householdIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, householdID := range householdIDs {
+		var first Membership
+		err := db.Joins("JOIN users ON users.id = memberships.user_id").
+			Where("memberships.household_id = ?", householdID).
+			Order("users.created_at ASC").
+			First(&first).Error
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&first).Update("role", RoleOwner).Error; err != nil {
+			return err
+		}
+	}
+	if len(householdIDs) > 0 {
+		log.Printf("✅ Assigned owners to %d households", len(householdIDs))
+	}
+	return nil
+}
+
+// MigrateInvitationExpiry gives the pending invitations sent before they
+// could expire the expiry they would have had, so that they do not stay
+// open forever. Nothing changes when invitations do not expire.
+func MigrateInvitationExpiry(db *gorm.DB, ttlHours int) error {
+	if ttlHours <= 0 {
+		return nil
+	}
+	var invitations []Invitation
+	if err := db.Where("status = ? AND expires_at IS NULL", InvitationPending).Find(&invitations).Error; err != nil {
+		return err
+	}
+	for _, i := range invitations {
+		expiresAt := i.CreatedAt.Add(time.Duration(ttlHours) * time.Hour)
+		if err := db.Model(&i).Update("expires_at", expiresAt).Error; err != nil {
+			return err
+		}
+	}
+	if len(invitations) > 0 {
+		log.Printf("✅ Set the expiry of %d invitations", len(invitations))
+	}
+	return nil
+}
+
+// MigrateIdempotencyKeys drops the index that made idempotency keys unique
+// per household only, now that they are unique per user too.
+func MigrateIdempotencyKeys(db *gorm.DB) error {
+	if !db.Migrator().HasIndex(&IdempotencyKey{}, "idx_idempotency_key") {
+		return nil
+	}
+	return db.Migrator().DropIndex(&IdempotencyKey{}, "idx_idempotency_key")
+}
+
+// MigrateChangeCounters replaces the single change counter with one per
+// household. It runs before AutoMigrate. Every household continues from the
+// last sequence handed out, so the cursors clients hold stay valid.
+func MigrateChangeCounters(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&ChangeCounter{}) || db.Migrator().HasColumn(&ChangeCounter{}, "household_id") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var last int64
+		if err := tx.Raw("SELECT COALESCE(MAX(value), 0) FROM change_counters").Scan(&last).Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropTable(&ChangeCounter{}); err != nil {
+			return err
+		}
+		if err := tx.Migrator().CreateTable(&ChangeCounter{}); err != nil {
+			return err
+		}
+		var households []string
+		if err := tx.Unscoped().Model(&Household{}).Pluck("id", &households).Error; err != nil {
+			return err
+		}
+		counters := []ChangeCounter{{Value: last}}
+		for _, id := range households {
+			counters = append(counters, ChangeCounter{HouseholdID: id, Value: last})
+		}
+		if err := tx.CreateInBatches(counters, 500).Error; err != nil {
+			return err
+		}
+		log.Printf("✅ Split the change counter into %d household counters", len(households))
+		return nil
+	})
+}
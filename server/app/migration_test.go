@@ -69,3 +69,41 @@ func TestMigrateToEncryptionWithFakes(t *testing.T) {
 	assert.Equal(t, "Initial Note", string(migratedTx.Description))
 	assert.NotEmpty(t, migratedTx.DescriptionHash)
 }
+
+func TestMigrateToEncryptionKeepsChangeSeq(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	db.Create(&Household{ID: "hh-enc", Name: "Home"})
+	db.Create(&Category{ID: "cat-enc", HouseholdID: "hh-enc", Name: "Food"})
+	db.Exec("INSERT INTO categories (id, created_at, updated_at, household_id, name, change_seq) VALUES (?, ?, ?, ?, ?, ?)",
+		"cat-plain", time.Now(), time.Now(), "hh-enc", "Rent", 1)
+
+	seqs := func() map[string]int64 {
+		var categories []Category
+		db.Find(&categories)
+		result := map[string]int64{}
+		for _, c := range categories {
+			result[c.ID] = c.ChangeSeq
+		}
+		return result
+	}
+	before := seqs()
+	counter, err := currentChangeSeq(db, "hh-enc")
+	require.NoError(t, err)
+
+	// Only the plain text row is rewritten, and no row gets a new version
+	for i := 0; i < 2; i++ {
+		require.NoError(t, MigrateToEncryption(db))
+		assert.Equal(t, before, seqs())
+		after, err := currentChangeSeq(db, "hh-enc")
+		require.NoError(t, err)
+		assert.Equal(t, counter, after)
+	}
+
+	var raw string
+	db.Raw("SELECT name FROM categories WHERE id = ?", "cat-plain").Scan(&raw)
+	assert.Contains(t, raw, encryptionPrefix)
+	var category Category
+	require.NoError(t, db.First(&category, "id = ?", "cat-plain").Error)
+	assert.Equal(t, "Rent", string(category.Name))
+}
@@ -0,0 +1,531 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxOFXSize caps the size of an uploaded statement.
+const maxOFXSize = 10 << 20 // 10 MB
+
+// ofxAggregates lists the aggregates whose leaf elements are extracted.
+var ofxAggregates = map[string]bool{
+	"STMTRS":       true,
+	"CCSTMTRS":     true,
+	"BANKACCTFROM": true,
+	"CCACCTFROM":   true,
+	"BANKTRANLIST": true,
+	"STMTTRN":      true,
+	"LEDGERBAL":    true,
+	"AVAILBAL":     true,
+}
+
+// OFXTransaction is a single STMTTRN entry from an OFX/QFX statement.
+type OFXTransaction struct {
+	FITID    string
+	Type     string
+	Posted   time.Time
+	Amount   float64
+	Name     string
+	Memo     string
+	CheckNum string
+}
+
+// OFXBalance is the LEDGERBAL aggregate of a statement.
+type OFXBalance struct {
+	Amount float64
+	AsOf   time.Time
+}
+
+// OFXStatement holds the parts of an OFX/QFX statement relevant to Keda.
+type OFXStatement struct {
+	AccountID     string
+	Currency      string
+	Start         time.Time
+	End           time.Time
+	Transactions  []OFXTransaction
+	LedgerBalance *OFXBalance
+}
+
+// ParseOFX parses both SGML (OFX 1.x, unclosed leaf elements) and XML
+// (OFX 2.x) statements. Bank and credit card statements are supported.
+func ParseOFX(r io.Reader) (*OFXStatement, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data := strings.ToValidUTF8(string(raw), "")
+
+	start := strings.Index(strings.ToUpper(data), "<OFX>")
+	if start < 0 {
+		return nil, fmt.Errorf("not an OFX document: missing <OFX> element")
+	}
+	data = data[start:]
+
+	stmt := &OFXStatement{}
+	var path []string
+	var current *OFXTransaction
+	var balance *OFXBalance
+
+	for len(data) > 0 {
+		open := strings.IndexByte(data, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(data[open:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("malformed OFX: unterminated tag")
+		}
+		tag := strings.ToUpper(strings.TrimSpace(data[open+1 : open+end]))
+		data = data[open+end+1:]
+
+		// Skip processing instructions and comments
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+
+		if strings.HasPrefix(tag, "/") {
+			name := tag[1:]
+			// Pop up to and including the matching aggregate. Closing tags of
+			// SGML leaf elements never made it onto the stack, so are ignored.
+			for i := len(path) - 1; i >= 0; i-- {
+				if path[i] == name {
+					path = path[:i]
+					break
+				}
+			}
+			switch name {
+			case "STMTTRN":
+				if current != nil {
+					stmt.Transactions = append(stmt.Transactions, *current)
+					current = nil
+				}
+			case "LEDGERBAL":
+				if balance != nil {
+					stmt.LedgerBalance = balance
+					balance = nil
+				}
+			}
+			continue
+		}
+
+		// Self-closing XML elements carry no value
+		if strings.HasSuffix(tag, "/") {
+			continue
+		}
+		if i := strings.IndexAny(tag, " \t\r\n"); i >= 0 {
+			tag = tag[:i]
+		}
+
+		next := strings.IndexByte(data, '<')
+		if next < 0 {
+			next = len(data)
+		}
+		value := strings.TrimSpace(html.UnescapeString(data[:next]))
+
+		if value == "" {
+			// Aggregate element
+			path = append(path, tag)
+			switch tag {
+			case "STMTTRN":
+				current = &OFXTransaction{}
+			case "LEDGERBAL":
+				balance = &OFXBalance{}
+			}
+			continue
+		}
+
+		if err := stmt.setField(path, tag, value, current, balance); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(stmt.Transactions) == 0 && stmt.LedgerBalance == nil {
+		return nil, fmt.Errorf("no statement transactions found")
+	}
+
+	return stmt, nil
+}
+
+func (s *OFXStatement) setField(path []string, tag, value string, trn *OFXTransaction, bal *OFXBalance) error {
+	// Use the innermost aggregate we know about. Empty SGML leaf elements
+	// look like aggregates that are never closed, so the top of the stack
+	// cannot be trusted.
+	parent := ""
+	for i := len(path) - 1; i >= 0; i-- {
+		if ofxAggregates[path[i]] {
+			parent = path[i]
+			break
+		}
+	}
+
+	switch parent {
+	case "STMTTRN":
+		if trn == nil {
+			return nil
+		}
+		switch tag {
+		case "FITID":
+			trn.FITID = value
+		case "TRNTYPE":
+			trn.Type = value
+		case "DTPOSTED":
+			t, err := parseOFXDate(value)
+			if err != nil {
+				return err
+			}
+			trn.Posted = t
+		case "TRNAMT":
+			amount, err := parseOFXAmount(value)
+			if err != nil {
+				return err
+			}
+			trn.Amount = amount
+		case "NAME":
+			trn.Name = value
+		case "MEMO":
+			trn.Memo = value
+		case "CHECKNUM":
+			trn.CheckNum = value
+		}
+	case "LEDGERBAL":
+		if bal == nil {
+			return nil
+		}
+		switch tag {
+		case "BALAMT":
+			amount, err := parseOFXAmount(value)
+			if err != nil {
+				return err
+			}
+			bal.Amount = amount
+		case "DTASOF":
+			t, err := parseOFXDate(value)
+			if err != nil {
+				return err
+			}
+			bal.AsOf = t
+		}
+	case "BANKACCTFROM", "CCACCTFROM":
+		if tag == "ACCTID" {
+			s.AccountID = value
+		}
+	case "BANKTRANLIST":
+		switch tag {
+		case "DTSTART":
+			t, err := parseOFXDate(value)
+			if err != nil {
+				return err
+			}
+			s.Start = t
+		case "DTEND":
+			t, err := parseOFXDate(value)
+			if err != nil {
+				return err
+			}
+			s.End = t
+		}
+	case "STMTRS", "CCSTMTRS":
+		if tag == "CURDEF" {
+			s.Currency = value
+		}
+	}
+	return nil
+}
+
+// parseOFXDate parses OFX datetimes such as "20240115", "20240115120000"
+// or "20240115120000.000[-5:EST]" and returns them in UTC.
+func parseOFXDate(value string) (time.Time, error) {
+	offset := 0
+	if i := strings.IndexByte(value, '['); i >= 0 {
+		tz := strings.TrimSuffix(value[i+1:], "]")
+		if j := strings.IndexByte(tz, ':'); j >= 0 {
+			tz = tz[:j]
+		}
+		hours, err := strconv.ParseFloat(tz, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid OFX date %q", value)
+		}
+		offset = int(hours * 3600)
+		value = value[:i]
+	}
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		value = value[:i]
+	}
+
+	var layout string
+	switch len(value) {
+	case 8:
+		layout = "20060102"
+	case 12:
+		layout = "200601021504"
+	case 14:
+		layout = "20060102150405"
+	default:
+		return time.Time{}, fmt.Errorf("invalid OFX date %q", value)
+	}
+
+	t, err := time.ParseInLocation(layout, value, time.FixedZone("", offset))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid OFX date %q", value)
+	}
+	return t.UTC(), nil
+}
+
+// parseOFXAmount accepts both "." and "," as decimal separator, as some
+// European banks emit the latter. The decimal separator is the last one, if
+// it appears only once; any other groups thousands, as in "1,234.56" or
+// "1.234,56". A lone separator followed by exactly three digits groups
+// thousands too, as in "1,234" or "1.234", unless it follows a zero.
+func parseOFXAmount(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	decimal := strings.LastIndexAny(value, ".,")
+	if decimal >= 0 {
+		separator := value[decimal : decimal+1]
+		integer := strings.TrimLeft(value[:decimal], "+-")
+		grouped := len(value)-decimal-1 == 3 && !strings.ContainsAny(integer, ".,") && integer != "0" && integer != ""
+		if strings.Count(value, separator) > 1 || grouped {
+			decimal = -1
+		}
+	}
+	var normalized strings.Builder
+	for i, r := range value {
+		switch {
+		case i == decimal:
+			normalized.WriteByte('.')
+		case r == '.' || r == ',':
+		default:
+			normalized.WriteRune(r)
+		}
+	}
+	amount, err := strconv.ParseFloat(normalized.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid OFX amount %q", value)
+	}
+	return amount, nil
+}
+
+// ============================================================================
+// IMPORT
+// ============================================================================
+
+type OFXReconciliation struct {
+	// Status is one of "baseline" (first balance recorded for the account),
+	// "balanced", "mismatch", "gap" (the statement does not cover the period
+	// since the previously recorded balance) or "stale" (the statement is
+	// older than the recorded balance).
+	Status          string     `json:"status"`
+	ReportedBalance float64    `json:"reported_balance"`
+	AsOf            time.Time  `json:"as_of"`
+	PreviousBalance *float64   `json:"previous_balance,omitempty"`
+	PreviousAsOf    *time.Time `json:"previous_as_of,omitempty"`
+	ExpectedBalance *float64   `json:"expected_balance,omitempty"`
+	Difference      *float64   `json:"difference,omitempty"`
+}
+
+type OFXImportResult struct {
+	Imported       int                `json:"imported"`
+	Duplicates     int                `json:"duplicates"`
+	SkippedCredits int                `json:"skipped_credits"`
+	Transactions   []Transaction      `json:"transactions"`
+	Reconciliation *OFXReconciliation `json:"reconciliation,omitempty"`
+}
+
+// ImportOFX imports an OFX/QFX statement into an account. Debits become
+// expenses in the chosen category; credits are skipped unless
+// include_credits=true, in which case they are imported as refunds
+// (negative amounts). Each transaction stores its FITID as ExternalID so
+// that re-importing the same statement does not create duplicates.
+func (h *Handlers) ImportOFX(c *gin.Context) {
+	householdID := c.Param("household_id")
+	accountID := c.Param("id")
+
+	var account Account
+	if err := h.db.First(&account, "id = ? AND household_id = ?", accountID, householdID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	categoryID := c.PostForm("category_id")
+	if categoryID == "" {
+		categoryID = c.Query("category_id")
+	}
+	if categoryID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "category_id is required"})
+		return
+	}
+	var category Category
+	if err := h.db.First(&category, "id = ? AND household_id = ?", categoryID, householdID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+		return
+	}
+
+	includeCredits := c.DefaultPostForm("include_credits", c.Query("include_credits")) == "true"
+
+	var body io.Reader
+	if file, _, err := c.Request.FormFile("file"); err == nil {
+		defer func() { _ = file.Close() }()
+		body = file
+	} else {
+		body = c.Request.Body
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxOFXSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read OFX file"})
+		return
+	}
+	if len(data) > maxOFXSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "OFX file is larger than 10 MB"})
+		return
+	}
+	stmt, err := ParseOFX(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OFX file: " + err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	result := OFXImportResult{Transactions: []Transaction{}}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for _, trn := range stmt.Transactions {
+			if trn.FITID == "" {
+				continue
+			}
+			if trn.Amount >= 0 && !includeCredits {
+				result.SkippedCredits++
+				continue
+			}
+
+			// Deleted and replaced versions still count, so that an expense
+			// the user removed does not come back on the next import.
+			var count int64
+			if err := tx.Unscoped().Model(&Transaction{}).
+				Where("household_id = ? AND account_id = ? AND external_id = ?", householdID, accountID, trn.FITID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				result.Duplicates++
+				continue
+			}
+
+			description := trn.Name
+			if description == "" {
+				description = trn.Memo
+			}
+
+			transaction := Transaction{
+				ID:          uuid.New().String(),
+				AccountID:   accountID,
+				CategoryID:  categoryID,
+				UserID:      userID,
+				Amount:      -trn.Amount,
+				Date:        trn.Posted,
+				Description: SecretString(description),
+				HouseholdID: householdID,
+				ExternalID:  trn.FITID,
+			}
+			if err := tx.Create(&transaction).Error; err != nil {
+				return err
+			}
+			result.Transactions = append(result.Transactions, transaction)
+			result.Imported++
+		}
+
+		if stmt.LedgerBalance != nil {
+			result.Reconciliation = reconcileLedgerBalance(&account, stmt)
+			if account.LedgerBalanceAt == nil || !stmt.LedgerBalance.AsOf.Before(*account.LedgerBalanceAt) {
+				balance := stmt.LedgerBalance.Amount
+				asOf := stmt.LedgerBalance.AsOf
+				if err := tx.Model(&account).Updates(map[string]any{
+					"ledger_balance":    balance,
+					"ledger_balance_at": asOf,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import statement"})
+		return
+	}
+
+	// All imported transactions share a category: check each month once
+	checked := map[string]bool{}
+	for _, t := range result.Transactions {
+		h.publishEvent(householdID, EventTransactionCreated, t)
+		if month := t.Date.Format("2006-01"); !checked[month] {
+			checked[month] = true
+			h.afterTransactionSaved(t)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// reconcileLedgerBalance checks the statement's ledger balance against the
+// balance recorded on the previous import plus the net movement reported
+// in between.
+func reconcileLedgerBalance(account *Account, stmt *OFXStatement) *OFXReconciliation {
+	reported := stmt.LedgerBalance
+	rec := &OFXReconciliation{
+		ReportedBalance: reported.Amount,
+		AsOf:            reported.AsOf,
+	}
+
+	if account.LedgerBalance == nil || account.LedgerBalanceAt == nil {
+		rec.Status = "baseline"
+		return rec
+	}
+
+	previous := *account.LedgerBalance
+	previousAsOf := *account.LedgerBalanceAt
+	rec.PreviousBalance = &previous
+	rec.PreviousAsOf = &previousAsOf
+
+	if reported.AsOf.Before(previousAsOf) {
+		rec.Status = "stale"
+		return rec
+	}
+
+	if !stmt.Start.IsZero() && stmt.Start.After(previousAsOf) {
+		rec.Status = "gap"
+		return rec
+	}
+
+	var net float64
+	for _, trn := range stmt.Transactions {
+		if trn.Posted.After(previousAsOf) && !trn.Posted.After(reported.AsOf) {
+			net += trn.Amount
+		}
+	}
+
+	expected := previous + net
+	expected = math.Round(expected*100) / 100
+	difference := math.Round((reported.Amount-expected)*100) / 100
+	rec.ExpectedBalance = &expected
+	rec.Difference = &difference
+
+	if difference == 0 {
+		rec.Status = "balanced"
+	} else {
+		rec.Status = "mismatch"
+	}
+	return rec
+}
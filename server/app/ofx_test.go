@@ -0,0 +1,274 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleSGMLStatement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+ENCODING:USASCII
+CHARSET:1252
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>20240201</SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<STMTRS>
+<CURDEF>USD
+<BANKACCTFROM>
+<BANKID>123456789
+<ACCTID>000111222
+<ACCTTYPE>CHECKING
+</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20240101
+<DTEND>20240131
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240105120000.000[-5:EST]
+<TRNAMT>-45.20
+<FITID>FIT-1
+<NAME>SUPERMARKET &amp; CO
+<MEMO>
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240110
+<TRNAMT>1000.00
+<FITID>FIT-2
+<NAME>PAYROLL
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240120
+<TRNAMT>-12,50
+<FITID>FIT-3
+<MEMO>Coffee
+</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>942.30
+<DTASOF>20240131
+</LEDGERBAL>
+<AVAILBAL>
+<BALAMT>900.00
+<DTASOF>20240131
+</AVAILBAL>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+
+const sampleXMLStatement = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <CCSTMTRS>
+        <CURDEF>EUR</CURDEF>
+        <CCACCTFROM><ACCTID>4111</ACCTID></CCACCTFROM>
+        <BANKTRANLIST>
+          <DTSTART>20240201</DTSTART>
+          <DTEND>20240229</DTEND>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20240203</DTPOSTED>
+            <TRNAMT>-20.00</TRNAMT>
+            <FITID>CC-1</FITID>
+            <NAME>Bookshop</NAME>
+          </STMTTRN>
+        </BANKTRANLIST>
+        <LEDGERBAL><BALAMT>-20.00</BALAMT><DTASOF>20240229</DTASOF></LEDGERBAL>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>`
+
+func TestParseOFX_SGML(t *testing.T) {
+	stmt, err := ParseOFX(strings.NewReader(sampleSGMLStatement))
+	require.NoError(t, err)
+
+	assert.Equal(t, "000111222", stmt.AccountID)
+	assert.Equal(t, "USD", stmt.Currency)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), stmt.Start)
+	require.Len(t, stmt.Transactions, 3)
+
+	first := stmt.Transactions[0]
+	assert.Equal(t, "FIT-1", first.FITID)
+	assert.Equal(t, -45.20, first.Amount)
+	assert.Equal(t, "SUPERMARKET & CO", first.Name)
+	assert.Equal(t, time.Date(2024, 1, 5, 17, 0, 0, 0, time.UTC), first.Posted)
+
+	assert.Equal(t, -12.50, stmt.Transactions[2].Amount)
+	assert.Equal(t, "Coffee", stmt.Transactions[2].Memo)
+
+	require.NotNil(t, stmt.LedgerBalance)
+	assert.Equal(t, 942.30, stmt.LedgerBalance.Amount)
+}
+
+func TestParseOFX_XML(t *testing.T) {
+	stmt, err := ParseOFX(strings.NewReader(sampleXMLStatement))
+	require.NoError(t, err)
+
+	assert.Equal(t, "4111", stmt.AccountID)
+	assert.Equal(t, "EUR", stmt.Currency)
+	require.Len(t, stmt.Transactions, 1)
+	assert.Equal(t, "CC-1", stmt.Transactions[0].FITID)
+	assert.Equal(t, "Bookshop", stmt.Transactions[0].Name)
+	require.NotNil(t, stmt.LedgerBalance)
+	assert.Equal(t, -20.0, stmt.LedgerBalance.Amount)
+}
+
+func TestParseOFXAmount(t *testing.T) {
+	for value, want := range map[string]float64{
+		"-45.20":        -45.20,
+		"12,50":         12.50,
+		"1,234.56":      1234.56,
+		"1.234,56":      1234.56,
+		"-1,234,567.8":  -1234567.8,
+		"1.234.567":     1234567,
+		" 3 ":           3,
+		"1,234,567":     1234567,
+		"-1.234.567,89": -1234567.89,
+		"1,234":         1234,
+		"-1.234":        -1234,
+		"1.234,5":       1234.5,
+		"0.125":         0.125,
+		"12,500.5":      12500.5,
+	} {
+		amount, err := parseOFXAmount(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, amount, value)
+	}
+
+	_, err := parseOFXAmount("12.50 EUR")
+	assert.Error(t, err)
+}
+
+func TestParseOFX_Invalid(t *testing.T) {
+	_, err := ParseOFX(strings.NewReader("date,amount\n2024-01-01,10"))
+	assert.Error(t, err)
+
+	_, err = ParseOFX(strings.NewReader("<OFX><STMTTRN><DTPOSTED>yesterday</STMTTRN></OFX>"))
+	assert.Error(t, err)
+}
+
+func TestImportOFX(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-ofx"
+
+	db.Create(&Account{ID: "acc-1", HouseholdID: householdID, Type: "bank", Name: "Checking"})
+	db.Create(&Category{ID: "cat-1", HouseholdID: householdID, Name: "Imported"})
+
+	r := gin.Default()
+	r.POST("/households/:household_id/accounts/:id/import/ofx", h.ImportOFX)
+
+	upload := func(statement string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		_ = mw.WriteField("category_id", "cat-1")
+		fw, _ := mw.CreateFormFile("file", "statement.ofx")
+		_, _ = fw.Write([]byte(statement))
+		_ = mw.Close()
+
+		req, _ := http.NewRequest("POST", "/households/"+householdID+"/accounts/acc-1/import/ofx", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 1. First import records debits and a baseline balance
+	w := upload(sampleSGMLStatement)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result OFXImportResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 1, result.SkippedCredits)
+	require.NotNil(t, result.Reconciliation)
+	assert.Equal(t, "baseline", result.Reconciliation.Status)
+
+	var imported Transaction
+	require.NoError(t, db.First(&imported, "external_id = ?", "FIT-1").Error)
+	assert.Equal(t, 45.20, imported.Amount)
+	assert.Equal(t, "SUPERMARKET & CO", string(imported.Description))
+
+	// 2. Re-importing the same file is a no-op and the balance still matches
+	w = upload(sampleSGMLStatement)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 0, result.Imported)
+	assert.Equal(t, 2, result.Duplicates)
+	assert.Equal(t, "balanced", result.Reconciliation.Status)
+
+	var count int64
+	db.Model(&Transaction{}).Where("household_id = ?", householdID).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// 3. A following statement whose balance does not add up is flagged
+	next := strings.NewReplacer(
+		"20240101", "20240131", "20240131", "20240229",
+		"FIT-1", "FIT-4", "FIT-2", "FIT-5", "FIT-3", "FIT-6",
+		"942.30", "100.00",
+	).Replace(sampleSGMLStatement)
+	w = upload(next)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, "mismatch", result.Reconciliation.Status)
+	require.NotNil(t, result.Reconciliation.ExpectedBalance)
+	assert.Equal(t, 942.30, *result.Reconciliation.PreviousBalance)
+}
+
+func TestImportOFX_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-ofx"
+
+	db.Create(&Account{ID: "acc-1", HouseholdID: householdID, Type: "bank", Name: "Checking"})
+	db.Create(&Category{ID: "cat-1", HouseholdID: householdID, Name: "Imported"})
+
+	r := gin.Default()
+	r.POST("/households/:household_id/accounts/:id/import/ofx", h.ImportOFX)
+
+	// Unknown account
+	req, _ := http.NewRequest("POST", "/households/"+householdID+"/accounts/none/import/ofx?category_id=cat-1", strings.NewReader(sampleSGMLStatement))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Missing category
+	req, _ = http.NewRequest("POST", "/households/"+householdID+"/accounts/acc-1/import/ofx", strings.NewReader(sampleSGMLStatement))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Not an OFX file
+	req, _ = http.NewRequest("POST", "/households/"+householdID+"/accounts/acc-1/import/ofx?category_id=cat-1", strings.NewReader("hello"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Too large to be read whole
+	req, _ = http.NewRequest("POST", "/households/"+householdID+"/accounts/acc-1/import/ofx?category_id=cat-1", strings.NewReader(strings.Repeat(" ", maxOFXSize+1)))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
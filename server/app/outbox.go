@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// outboxInterval is how often the worker looks for emails to deliver.
+	outboxInterval = 15 * time.Second
+	// outboxBatchSize caps the emails delivered per run.
+	outboxBatchSize = 50
+	// outboxLease keeps other workers away from an email being delivered.
+	outboxLease = 5 * time.Minute
+	// outboxMaxAttempts is how many deliveries are tried before giving up.
+	outboxMaxAttempts = 8
+)
+
+const (
+	retryBaseBackoff = 30 * time.Second
+	retryMaxBackoff  = 6 * time.Hour
+)
+
+// sendFunc delivers a rendered email.
+type sendFunc func(to, subject, text, html string) error
+
+// enqueueEmail renders an email in the recipient's language and stores it
+// in the outbox as part of tx, so it is only sent if tx commits.
+func (h *Handlers) enqueueEmail(tx *gorm.DB, to, householdID, name string, data any) error {
+	subject, text, html, err := renderEmail(name, emailLocale(tx, to, householdID), data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&OutboxEmail{
+		ID:            uuid.New().String(),
+		HouseholdID:   householdID,
+		To:            SecretString(to),
+		Template:      name,
+		Subject:       SecretString(subject),
+		Text:          SecretString(text),
+		HTML:          SecretString(html),
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now().UTC(),
+	}).Error
+}
+
+// retryBackoff is the delay before the next delivery after the given number
+// of failed attempts. It is shared by emails and webhooks.
+func retryBackoff(attempts int) time.Duration {
+	delay := retryBaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxBackoff {
+			return retryMaxBackoff
+		}
+	}
+	return delay
+}
+
+// deliverOutbox sends the emails due at now and returns how many were sent.
+// Each email is claimed by pushing its next attempt past the lease, so
+// concurrent workers never send it twice and a crashed worker's emails are
+// picked up again once the lease expires.
+func (h *Handlers) deliverOutbox(now time.Time, send sendFunc) int {
+	var due []OutboxEmail
+	if err := h.db.Where("status = ? AND next_attempt_at <= ?", OutboxPending, now).
+		Order("next_attempt_at ASC").
+		Limit(outboxBatchSize).
+		Find(&due).Error; err != nil {
+		log.Printf("Error listing outbox emails: %v", err)
+		return 0
+	}
+
+	sent := 0
+	for _, email := range due {
+		claim := h.db.Model(&OutboxEmail{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", email.ID, OutboxPending, now).
+			Update("next_attempt_at", now.Add(outboxLease))
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue // Claimed by another worker
+		}
+
+		updates := map[string]any{"attempts": email.Attempts + 1}
+		if err := send(string(email.To), string(email.Subject), string(email.Text), string(email.HTML)); err != nil {
+			updates["last_error"] = err.Error()
+			if email.Attempts+1 >= outboxMaxAttempts {
+				updates["status"] = OutboxFailed
+				log.Printf("Giving up on outbox email %s after %d attempts: %v", email.ID, email.Attempts+1, err)
+			} else {
+				updates["next_attempt_at"] = now.Add(retryBackoff(email.Attempts + 1))
+				log.Printf("Error sending outbox email %s: %v", email.ID, err)
+			}
+		} else {
+			updates["status"] = OutboxSent
+			updates["sent_at"] = now
+			sent++
+		}
+		if err := h.db.Model(&OutboxEmail{}).Where("id = ?", email.ID).Updates(updates).Error; err != nil {
+			log.Printf("Error updating outbox email %s: %v", email.ID, err)
+		}
+	}
+	return sent
+}
+
+// RunOutboxWorker delivers outbox emails until ctx is cancelled.
+func (h *Handlers) RunOutboxWorker(ctx context.Context) {
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+
+	for {
+		h.deliverOutbox(time.Now().UTC(), h.sendMail)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ============================================================================
+// OUTBOX ADMINISTRATION
+// ============================================================================
+
+// GetOutbox lists the household's emails, failed ones by default. Recipients
+// and contents are never returned.
+func (h *Handlers) GetOutbox(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	status := c.DefaultQuery("status", OutboxFailed)
+	if status != OutboxPending && status != OutboxSent && status != OutboxFailed && status != OutboxCancelled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, sent, failed or cancelled"})
+		return
+	}
+
+	emails := []OutboxEmail{}
+	if err := h.db.Where("household_id = ? AND status = ?", householdID, status).
+		Order("created_at DESC").
+		Limit(100).
+		Find(&emails).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outbox"})
+		return
+	}
+
+	c.JSON(http.StatusOK, emails)
+}
+
+// RetryOutboxEmail puts a failed email back in the queue with a fresh set
+// of attempts.
+func (h *Handlers) RetryOutboxEmail(c *gin.Context) {
+	householdID := c.Param("household_id")
+	id := c.Param("id")
+
+	result := h.db.Model(&OutboxEmail{}).
+		Where("id = ? AND household_id = ? AND status = ?", id, householdID, OutboxFailed).
+		Updates(map[string]any{
+			"status":          OutboxPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now().UTC(),
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry email"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed email not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestEnqueueEmail_FollowsTransaction(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	db.Create(&Household{ID: "hh-1", Name: "Home", Locale: "en"})
+
+	// Rolled back along with the invitation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		require.NoError(t, h.QueueInvitationEmail(tx, "friend@example.com", "abc", "hh-1"))
+		return errors.New("rollback")
+	})
+	require.Error(t, err)
+	var count int64
+	db.Model(&OutboxEmail{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return h.QueueInvitationEmail(tx, "friend@example.com", "abc", "hh-1")
+	})
+	require.NoError(t, err)
+
+	var email OutboxEmail
+	require.NoError(t, db.First(&email).Error)
+	assert.Equal(t, OutboxPending, email.Status)
+	assert.Equal(t, "invitation", email.Template)
+	assert.Equal(t, "friend@example.com", string(email.To))
+	assert.Contains(t, string(email.Text), "abc")
+	assert.NotEmpty(t, email.Subject)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, retryBackoff(1))
+	assert.Equal(t, time.Minute, retryBackoff(2))
+	assert.Equal(t, 4*time.Minute, retryBackoff(4))
+	assert.Equal(t, retryMaxBackoff, retryBackoff(20))
+}
+
+func TestDeliverOutbox(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	db.Create(&OutboxEmail{ID: "ok", HouseholdID: "hh-1", To: "a@example.com", Subject: "Hi", Status: OutboxPending, NextAttemptAt: now})
+	db.Create(&OutboxEmail{ID: "later", HouseholdID: "hh-1", To: "b@example.com", Subject: "Hi", Status: OutboxPending, NextAttemptAt: now.Add(time.Hour)})
+
+	var sentTo []string
+	sent := h.deliverOutbox(now, func(to, subject, text, html string) error {
+		sentTo = append(sentTo, to)
+		return nil
+	})
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"a@example.com"}, sentTo)
+
+	var email OutboxEmail
+	require.NoError(t, db.First(&email, "id = ?", "ok").Error)
+	assert.Equal(t, OutboxSent, email.Status)
+	assert.Equal(t, 1, email.Attempts)
+	assert.NotNil(t, email.SentAt)
+
+	// Sent emails are never delivered again
+	assert.Equal(t, 0, h.deliverOutbox(now, func(to, subject, text, html string) error { return nil }))
+}
+
+func TestDeliverOutbox_RetriesThenGivesUp(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db.Create(&OutboxEmail{ID: "e1", HouseholdID: "hh-1", To: "a@example.com", Status: OutboxPending, NextAttemptAt: now})
+
+	failing := func(to, subject, text, html string) error { return errors.New("connection refused") }
+
+	assert.Equal(t, 0, h.deliverOutbox(now, failing))
+	var email OutboxEmail
+	require.NoError(t, db.First(&email, "id = ?", "e1").Error)
+	assert.Equal(t, OutboxPending, email.Status)
+	assert.Equal(t, 1, email.Attempts)
+	assert.Equal(t, "connection refused", email.LastError)
+	assert.True(t, email.NextAttemptAt.Equal(now.Add(30*time.Second)))
+
+	// Not due before the backoff expires
+	h.deliverOutbox(now.Add(10*time.Second), failing)
+	require.NoError(t, db.First(&email, "id = ?", "e1").Error)
+	assert.Equal(t, 1, email.Attempts)
+
+	for email.Status == OutboxPending {
+		h.deliverOutbox(email.NextAttemptAt, failing)
+		require.NoError(t, db.First(&email, "id = ?", "e1").Error)
+	}
+	assert.Equal(t, OutboxFailed, email.Status)
+	assert.Equal(t, outboxMaxAttempts, email.Attempts)
+}
+
+func TestOutboxAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	now := time.Now().UTC()
+
+	db.Create(&OutboxEmail{ID: "failed", HouseholdID: "hh-1", To: "a@example.com", Subject: "Secret", Status: OutboxFailed, Attempts: outboxMaxAttempts, NextAttemptAt: now})
+	db.Create(&OutboxEmail{ID: "other", HouseholdID: "hh-2", To: "b@example.com", Status: OutboxFailed, NextAttemptAt: now})
+	db.Create(&OutboxEmail{ID: "sent", HouseholdID: "hh-1", To: "c@example.com", Status: OutboxSent, NextAttemptAt: now})
+
+	r := gin.Default()
+	r.GET("/households/:household_id/outbox", h.GetOutbox)
+	r.POST("/households/:household_id/outbox/:id/retry", h.RetryOutboxEmail)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/households/hh-1/outbox", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "a@example.com")
+	assert.NotContains(t, w.Body.String(), "Secret")
+	var emails []OutboxEmail
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &emails))
+	require.Len(t, emails, 1)
+	assert.Equal(t, "failed", emails[0].ID)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/households/hh-1/outbox?status=bogus", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Only failed emails of the household can be retried
+	for _, id := range []string{"other", "sent"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/households/hh-1/outbox/"+id+"/retry", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/households/hh-1/outbox/failed/retry", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	var email OutboxEmail
+	require.NoError(t, db.First(&email, "id = ?", "failed").Error)
+	assert.Equal(t, OutboxPending, email.Status)
+	assert.Equal(t, 0, email.Attempts)
+}
@@ -0,0 +1,381 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const accountAnonymisationInterval = time.Hour
+
+// anonymisedName replaces the name of users whose data was erased, in the
+// reports and exports of the households they were in.
+const anonymisedName = "Former member"
+
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// ProfilePreferences are the notifications the user gets.
+type ProfilePreferences struct {
+	BudgetAlerts bool `json:"budget_alerts"`
+	DigestEmails bool `json:"digest_emails"`
+}
+
+// ProfileResponse is the current user's own profile.
+type ProfileResponse struct {
+	ID          string             `json:"id"`
+	Email       string             `json:"email"`
+	Name        string             `json:"name"`
+	CustomName  bool               `json:"custom_name"`
+	PictureURL  string             `json:"picture_url"`
+	Color       string             `json:"color"`
+	Locale      string             `json:"locale"`
+	HouseholdID string             `json:"household_id"`
+	Preferences ProfilePreferences `json:"preferences"`
+}
+
+func profileResponse(user User) ProfileResponse {
+	return ProfileResponse{
+		ID:          user.ID,
+		Email:       string(user.Email),
+		Name:        string(user.Name),
+		CustomName:  user.CustomName,
+		PictureURL:  user.PictureURL,
+		Color:       user.Color,
+		Locale:      user.Locale,
+		HouseholdID: user.HouseholdID,
+		Preferences: ProfilePreferences{
+			BudgetAlerts: user.BudgetAlerts,
+			DigestEmails: user.DigestEmails,
+		},
+	}
+}
+
+// GetMe returns the current user's profile.
+func (h *Handlers) GetMe(c *gin.Context) {
+	var user User
+	if err := h.db.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// UpdateMe changes the current user's profile. Fields left out are kept. An
+// empty name goes back to the name in their Google account.
+func (h *Handlers) UpdateMe(c *gin.Context) {
+	var req struct {
+		Name        *string `json:"name"`
+		Color       *string `json:"color"`
+		Locale      *string `json:"locale"`
+		Preferences *struct {
+			BudgetAlerts *bool `json:"budget_alerts"`
+			DigestEmails *bool `json:"digest_emails"`
+		} `json:"preferences"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user User
+	if err := h.db.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	before := user
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		switch {
+		case name != "":
+			user.Name = SecretString(name)
+			user.CustomName = true
+		case user.GoogleName != "":
+			user.Name = user.GoogleName
+			user.CustomName = false
+		default:
+			user.CustomName = false
+		}
+	}
+	if req.Color != nil {
+		if !colorPattern.MatchString(*req.Color) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Color must be like #RRGGBB"})
+			return
+		}
+		user.Color = *req.Color
+	}
+	if req.Locale != nil {
+		if *req.Locale != "" && !isSupportedLocale(*req.Locale) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale"})
+			return
+		}
+		user.Locale = *req.Locale
+	}
+	if p := req.Preferences; p != nil {
+		if p.BudgetAlerts != nil {
+			user.BudgetAlerts = *p.BudgetAlerts
+		}
+		if p.DigestEmails != nil {
+			user.DigestEmails = *p.DigestEmails
+		}
+	}
+
+	err := h.db.Model(&user).
+		Select("name", "custom_name", "color", "locale", "budget_alerts", "digest_emails").
+		Updates(&user).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	// Other members see the name and color
+	if user.Name != before.Name || user.Color != before.Color {
+		var memberships []Membership
+		h.db.Where("user_id = ?", user.ID).Find(&memberships)
+		for _, m := range memberships {
+			h.publishEvent(m.HouseholdID, EventMemberUpdated, activeMember(user, m.Role))
+		}
+	}
+
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// reactivationDeadline returns until when a user who deleted their account
+// at deletedAt can get it back.
+func (h *Handlers) reactivationDeadline(deletedAt time.Time) time.Time {
+	return deletedAt.Add(time.Duration(h.cfg.AccountReactivationDays) * 24 * time.Hour)
+}
+
+// DeleteMe deletes the current user's account. Signing in again before the
+// reactivation deadline brings it back; after that, their personal data is
+// erased. Owners of households with other members have to transfer
+// ownership first.
+func (h *Handlers) DeleteMe(c *gin.Context) {
+	var user User
+	if err := h.db.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	var memberships []Membership
+	if err := h.db.Where("user_id = ?", user.ID).Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&OutboxEmail{}).
+			Where("to_hash = ? AND status = ?", HashSensitive(string(user.Email)), OutboxPending).
+			Update("status", OutboxCancelled).Error; err != nil {
+			return err
+		}
+		for _, m := range memberships {
+			var others int64
+			if err := tx.Model(&User{}).Where("id IN (?)", memberIDs(tx, m.HouseholdID)).Count(&others).Error; err != nil {
+				return err
+			}
+			if others == 0 {
+				continue // Their own household goes away with their data
+			}
+			if err := ensureOwner(tx, m.HouseholdID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errLastOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Transfer ownership of your households before deleting your account"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	for _, m := range memberships {
+		h.publishEvent(m.HouseholdID, EventMemberRemoved, deletedResource{ID: user.ID})
+	}
+	c.JSON(http.StatusOK, gin.H{"reactivate_until": h.reactivationDeadline(time.Now().UTC())})
+}
+
+// reactivateUser brings back the account of a user who deleted it.
+func (h *Handlers) reactivateUser(user *User) error {
+	if err := h.db.Unscoped().Model(user).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+
+	var memberships []Membership
+	h.db.Where("user_id = ?", user.ID).Find(&memberships)
+	for _, m := range memberships {
+		h.publishMemberJoined(m.HouseholdID, *user, "")
+	}
+	return nil
+}
+
+// anonymiseUser erases the personal data of a deleted user. They leave
+// their households, and the ones they were the only member of are deleted.
+func anonymiseUser(tx *gorm.DB, user User, now time.Time) error {
+	if err := eraseMentions(tx, user); err != nil {
+		return err
+	}
+
+	var memberships []Membership
+	if err := tx.Where("user_id = ?", user.ID).Find(&memberships).Error; err != nil {
+		return err
+	}
+	for _, m := range memberships {
+		var others int64
+		if err := tx.Model(&Membership{}).Where("household_id = ? AND user_id <> ?", m.HouseholdID, user.ID).Count(&others).Error; err != nil {
+			return err
+		}
+		if others == 0 {
+			if err := deleteHousehold(tx, m.HouseholdID, now); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&Membership{}).Error; err != nil {
+		return err
+	}
+
+	// Columns are set directly: the email hash must stay unique
+	return tx.Unscoped().Model(&User{}).Where("id = ?", user.ID).UpdateColumns(map[string]any{
+		"email":         SecretString(""),
+		"email_hash":    "deleted:" + user.ID,
+		"google_id":     "",
+		"name":          SecretString(anonymisedName),
+		"google_name":   SecretString(""),
+		"custom_name":   false,
+		"picture_url":   "",
+		"budget_alerts": false,
+		"digest_emails": false,
+		"locale":        "",
+		"anonymised_at": now,
+	}).Error
+}
+
+// eraseMentions removes the user's personal data kept outside their account:
+// the emails sent to them, the invitations to their address, and the webhook
+// deliveries and stored responses of their households that mention them.
+func eraseMentions(tx *gorm.DB, user User) error {
+	if user.Email != "" {
+		emailHash := HashSensitive(string(user.Email))
+		if err := tx.Where("to_hash = ?", emailHash).Delete(&OutboxEmail{}).Error; err != nil {
+			return err
+		}
+		// Emails queued before recipients were hashed
+		var unhashed []OutboxEmail
+		if err := tx.Where("to_hash = ? OR to_hash IS NULL", "").Find(&unhashed).Error; err != nil {
+			return err
+		}
+		for _, e := range unhashed {
+			if strings.EqualFold(string(e.To), string(user.Email)) {
+				if err := tx.Delete(&OutboxEmail{}, "id = ?", e.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		invitations := tx.Unscoped().Model(&Invitation{}).Where("email_hash = ?", emailHash)
+		if err := invitations.Session(&gorm.Session{}).Where("status = ?", InvitationPending).Update("status", InvitationRevoked).Error; err != nil {
+			return err
+		}
+		if err := invitations.Session(&gorm.Session{}).UpdateColumns(map[string]any{"email": SecretString(""), "email_hash": ""}).Error; err != nil {
+			return err
+		}
+	}
+
+	// Personal values as they appear in JSON documents
+	var values []string
+	for _, v := range []SecretString{user.Email, user.Name, user.GoogleName} {
+		if v != "" {
+			encoded, _ := json.Marshal(string(v))
+			values = append(values, string(encoded))
+		}
+	}
+	mentions := func(doc string) bool {
+		for _, v := range values {
+			if strings.Contains(doc, v) {
+				return true
+			}
+		}
+		return false
+	}
+	households := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&Membership{}).Select("household_id").Where("user_id = ?", user.ID)
+
+	var deliveries []WebhookDelivery
+	if err := tx.Where("household_id IN (?)", households).Find(&deliveries).Error; err != nil {
+		return err
+	}
+	for _, d := range deliveries {
+		if mentions(string(d.Payload)) {
+			if err := tx.Delete(&WebhookDelivery{}, "id = ?", d.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	var keys []IdempotencyKey
+	if err := tx.Where("household_id IN (?)", households).Find(&keys).Error; err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if mentions(string(k.Body)) {
+			if err := tx.Delete(&IdempotencyKey{}, "id = ?", k.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// anonymiseUsers erases the data of the users whose reactivation window is
+// over and returns how many there were.
+func (h *Handlers) anonymiseUsers(now time.Time) int {
+	var due []User
+	cutoff := now.Add(-time.Duration(h.cfg.AccountReactivationDays) * 24 * time.Hour)
+	if err := h.db.Unscoped().Where("deleted_at <= ? AND anonymised_at IS NULL", cutoff).Find(&due).Error; err != nil {
+		log.Printf("Error finding deleted accounts: %v", err)
+		return 0
+	}
+
+	anonymised := 0
+	for _, user := range due {
+		if err := h.db.Transaction(func(tx *gorm.DB) error { return anonymiseUser(tx, user, now) }); err != nil {
+			log.Printf("Error anonymising user %s: %v", user.ID, err)
+			continue
+		}
+		anonymised++
+	}
+	return anonymised
+}
+
+// RunAccountAnonymisation erases the data of deleted accounts until ctx is
+// cancelled.
+func (h *Handlers) RunAccountAnonymisation(ctx context.Context) {
+	ticker := time.NewTicker(accountAnonymisationInterval)
+	defer ticker.Stop()
+
+	for {
+		if n := h.anonymiseUsers(time.Now().UTC()); n > 0 {
+			log.Printf("Anonymised %d deleted accounts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
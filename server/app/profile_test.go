@@ -0,0 +1,197 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	cfg.JWTSecret = "test_secret"
+	cfg.AccountReactivationDays = 30
+	h := NewHandlers(db, cfg)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(GoogleUserInfo{ID: "google-me", Email: "me@gmail.com", Name: "Google Name"})
+	}))
+	defer server.Close()
+	h.googleAPIURL = server.URL
+
+	r := gin.New()
+	r.POST("/auth/google", h.AuthGoogle)
+	me := r.Group("/me")
+	me.Use(h.UserMiddleware())
+	me.GET("", h.GetMe)
+	me.PATCH("", h.UpdateMe)
+
+	login := func() AuthResponse {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/auth/google", strings.NewReader(`{"access_token": "fake"}`)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp AuthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+	token := login().Token
+	do := func(method, body string) (int, ProfileResponse) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/me", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		var profile ProfileResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+		}
+		return w.Code, profile
+	}
+
+	code, profile := do("GET", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Google Name", profile.Name)
+	assert.False(t, profile.CustomName)
+	assert.True(t, profile.Preferences.DigestEmails)
+
+	// A chosen name survives signing in again
+	code, profile = do("PATCH", `{"name": "Nick", "color": "#123abc", "locale": "en", "preferences": {"budget_alerts": true, "digest_emails": false}}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Nick", profile.Name)
+	assert.Equal(t, "#123abc", profile.Color)
+	assert.Equal(t, ProfilePreferences{BudgetAlerts: true, DigestEmails: false}, profile.Preferences)
+
+	login()
+	_, profile = do("GET", "")
+	assert.Equal(t, "Nick", profile.Name)
+	assert.True(t, profile.CustomName)
+	assert.False(t, profile.Preferences.DigestEmails)
+
+	// An empty name goes back to the Google one; other fields are kept
+	_, profile = do("PATCH", `{"name": ""}`)
+	assert.Equal(t, "Google Name", profile.Name)
+	assert.False(t, profile.CustomName)
+	assert.Equal(t, "#123abc", profile.Color)
+
+	code, _ = do("PATCH", `{"color": "red"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("PATCH", `{"locale": "xx"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	cfg.JWTSecret = "test_secret"
+	cfg.AccountReactivationDays = 30
+	h := NewHandlers(db, cfg)
+
+	email := "leaving@gmail.com"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(GoogleUserInfo{ID: "google-leaving", Email: email, Name: "Leaving"})
+	}))
+	defer server.Close()
+	h.googleAPIURL = server.URL
+
+	r := gin.New()
+	r.POST("/auth/google", h.AuthGoogle)
+	me := r.Group("/me")
+	me.Use(h.UserMiddleware())
+	me.GET("", h.GetMe)
+	me.DELETE("", h.DeleteMe)
+
+	login := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/auth/google", strings.NewReader(`{"access_token": "fake"}`)))
+		return w
+	}
+	do := func(method, token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	w := login()
+	require.Equal(t, http.StatusOK, w.Code)
+	var auth AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &auth))
+	home := auth.HouseholdID
+
+	// The last owner of a shared household has to hand it over first
+	db.Create(&Household{ID: "hh-shared", Name: "Shared"})
+	_, err := addMembership(db, auth.User.ID, "hh-shared")
+	require.NoError(t, err)
+	db.Create(&User{ID: "partner", Name: "Partner", Email: "partner@example.com", HouseholdID: "hh-shared"})
+	assert.Equal(t, http.StatusConflict, do("DELETE", auth.Token))
+	db.Model(&Membership{}).Where("user_id = ?", "partner").Update("role", RoleOwner)
+
+	assert.Equal(t, http.StatusOK, do("DELETE", auth.Token))
+	assert.Equal(t, http.StatusUnauthorized, do("GET", auth.Token))
+	member, err := isMember(db, auth.User.ID, "hh-shared")
+	require.NoError(t, err)
+	assert.False(t, member)
+
+	// Signing in within the window brings the account back
+	w = login()
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &auth))
+	assert.Equal(t, http.StatusOK, do("GET", auth.Token))
+	member, err = isMember(db, auth.User.ID, "hh-shared")
+	require.NoError(t, err)
+	assert.True(t, member)
+
+	// After it, their data is erased, also where it was copied
+	db.Create(&OutboxEmail{ID: "mail-1", To: SecretString(email), Subject: "Hi", Status: OutboxPending})
+	db.Create(&Household{ID: "hh-other", Name: "Other"})
+	db.Create(&Invitation{ID: "inv-1", Code: "c0ffee", Email: SecretString(email), HouseholdID: "hh-other", Status: InvitationPending})
+	db.Create(&WebhookDelivery{ID: "d-1", HouseholdID: "hh-shared", Payload: `{"data":{"name":"Leaving"}}`})
+	db.Create(&WebhookDelivery{ID: "d-2", HouseholdID: "hh-shared", Payload: `{"data":{"name":"Partner"}}`})
+	db.Create(&IdempotencyKey{ID: "k-1", HouseholdID: "hh-shared", Key: "k-1", Body: SecretString(`{"email":"` + email + `"}`)})
+
+	require.Equal(t, http.StatusOK, do("DELETE", auth.Token))
+	var mail OutboxEmail
+	require.NoError(t, db.First(&mail, "id = ?", "mail-1").Error)
+	assert.Equal(t, OutboxCancelled, mail.Status)
+	assert.Equal(t, 0, h.anonymiseUsers(time.Now().UTC()))
+	later := time.Now().UTC().AddDate(0, 0, 31)
+	assert.Equal(t, 1, h.anonymiseUsers(later))
+	assert.Equal(t, 0, h.anonymiseUsers(later))
+
+	var erased User
+	require.NoError(t, db.Unscoped().First(&erased, "id = ?", auth.User.ID).Error)
+	assert.Empty(t, string(erased.Email))
+	assert.Equal(t, anonymisedName, string(erased.Name))
+	assert.NotNil(t, erased.AnonymisedAt)
+
+	assert.Error(t, db.First(&OutboxEmail{}, "id = ?", "mail-1").Error)
+	var invitation Invitation
+	require.NoError(t, db.First(&invitation, "id = ?", "inv-1").Error)
+	assert.Empty(t, string(invitation.Email))
+	assert.Equal(t, InvitationRevoked, invitation.Status)
+	var deliveries []string
+	db.Model(&WebhookDelivery{}).Pluck("id", &deliveries)
+	assert.Equal(t, []string{"d-2"}, deliveries)
+	assert.Error(t, db.First(&IdempotencyKey{}, "id = ?", "k-1").Error)
+
+	// Their own household went with them, the shared one stays
+	assert.Error(t, db.First(&Household{}, "id = ?", home).Error)
+	assert.NoError(t, db.First(&Household{}, "id = ?", "hh-shared").Error)
+	var memberships int64
+	db.Model(&Membership{}).Where("user_id = ?", auth.User.ID).Count(&memberships)
+	assert.Zero(t, memberships)
+
+	// Signing in again starts over
+	w = login()
+	require.Equal(t, http.StatusOK, w.Code)
+	var fresh AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fresh))
+	assert.NotEqual(t, auth.User.ID, fresh.User.ID)
+}
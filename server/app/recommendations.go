@@ -0,0 +1,442 @@
+package app
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Recommendation statistics
+const (
+	recommendationMethodMedian      = "median"
+	recommendationMethodTrimmedMean = "trimmed_mean"
+
+	// recommendationThreshold is how far (as a fraction of the budget) the
+	// expected spending must be from the budget to suggest a change.
+	recommendationThreshold = 0.1
+	// seasonalThreshold is how far the same month last year must be from the
+	// yearly average for it to be considered seasonal.
+	seasonalThreshold = 0.15
+)
+
+// RecommendationOptions controls how budget suggestions are computed.
+type RecommendationOptions struct {
+	Months int    // number of complete months to look back
+	Method string // median or trimmed_mean
+}
+
+type MonthlySpent struct {
+	Month string  `json:"month"`
+	Spent float64 `json:"spent"`
+}
+
+// RecommendationReasoning is the data a suggestion was derived from.
+type RecommendationReasoning struct {
+	Method   string         `json:"method"`
+	Months   []MonthlySpent `json:"months"`
+	Baseline float64        `json:"baseline"`
+	// SeasonalFactor is set when the target month was unusual last year; the
+	// baseline is scaled by it.
+	SeasonalFactor   *float64 `json:"seasonal_factor,omitempty"`
+	Expected         float64  `json:"expected"`
+	Budget           float64  `json:"budget"`
+	DeviationPercent float64  `json:"deviation_percent"`
+}
+
+type Suggestion struct {
+	CategoryID string  `json:"category_id"`
+	Category   string  `json:"category"`
+	Action     string  `json:"action"`
+	Amount     float64 `json:"amount"`
+	// Confidence ranges from 0 to 1, growing with the months of history
+	// available and shrinking with how much spending varies between them.
+	Confidence float64                 `json:"confidence"`
+	Reasoning  RecommendationReasoning `json:"reasoning"`
+}
+
+// recommendationOptions reads the months and method query parameters,
+// writing a 400 response if they are invalid.
+func recommendationOptions(c *gin.Context) (RecommendationOptions, bool) {
+	opts := RecommendationOptions{Method: c.DefaultQuery("method", recommendationMethodMedian)}
+	months, err := strconv.Atoi(c.DefaultQuery("months", "6"))
+	if err != nil || months < 1 || months > 24 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "months must be between 1 and 24"})
+		return opts, false
+	}
+	opts.Months = months
+	if opts.Method != recommendationMethodMedian && opts.Method != recommendationMethodTrimmedMean {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid method. Use median or trimmed_mean"})
+		return opts, false
+	}
+	return opts, true
+}
+
+func (h *Handlers) GetRecommendations(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	opts, ok := recommendationOptions(c)
+	if !ok {
+		return
+	}
+
+	target := currentMonthStart()
+	suggestions, err := h.buildRecommendations(householdID, opts, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute recommendations"})
+		return
+	}
+	suggestions, err = h.withoutDecided(householdID, suggestions, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendation decisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// buildRecommendations suggests budgets for the month starting at target,
+// from the complete months before it. Months before the household's first
+// transaction are not counted, so new households get suggestions from the
+// history they have. Inactive and unbudgeted categories are skipped.
+func (h *Handlers) buildRecommendations(householdID string, opts RecommendationOptions, target time.Time) ([]Suggestion, error) {
+	var categories []Category
+	if err := h.db.Where("household_id = ? AND is_active = ?", householdID, true).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	// Seasonality needs the twelve months before the target
+	lookback := opts.Months
+	if lookback < 12 {
+		lookback = 12
+	}
+	queryStart := target.AddDate(0, -lookback, 0)
+
+	var rows []struct {
+		CategoryID string
+		Month      string
+		Spent      float64
+	}
+	bucket := monthBucket(h.db)
+	if err := h.db.Model(&Transaction{}).
+		Select("category_id, "+bucket+" AS month, COALESCE(SUM(amount), 0) AS spent").
+		Where("household_id = ? AND date >= ? AND date < ?", householdID, queryStart, target).
+		Group("category_id, " + bucket).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	spent := map[string]map[string]float64{}
+	firstMonth := ""
+	for _, r := range rows {
+		if spent[r.CategoryID] == nil {
+			spent[r.CategoryID] = map[string]float64{}
+		}
+		spent[r.CategoryID][r.Month] = r.Spent
+		if firstMonth == "" || r.Month < firstMonth {
+			firstMonth = r.Month
+		}
+	}
+
+	var window []string
+	for m := target.AddDate(0, -opts.Months, 0); m.Before(target); m = m.AddDate(0, 1, 0) {
+		if month := m.Format("2006-01"); firstMonth != "" && month >= firstMonth {
+			window = append(window, month)
+		}
+	}
+	if len(window) == 0 {
+		return []Suggestion{}, nil
+	}
+
+	var year []string
+	for m := target.AddDate(-1, 0, 0); m.Before(target); m = m.AddDate(0, 1, 0) {
+		year = append(year, m.Format("2006-01"))
+	}
+	hasYear := year[0] >= firstMonth
+
+	suggestions := []Suggestion{}
+	for _, cat := range categories {
+		if cat.MonthlyBudget == 0 {
+			continue
+		}
+
+		history := make([]MonthlySpent, len(window))
+		values := make([]float64, len(window))
+		for i, m := range window {
+			values[i] = spent[cat.ID][m]
+			history[i] = MonthlySpent{Month: m, Spent: round2(values[i])}
+		}
+
+		reasoning := RecommendationReasoning{
+			Method:   opts.Method,
+			Months:   history,
+			Baseline: round2(robustAverage(values, opts.Method)),
+			Budget:   cat.MonthlyBudget,
+		}
+		expected := reasoning.Baseline
+
+		if hasYear {
+			yearTotal := 0.0
+			for _, m := range year {
+				yearTotal += spent[cat.ID][m]
+			}
+			if average := yearTotal / 12; average > 0 {
+				factor := spent[cat.ID][year[0]] / average
+				if math.Abs(factor-1) >= seasonalThreshold {
+					factor = round2(math.Max(0.5, math.Min(2, factor)))
+					reasoning.SeasonalFactor = &factor
+					expected *= factor
+				}
+			}
+		}
+		reasoning.Expected = round2(expected)
+
+		delta := (expected - cat.MonthlyBudget) / cat.MonthlyBudget
+		reasoning.DeviationPercent = round2(delta * 100)
+		if math.Abs(delta) <= recommendationThreshold {
+			continue
+		}
+
+		action := "increase"
+		if expected < cat.MonthlyBudget {
+			action = "decrease"
+		}
+
+		suggestions = append(suggestions, Suggestion{
+			CategoryID: cat.ID,
+			Category:   string(cat.Name),
+			Action:     action,
+			Amount:     roundSuggestion(expected),
+			Confidence: recommendationConfidence(values, reasoning.Baseline, opts.Months),
+			Reasoning:  reasoning,
+		})
+	}
+
+	return suggestions, nil
+}
+
+// robustAverage summarises monthly spending so that a single unusual month
+// does not dominate.
+func robustAverage(values []float64, method string) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+
+	if method == recommendationMethodTrimmedMean {
+		// Drop the highest and lowest 20%
+		trim := n / 5
+		kept := sorted[trim : n-trim]
+		sum := 0.0
+		for _, v := range kept {
+			sum += v
+		}
+		return sum / float64(len(kept))
+	}
+
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// recommendationConfidence scores a suggestion by the share of the requested
+// window with history and by the spread of the monthly values around the
+// baseline (median absolute deviation relative to the baseline).
+func recommendationConfidence(values []float64, baseline float64, window int) float64 {
+	coverage := float64(len(values)) / float64(window)
+	if len(values) < 2 || baseline == 0 {
+		// A single month says nothing about variability
+		return round2(coverage * 0.5)
+	}
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - baseline)
+	}
+	spread := robustAverage(deviations, recommendationMethodMedian) / baseline
+	return round2(coverage / (1 + spread))
+}
+
+// roundSuggestion rounds a suggested budget based on its magnitude:
+// 10-99 → round to 10, 100-999 → round to 100, 1000-9999 → round to 1000.
+// Capped at 10,000 to avoid over-rounding very large numbers.
+func roundSuggestion(amount float64) float64 {
+	roundingFactor := 10.0
+	if amount >= 100 {
+		magnitude := math.Floor(math.Log10(amount))
+		roundingFactor = math.Pow(10, magnitude)
+		if roundingFactor > 10000 {
+			roundingFactor = 10000
+		}
+	}
+	return math.Round(amount/roundingFactor) * roundingFactor
+}
+
+// ============================================================================
+// RECOMMENDATION DECISIONS
+// ============================================================================
+
+// withoutDecided drops suggestions the household already acted on: snoozed
+// ones until the snooze ends, and accepted or dismissed ones while the
+// category budget is unchanged and the suggestion points the same way.
+func (h *Handlers) withoutDecided(householdID string, suggestions []Suggestion, target time.Time) ([]Suggestion, error) {
+	var decisions []RecommendationDecision
+	if err := h.db.Where("household_id = ?", householdID).Order("created_at ASC").Find(&decisions).Error; err != nil {
+		return nil, err
+	}
+	latest := make(map[string]RecommendationDecision, len(decisions))
+	for _, d := range decisions {
+		latest[d.CategoryID] = d
+	}
+
+	filtered := []Suggestion{}
+	for _, s := range suggestions {
+		d, ok := latest[s.CategoryID]
+		if ok {
+			switch d.Decision {
+			case "snoozed":
+				if d.SnoozedUntil != nil && target.Before(*d.SnoozedUntil) {
+					continue
+				}
+			default:
+				if d.Action == s.Action && d.Budget == s.Reasoning.Budget {
+					continue
+				}
+			}
+		}
+		filtered = append(filtered, s)
+	}
+	return filtered, nil
+}
+
+// currentSuggestion finds the suggestion currently made for a category,
+// writing an error response if there is none.
+func (h *Handlers) currentSuggestion(c *gin.Context) (*Suggestion, bool) {
+	householdID := c.Param("household_id")
+	categoryID := c.Param("category_id")
+
+	opts, ok := recommendationOptions(c)
+	if !ok {
+		return nil, false
+	}
+
+	var category Category
+	if err := h.db.Where("id = ? AND household_id = ?", categoryID, householdID).First(&category).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return nil, false
+	}
+
+	suggestions, err := h.buildRecommendations(householdID, opts, currentMonthStart())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute recommendations"})
+		return nil, false
+	}
+	for i := range suggestions {
+		if suggestions[i].CategoryID == categoryID {
+			return &suggestions[i], true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "No recommendation for this category"})
+	return nil, false
+}
+
+// AcceptRecommendation applies the suggested budget to the category and
+// records the decision in the same database transaction.
+func (h *Handlers) AcceptRecommendation(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	suggestion, ok := h.currentSuggestion(c)
+	if !ok {
+		return
+	}
+
+	var category Category
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Category{}).
+			Where("id = ? AND household_id = ?", suggestion.CategoryID, householdID).
+			Update("monthly_budget", suggestion.Amount).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&category, "id = ?", suggestion.CategoryID).Error; err != nil {
+			return err
+		}
+		return tx.Create(&RecommendationDecision{
+			ID:          uuid.New().String(),
+			HouseholdID: householdID,
+			CategoryID:  suggestion.CategoryID,
+			UserID:      c.GetString("user_id"),
+			Decision:    "accepted",
+			Action:      suggestion.Action,
+			Amount:      suggestion.Amount,
+			Budget:      suggestion.Amount,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept recommendation"})
+		return
+	}
+
+	h.publishEvent(householdID, EventCategoryUpdated, category)
+	c.JSON(http.StatusOK, category)
+}
+
+// DismissRecommendation hides the suggestion until the category budget
+// changes or the suggestion reverses direction.
+func (h *Handlers) DismissRecommendation(c *gin.Context) {
+	suggestion, ok := h.currentSuggestion(c)
+	if !ok {
+		return
+	}
+	h.recordDecision(c, suggestion, "dismissed", nil)
+}
+
+// SnoozeRecommendation hides the suggestion for a number of months (one by
+// default), after which it is shown again if it still applies.
+func (h *Handlers) SnoozeRecommendation(c *gin.Context) {
+	var input struct {
+		Months int `json:"months"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if input.Months == 0 {
+		input.Months = 1
+	}
+	if input.Months < 1 || input.Months > 12 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "months must be between 1 and 12"})
+		return
+	}
+
+	suggestion, ok := h.currentSuggestion(c)
+	if !ok {
+		return
+	}
+	until := currentMonthStart().AddDate(0, input.Months, 0)
+	h.recordDecision(c, suggestion, "snoozed", &until)
+}
+
+func (h *Handlers) recordDecision(c *gin.Context, suggestion *Suggestion, decision string, snoozedUntil *time.Time) {
+	record := RecommendationDecision{
+		ID:           uuid.New().String(),
+		HouseholdID:  c.Param("household_id"),
+		CategoryID:   suggestion.CategoryID,
+		UserID:       c.GetString("user_id"),
+		Decision:     decision,
+		Action:       suggestion.Action,
+		Amount:       suggestion.Amount,
+		Budget:       suggestion.Reasoning.Budget,
+		SnoozedUntil: snoozedUntil,
+	}
+	if err := h.db.Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save decision"})
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
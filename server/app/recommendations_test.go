@@ -0,0 +1,202 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRecommendations_ResistsOutliers(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-reco"
+	target := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	db.Create(&Category{ID: "cat-food", Name: "Food", HouseholdID: householdID, MonthlyBudget: 200, IsActive: true})
+	db.Create(&Category{ID: "cat-fun", Name: "Fun", HouseholdID: householdID, MonthlyBudget: 100, IsActive: true})
+	db.Create(&Category{ID: "cat-old", Name: "Old", HouseholdID: householdID, MonthlyBudget: 100})
+	db.Model(&Category{}).Where("id = ?", "cat-old").Update("is_active", false)
+
+	food := []float64{210, 190, 1000, 200, 205, 195} // one unusual month
+	fun := []float64{150, 160, 140, 155, 150, 30}
+	for i := range food {
+		date := target.AddDate(0, i-6, 3)
+		db.Create(&Transaction{ID: fmt.Sprintf("food-%d", i), HouseholdID: householdID, CategoryID: "cat-food", Amount: food[i], Date: date})
+		db.Create(&Transaction{ID: fmt.Sprintf("fun-%d", i), HouseholdID: householdID, CategoryID: "cat-fun", Amount: fun[i], Date: date})
+		db.Create(&Transaction{ID: fmt.Sprintf("old-%d", i), HouseholdID: householdID, CategoryID: "cat-old", Amount: 500, Date: date})
+	}
+
+	suggestions, err := h.buildRecommendations(householdID, RecommendationOptions{Months: 6, Method: recommendationMethodMedian}, target)
+	require.NoError(t, err)
+
+	// Food's median is on budget; the inactive category is ignored
+	require.Len(t, suggestions, 1)
+	s := suggestions[0]
+	assert.Equal(t, "cat-fun", s.CategoryID)
+	assert.Equal(t, "increase", s.Action)
+	assert.Equal(t, 200.0, s.Amount)
+	assert.Equal(t, 150.0, s.Reasoning.Baseline)
+	assert.Equal(t, 150.0, s.Reasoning.Expected)
+	assert.Equal(t, 50.0, s.Reasoning.DeviationPercent)
+	assert.Nil(t, s.Reasoning.SeasonalFactor)
+	require.Len(t, s.Reasoning.Months, 6)
+	assert.Equal(t, MonthlySpent{Month: "2024-01", Spent: 150}, s.Reasoning.Months[0])
+	// Median absolute deviation is 7.5 on a baseline of 150
+	assert.Equal(t, 0.95, s.Confidence)
+
+	// The trimmed mean drops the lowest and highest month
+	suggestions, err = h.buildRecommendations(householdID, RecommendationOptions{Months: 6, Method: recommendationMethodTrimmedMean}, target)
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, 148.75, suggestions[0].Reasoning.Baseline)
+
+	// Asking for a longer window than the history lowers confidence
+	suggestions, err = h.buildRecommendations(householdID, RecommendationOptions{Months: 12, Method: recommendationMethodMedian}, target)
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Len(t, suggestions[0].Reasoning.Months, 6)
+	assert.Equal(t, 0.48, suggestions[0].Confidence)
+}
+
+func TestBuildRecommendations_Seasonality(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-season"
+	target := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	db.Create(&Category{ID: "cat-gifts", Name: "Gifts", HouseholdID: householdID, MonthlyBudget: 100, IsActive: true})
+
+	// Gifts spending is flat except for a big December
+	for i := 1; i <= 12; i++ {
+		amount := 100.0
+		if i == 1 {
+			amount = 320
+		}
+		db.Create(&Transaction{ID: fmt.Sprintf("t-%d", i), HouseholdID: householdID, CategoryID: "cat-gifts", Amount: amount, Date: target.AddDate(0, i-13, 5)})
+	}
+
+	suggestions, err := h.buildRecommendations(householdID, RecommendationOptions{Months: 6, Method: recommendationMethodMedian}, target)
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+
+	s := suggestions[0]
+	assert.Equal(t, 100.0, s.Reasoning.Baseline)
+	require.NotNil(t, s.Reasoning.SeasonalFactor)
+	assert.Equal(t, 2.0, *s.Reasoning.SeasonalFactor) // 320 / 118.33, capped
+	assert.Equal(t, 200.0, s.Reasoning.Expected)
+	assert.Equal(t, "increase", s.Action)
+	assert.Equal(t, 200.0, s.Amount)
+}
+
+func TestGetRecommendations_InvalidOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+
+	r := gin.Default()
+	r.GET("/households/:household_id/recommendations", h.GetRecommendations)
+
+	for _, url := range []string{
+		"/households/hh/recommendations?months=0",
+		"/households/hh/recommendations?months=abc",
+		"/households/hh/recommendations?method=mean",
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+}
+
+func TestRecommendationDecisions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-decisions"
+	lastMonth := currentMonthStart().AddDate(0, -1, 0).Add(12 * time.Hour)
+
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: householdID, MonthlyBudget: 500, IsActive: true})
+	db.Create(&Category{ID: "cat-2", Name: "Games", HouseholdID: householdID, MonthlyBudget: 100, IsActive: true})
+	db.Create(&Category{ID: "cat-3", Name: "Fuel", HouseholdID: householdID, MonthlyBudget: 100, IsActive: true})
+	db.Create(&Transaction{ID: "t1", HouseholdID: householdID, CategoryID: "cat-1", Amount: 600, Date: lastMonth})
+	db.Create(&Transaction{ID: "t2", HouseholdID: householdID, CategoryID: "cat-2", Amount: 50, Date: lastMonth})
+	db.Create(&Transaction{ID: "t3", HouseholdID: householdID, CategoryID: "cat-3", Amount: 300, Date: lastMonth})
+
+	r := gin.Default()
+	r.GET("/households/:household_id/recommendations", h.GetRecommendations)
+	r.POST("/households/:household_id/recommendations/:category_id/accept", h.AcceptRecommendation)
+	r.POST("/households/:household_id/recommendations/:category_id/dismiss", h.DismissRecommendation)
+	r.POST("/households/:household_id/recommendations/:category_id/snooze", h.SnoozeRecommendation)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/households/"+householdID+"/recommendations/"+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	suggested := func() []string {
+		req, _ := http.NewRequest("GET", "/households/"+householdID+"/recommendations", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Suggestions []Suggestion `json:"suggestions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		var ids []string
+		for _, s := range resp.Suggestions {
+			ids = append(ids, s.CategoryID)
+		}
+		return ids
+	}
+	assert.ElementsMatch(t, []string{"cat-1", "cat-2", "cat-3"}, suggested())
+
+	// Accepting applies the suggested budget
+	events, cancel := h.events.Subscribe(householdID)
+	defer cancel()
+	w := post("cat-3/accept", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var category Category
+	require.NoError(t, db.First(&category, "id = ?", "cat-3").Error)
+	assert.Equal(t, 300.0, category.MonthlyBudget)
+	event := <-events
+	assert.Equal(t, EventCategoryUpdated, event.Type)
+	assert.Equal(t, 300.0, event.Data.(Category).MonthlyBudget)
+
+	w = post("cat-2/dismiss", "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = post("cat-1/snooze", `{"months": 2}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var decision RecommendationDecision
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &decision))
+	assert.Equal(t, "snoozed", decision.Decision)
+	require.NotNil(t, decision.SnoozedUntil)
+	assert.True(t, decision.SnoozedUntil.Equal(currentMonthStart().AddDate(0, 2, 0)))
+
+	assert.Empty(t, suggested())
+
+	// Nothing left to act on
+	assert.Equal(t, http.StatusNotFound, post("cat-3/accept", "").Code)
+	assert.Equal(t, http.StatusNotFound, post("missing/dismiss", "").Code)
+	assert.Equal(t, http.StatusBadRequest, post("cat-1/snooze", `{"months": 13}`).Code)
+
+	// A dismissed suggestion comes back once the budget changes
+	db.Model(&Category{}).Where("id = ?", "cat-2").Update("monthly_budget", 90)
+	assert.Equal(t, []string{"cat-2"}, suggested())
+
+	// A snoozed suggestion comes back when the snooze ends
+	suggestions, err := h.buildRecommendations(householdID, RecommendationOptions{Months: 6, Method: recommendationMethodMedian}, currentMonthStart())
+	require.NoError(t, err)
+	later, err := h.withoutDecided(householdID, suggestions, currentMonthStart().AddDate(0, 2, 0))
+	require.NoError(t, err)
+	assert.Len(t, later, 2)
+}
@@ -0,0 +1,524 @@
+package app
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxTrendMonths bounds the range of the trends endpoint and of summary
+// exports.
+const maxTrendMonths = 36
+
+// monthBucket returns a SQL expression truncating the transaction date to a
+// "YYYY-MM" string, for the dialect in use.
+func monthBucket(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return "to_char(date, 'YYYY-MM')"
+	}
+	return "strftime('%Y-%m', date)"
+}
+
+// round2 rounds an amount to cents.
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ============================================================================
+// TRENDS
+// ============================================================================
+
+type TrendPoint struct {
+	Month         string   `json:"month"`
+	Budget        float64  `json:"budget"`
+	Spent         float64  `json:"spent"`
+	Remaining     float64  `json:"remaining"`
+	MovingAverage float64  `json:"moving_average"`
+	Delta         float64  `json:"delta"`
+	DeltaPercent  *float64 `json:"delta_percent"`
+}
+
+type CategoryTrend struct {
+	ID     string       `json:"id"`
+	Name   string       `json:"name"`
+	Budget float64      `json:"budget"`
+	Points []TrendPoint `json:"points"`
+}
+
+type TrendsResponse struct {
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Window     int             `json:"window"`
+	Months     []string        `json:"months"`
+	Categories []CategoryTrend `json:"categories"`
+	Totals     []TrendPoint    `json:"totals"`
+}
+
+// GetTrends returns budget vs. spent per category and in total for a range
+// of months, computed from a single aggregated query. Each point carries the
+// moving average over the trailing `window` months and the change against
+// the previous month.
+func (h *Handlers) GetTrends(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	// Defaults to the last 12 months, including the current one
+	month := currentMonthStart()
+	start, end, err := parseDateRange(c, "2006-01", month.AddDate(0, -11, 0), month.AddDate(0, 1, 0))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month range. Use from/to as YYYY-MM"})
+		return
+	}
+
+	window, err := strconv.Atoi(c.DefaultQuery("window", "3"))
+	if err != nil || window < 1 || window > 12 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "window must be between 1 and 12"})
+		return
+	}
+
+	var months []string
+	for m := start; m.Before(end); m = m.AddDate(0, 1, 0) {
+		months = append(months, m.Format("2006-01"))
+	}
+	if len(months) > maxTrendMonths {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Range too large. Maximum is 36 months"})
+		return
+	}
+
+	var categories []Category
+	if err := h.db.Where("household_id = ?", householdID).Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	// Look back far enough for the first months' moving averages and deltas
+	lookback := window - 1
+	if lookback < 1 {
+		lookback = 1
+	}
+	queryStart := start.AddDate(0, -lookback, 0)
+
+	var rows []struct {
+		CategoryID string
+		Month      string
+		Spent      float64
+	}
+	bucket := monthBucket(h.db)
+	if err := h.db.Model(&Transaction{}).
+		Select("category_id, "+bucket+" AS month, COALESCE(SUM(amount), 0) AS spent").
+		Where("household_id = ? AND date >= ? AND date < ?", householdID, queryStart, end).
+		Group("category_id, " + bucket).
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
+		return
+	}
+
+	spent := map[string]map[string]float64{}
+	for _, r := range rows {
+		if spent[r.CategoryID] == nil {
+			spent[r.CategoryID] = map[string]float64{}
+		}
+		spent[r.CategoryID][r.Month] = r.Spent
+	}
+
+	var allMonths []string
+	for m := queryStart; m.Before(end); m = m.AddDate(0, 1, 0) {
+		allMonths = append(allMonths, m.Format("2006-01"))
+	}
+
+	response := TrendsResponse{
+		From:       start.Format("2006-01"),
+		To:         end.AddDate(0, -1, 0).Format("2006-01"),
+		Window:     window,
+		Months:     months,
+		Categories: []CategoryTrend{},
+	}
+
+	totalBudget := 0.0
+	totalSpent := make([]float64, len(allMonths))
+	for _, cat := range categories {
+		series := make([]float64, len(allMonths))
+		for i, m := range allMonths {
+			series[i] = spent[cat.ID][m]
+			totalSpent[i] += series[i]
+		}
+		totalBudget += cat.MonthlyBudget
+
+		response.Categories = append(response.Categories, CategoryTrend{
+			ID:     cat.ID,
+			Name:   string(cat.Name),
+			Budget: cat.MonthlyBudget,
+			Points: trendPoints(allMonths, series, cat.MonthlyBudget, window, lookback),
+		})
+	}
+	response.Totals = trendPoints(allMonths, totalSpent, totalBudget, window, lookback)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// trendPoints turns a monthly spending series into trend points, skipping
+// the first `skip` months which are only used as lookback.
+func trendPoints(months []string, series []float64, budget float64, window, skip int) []TrendPoint {
+	points := make([]TrendPoint, 0, len(months)-skip)
+	for i := skip; i < len(months); i++ {
+		from := i - window + 1
+		if from < 0 {
+			from = 0
+		}
+		sum := 0.0
+		for _, v := range series[from : i+1] {
+			sum += v
+		}
+
+		point := TrendPoint{
+			Month:         months[i],
+			Budget:        budget,
+			Spent:         round2(series[i]),
+			Remaining:     round2(budget - series[i]),
+			MovingAverage: round2(sum / float64(i+1-from)),
+		}
+		if i > 0 {
+			prev := series[i-1]
+			point.Delta = round2(series[i] - prev)
+			if prev != 0 {
+				pct := round2((series[i] - prev) / prev * 100)
+				point.DeltaPercent = &pct
+			}
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+// ============================================================================
+// MEMBER BREAKDOWN
+// ============================================================================
+
+type SpendingShare struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Total float64 `json:"total"`
+	Share float64 `json:"share"` // percentage of the parent total
+}
+
+type MemberSpending struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Color      string          `json:"color"`
+	PictureURL string          `json:"picture_url"`
+	Total      float64         `json:"total"`
+	Share      float64         `json:"share"`
+	Categories []SpendingShare `json:"categories"`
+	Accounts   []SpendingShare `json:"accounts"`
+}
+
+type MemberReport struct {
+	From       string           `json:"from"`
+	To         string           `json:"to"`
+	CategoryID string           `json:"category_id,omitempty"`
+	Total      float64          `json:"total"`
+	Members    []MemberSpending `json:"members"`
+}
+
+// spendingGroup is a row of spending aggregated by member, category and
+// account.
+type spendingGroup struct {
+	UserID     string
+	CategoryID string
+	AccountID  string
+	Total      float64
+}
+
+// spendingGroups aggregates the household's spending in [start, end),
+// optionally restricted to one category.
+func (h *Handlers) spendingGroups(householdID string, start, end time.Time, categoryID string) ([]spendingGroup, error) {
+	query := h.db.Model(&Transaction{}).
+		Select("user_id, category_id, account_id, COALESCE(SUM(amount), 0) AS total").
+		Where("household_id = ? AND date >= ? AND date < ?", householdID, start, end)
+	if categoryID != "" {
+		query = query.Where("category_id = ?", categoryID)
+	}
+	var groups []spendingGroup
+	err := query.Group("user_id, category_id, account_id").Scan(&groups).Error
+	return groups, err
+}
+
+// reportCategoryNames returns the names of the household's categories,
+// including deleted ones still referenced by past transactions.
+func (h *Handlers) reportCategoryNames(householdID string) (map[string]string, error) {
+	var categories []Category
+	if err := h.db.Unscoped().Where("household_id = ?", householdID).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(categories))
+	for _, cat := range categories {
+		names[cat.ID] = string(cat.Name)
+	}
+	return names, nil
+}
+
+// reportAccountNames returns the display names of the household's accounts,
+// including deleted ones still referenced by past transactions.
+func (h *Handlers) reportAccountNames(householdID string) (map[string]string, error) {
+	var accounts []Account
+	if err := h.db.Unscoped().Where("household_id = ?", householdID).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(accounts))
+	for i := range accounts {
+		h.populateAccountDisplayName(&accounts[i])
+		names[accounts[i].ID] = accounts[i].DisplayName
+	}
+	return names, nil
+}
+
+// share returns part as a percentage of total.
+func share(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return round2(part / total * 100)
+}
+
+// shares turns totals keyed by ID into a list sorted by descending total.
+func shares(totals map[string]float64, names map[string]string, total float64) []SpendingShare {
+	list := make([]SpendingShare, 0, len(totals))
+	for id, v := range totals {
+		list = append(list, SpendingShare{ID: id, Name: names[id], Total: round2(v), Share: share(v, total)})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total != list[j].Total {
+			return list[i].Total > list[j].Total
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// GetMemberReport breaks down the household's spending by member over a
+// date range (the current month by default), with each member's spending
+// per category and per account. Passing category_id drills down into a
+// single category.
+func (h *Handlers) GetMemberReport(c *gin.Context) {
+	householdID := c.Param("household_id")
+	categoryID := c.Query("category_id")
+
+	month := currentMonthStart()
+	start, end, err := parseDateRange(c, "2006-01-02", month, month.AddDate(0, 1, 0))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range. Use from/to as YYYY-MM-DD"})
+		return
+	}
+
+	if categoryID != "" {
+		var category Category
+		if err := h.db.Where("id = ? AND household_id = ?", categoryID, householdID).First(&category).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+	}
+
+	report, err := h.buildMemberReport(householdID, start, end, categoryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// buildMemberReport aggregates spending in [start, end) by member,
+// optionally restricted to one category.
+func (h *Handlers) buildMemberReport(householdID string, start, end time.Time, categoryID string) (MemberReport, error) {
+	groups, err := h.spendingGroups(householdID, start, end, categoryID)
+	if err != nil {
+		return MemberReport{}, err
+	}
+	categoryNames, err := h.reportCategoryNames(householdID)
+	if err != nil {
+		return MemberReport{}, err
+	}
+	accountNames, err := h.reportAccountNames(householdID)
+	if err != nil {
+		return MemberReport{}, err
+	}
+
+	// Current members are listed even if they spent nothing; former members
+	// only if they have transactions in the range.
+	var users []User
+	if err := h.db.Unscoped().
+		Where("deleted_at IS NULL AND id IN (?)", memberIDs(h.db, householdID)).
+		Or("id IN (?)", h.db.Model(&Transaction{}).Select("user_id").Where("household_id = ? AND date >= ? AND date < ?", householdID, start, end)).
+		Find(&users).Error; err != nil {
+		return MemberReport{}, err
+	}
+
+	type memberTotals struct {
+		total      float64
+		categories map[string]float64
+		accounts   map[string]float64
+	}
+	byMember := map[string]*memberTotals{}
+	for _, u := range users {
+		byMember[u.ID] = &memberTotals{categories: map[string]float64{}, accounts: map[string]float64{}}
+	}
+	total := 0.0
+	for _, g := range groups {
+		m, ok := byMember[g.UserID]
+		if !ok {
+			// Spending not attributed to a known user
+			m = &memberTotals{categories: map[string]float64{}, accounts: map[string]float64{}}
+			byMember[g.UserID] = m
+		}
+		m.total += g.Total
+		m.categories[g.CategoryID] += g.Total
+		m.accounts[g.AccountID] += g.Total
+		total += g.Total
+	}
+
+	report := MemberReport{
+		From:       start.Format("2006-01-02"),
+		To:         end.AddDate(0, 0, -1).Format("2006-01-02"),
+		CategoryID: categoryID,
+		Total:      round2(total),
+		Members:    []MemberSpending{},
+	}
+
+	known := make(map[string]User, len(users))
+	for _, u := range users {
+		known[u.ID] = u
+	}
+	for id, m := range byMember {
+		u := known[id]
+		report.Members = append(report.Members, MemberSpending{
+			ID:         id,
+			Name:       string(u.Name),
+			Color:      u.Color,
+			PictureURL: u.PictureURL,
+			Total:      round2(m.total),
+			Share:      share(m.total, total),
+			Categories: shares(m.categories, categoryNames, m.total),
+			Accounts:   shares(m.accounts, accountNames, m.total),
+		})
+	}
+	sort.Slice(report.Members, func(i, j int) bool {
+		if report.Members[i].Total != report.Members[j].Total {
+			return report.Members[i].Total > report.Members[j].Total
+		}
+		return report.Members[i].ID < report.Members[j].ID
+	})
+
+	return report, nil
+}
+
+// ============================================================================
+// ACCOUNT BREAKDOWN
+// ============================================================================
+
+type AccountSpending struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Total      float64         `json:"total"`
+	Share      float64         `json:"share"`
+	Categories []SpendingShare `json:"categories"`
+}
+
+type AccountReport struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Total    float64           `json:"total"`
+	Accounts []AccountSpending `json:"accounts"`
+}
+
+// GetAccountReport breaks down the household's spending by account over a
+// date range (the current month by default), with each account's spending
+// per category.
+func (h *Handlers) GetAccountReport(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	month := currentMonthStart()
+	start, end, err := parseDateRange(c, "2006-01-02", month, month.AddDate(0, 1, 0))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range. Use from/to as YYYY-MM-DD"})
+		return
+	}
+
+	groups, err := h.spendingGroups(householdID, start, end, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
+		return
+	}
+	categoryNames, err := h.reportCategoryNames(householdID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	// Current accounts are listed even if unused; deleted accounts only if
+	// they have transactions in the range.
+	var accounts []Account
+	if err := h.db.Unscoped().
+		Where("household_id = ? AND deleted_at IS NULL", householdID).
+		Or("id IN (?)", h.db.Model(&Transaction{}).Select("account_id").Where("household_id = ? AND date >= ? AND date < ?", householdID, start, end)).
+		Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+		return
+	}
+
+	type accountTotals struct {
+		total      float64
+		categories map[string]float64
+	}
+	byAccount := map[string]*accountTotals{}
+	for _, a := range accounts {
+		byAccount[a.ID] = &accountTotals{categories: map[string]float64{}}
+	}
+	total := 0.0
+	for _, g := range groups {
+		a, ok := byAccount[g.AccountID]
+		if !ok {
+			a = &accountTotals{categories: map[string]float64{}}
+			byAccount[g.AccountID] = a
+		}
+		a.total += g.Total
+		a.categories[g.CategoryID] += g.Total
+		total += g.Total
+	}
+
+	known := make(map[string]Account, len(accounts))
+	for i := range accounts {
+		h.populateAccountDisplayName(&accounts[i])
+		known[accounts[i].ID] = accounts[i]
+	}
+
+	report := AccountReport{
+		From:     start.Format("2006-01-02"),
+		To:       end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Total:    round2(total),
+		Accounts: []AccountSpending{},
+	}
+	for id, a := range byAccount {
+		account := known[id]
+		report.Accounts = append(report.Accounts, AccountSpending{
+			ID:         id,
+			Name:       account.DisplayName,
+			Type:       account.Type,
+			Total:      round2(a.total),
+			Share:      share(a.total, total),
+			Categories: shares(a.categories, categoryNames, a.total),
+		})
+	}
+	sort.Slice(report.Accounts, func(i, j int) bool {
+		if report.Accounts[i].Total != report.Accounts[j].Total {
+			return report.Accounts[i].Total > report.Accounts[j].Total
+		}
+		return report.Accounts[i].ID < report.Accounts[j].ID
+	})
+
+	c.JSON(http.StatusOK, report)
+}
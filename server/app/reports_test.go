@@ -0,0 +1,238 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTrends(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-trends"
+
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: householdID, MonthlyBudget: 100})
+	db.Create(&Category{ID: "cat-2", Name: "Fun", HouseholdID: householdID, MonthlyBudget: 50})
+
+	month := func(m time.Month, day int) time.Time { return time.Date(2024, m, day, 12, 0, 0, 0, time.UTC) }
+	db.Create(&Transaction{ID: "t0", HouseholdID: householdID, CategoryID: "cat-1", Amount: 60, Date: month(1, 10)}) // lookback only
+	db.Create(&Transaction{ID: "t1", HouseholdID: householdID, CategoryID: "cat-1", Amount: 80, Date: month(2, 3)})
+	db.Create(&Transaction{ID: "t2", HouseholdID: householdID, CategoryID: "cat-1", Amount: 40, Date: month(2, 20)})
+	db.Create(&Transaction{ID: "t3", HouseholdID: householdID, CategoryID: "cat-1", Amount: 90, Date: month(3, 1)})
+	db.Create(&Transaction{ID: "t4", HouseholdID: householdID, CategoryID: "cat-2", Amount: 25, Date: month(3, 31)})
+	db.Create(&Transaction{ID: "t5", HouseholdID: "other", CategoryID: "cat-1", Amount: 999, Date: month(3, 5)})
+
+	r := gin.Default()
+	r.GET("/households/:household_id/trends", h.GetTrends)
+
+	req, _ := http.NewRequest("GET", "/households/"+householdID+"/trends?from=2024-02&to=2024-04&window=2", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp TrendsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"2024-02", "2024-03", "2024-04"}, resp.Months)
+	require.Len(t, resp.Categories, 2)
+
+	var food CategoryTrend
+	for _, cat := range resp.Categories {
+		if cat.ID == "cat-1" {
+			food = cat
+		}
+	}
+	require.Len(t, food.Points, 3)
+
+	feb := food.Points[0]
+	assert.Equal(t, 120.0, feb.Spent)
+	assert.Equal(t, -20.0, feb.Remaining)
+	assert.Equal(t, 90.0, feb.MovingAverage) // (60 + 120) / 2
+	assert.Equal(t, 60.0, feb.Delta)
+	require.NotNil(t, feb.DeltaPercent)
+	assert.Equal(t, 100.0, *feb.DeltaPercent)
+
+	apr := food.Points[2]
+	assert.Equal(t, 0.0, apr.Spent)
+	assert.Equal(t, 45.0, apr.MovingAverage)
+	assert.Equal(t, -90.0, apr.Delta)
+
+	require.Len(t, resp.Totals, 3)
+	assert.Equal(t, 150.0, resp.Totals[1].Budget)
+	assert.Equal(t, 115.0, resp.Totals[1].Spent)
+	assert.Equal(t, -5.0, resp.Totals[1].Delta)
+}
+
+func TestGetTrends_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+
+	r := gin.Default()
+	r.GET("/households/:household_id/trends", h.GetTrends)
+
+	for _, url := range []string{
+		"/households/hh/trends?from=2024",
+		"/households/hh/trends?window=0",
+		"/households/hh/trends?from=2020-01&to=2024-01",
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+
+	req, _ := http.NewRequest("GET", "/households/hh/trends", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp TrendsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Months, 12)
+
+	// With only an end, the 12 months before it
+	req, _ = http.NewRequest("GET", "/households/hh/trends?to=2020-06", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Months, 12)
+	assert.Equal(t, "2019-07", resp.Months[0])
+	assert.Equal(t, "2020-06", resp.Months[11])
+}
+
+func TestGetMemberReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-members"
+
+	db.Create(&User{ID: "u1", Name: "Alice", Email: "alice@example.com", Color: "#ff0000", HouseholdID: householdID})
+	db.Create(&User{ID: "u2", Name: "Bob", Email: "bob@example.com", Color: "#00ff00", HouseholdID: householdID})
+	db.Create(&User{ID: "u3", Name: "Carol", Email: "carol@example.com", HouseholdID: householdID})
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: householdID})
+	db.Create(&Category{ID: "cat-2", Name: "Fun", HouseholdID: householdID})
+	db.Create(&Account{ID: "acc-cash", Type: "cash", Name: "Cash", HouseholdID: householdID})
+	db.Create(&Account{ID: "acc-card", Type: "card", Brand: ptrSecret("Visa"), HouseholdID: householdID})
+
+	date := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	db.Create(&Transaction{ID: "t1", HouseholdID: householdID, UserID: "u1", CategoryID: "cat-1", AccountID: "acc-cash", Amount: 30, Date: date})
+	db.Create(&Transaction{ID: "t2", HouseholdID: householdID, UserID: "u1", CategoryID: "cat-2", AccountID: "acc-card", Amount: 10, Date: date})
+	db.Create(&Transaction{ID: "t3", HouseholdID: householdID, UserID: "u2", CategoryID: "cat-1", AccountID: "acc-card", Amount: 60, Date: date})
+	db.Create(&Transaction{ID: "t4", HouseholdID: householdID, UserID: "u2", CategoryID: "cat-1", AccountID: "acc-card", Amount: 500, Date: date.AddDate(0, 1, 0)})
+
+	// Former member with spending in the range
+	db.Create(&User{ID: "u4", Name: "Dave", Email: "dave@example.com", HouseholdID: householdID})
+	db.Create(&Transaction{ID: "t5", HouseholdID: householdID, UserID: "u4", CategoryID: "cat-2", AccountID: "acc-cash", Amount: 20, Date: date})
+	db.Delete(&User{ID: "u4"})
+
+	r := gin.Default()
+	r.GET("/households/:household_id/reports/members", h.GetMemberReport)
+
+	req, _ := http.NewRequest("GET", "/households/"+householdID+"/reports/members?from=2024-05-01&to=2024-05-31", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var report MemberReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 120.0, report.Total)
+	require.Len(t, report.Members, 4)
+
+	bob := report.Members[0]
+	assert.Equal(t, "u2", bob.ID)
+	assert.Equal(t, "Bob", bob.Name)
+	assert.Equal(t, "#00ff00", bob.Color)
+	assert.Equal(t, 60.0, bob.Total)
+	assert.Equal(t, 50.0, bob.Share)
+	assert.Equal(t, []SpendingShare{{ID: "cat-1", Name: "Food", Total: 60, Share: 100}}, bob.Categories)
+	assert.Equal(t, []SpendingShare{{ID: "acc-card", Name: "Visa", Total: 60, Share: 100}}, bob.Accounts)
+
+	alice := report.Members[1]
+	assert.Equal(t, 40.0, alice.Total)
+	assert.Equal(t, 33.33, alice.Share)
+	assert.Equal(t, []SpendingShare{
+		{ID: "cat-1", Name: "Food", Total: 30, Share: 75},
+		{ID: "cat-2", Name: "Fun", Total: 10, Share: 25},
+	}, alice.Categories)
+
+	assert.Equal(t, "Dave", report.Members[2].Name)
+	assert.Equal(t, 20.0, report.Members[2].Total)
+	assert.Equal(t, "Carol", report.Members[3].Name)
+	assert.Equal(t, 0.0, report.Members[3].Total)
+
+	// Drill down into a single category
+	req, _ = http.NewRequest("GET", "/households/"+householdID+"/reports/members?from=2024-05-01&to=2024-05-31&category_id=cat-2", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 30.0, report.Total)
+	assert.Equal(t, "Dave", report.Members[0].Name)
+	assert.Equal(t, 66.67, report.Members[0].Share)
+
+	req, _ = http.NewRequest("GET", "/households/"+householdID+"/reports/members?category_id=missing", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetAccountReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	householdID := "hh-accounts"
+
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: householdID})
+	db.Create(&Category{ID: "cat-2", Name: "Fun", HouseholdID: householdID})
+	db.Create(&Account{ID: "acc-cash", Type: "cash", Name: "Cash", HouseholdID: householdID})
+	db.Create(&Account{ID: "acc-card", Type: "card", Brand: ptrSecret("Visa"), Bank: ptrSecret("ACME"), HouseholdID: householdID})
+	db.Create(&Account{ID: "acc-bank", Type: "bank", Name: "Savings", HouseholdID: householdID})
+
+	date := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	db.Create(&Transaction{ID: "t1", HouseholdID: householdID, CategoryID: "cat-1", AccountID: "acc-card", Amount: 45, Date: date})
+	db.Create(&Transaction{ID: "t2", HouseholdID: householdID, CategoryID: "cat-2", AccountID: "acc-card", Amount: 15, Date: date})
+	db.Create(&Transaction{ID: "t3", HouseholdID: householdID, CategoryID: "cat-1", AccountID: "acc-cash", Amount: 20, Date: date})
+	db.Create(&Transaction{ID: "t4", HouseholdID: householdID, CategoryID: "cat-1", AccountID: "acc-cash", Amount: 99, Date: date.AddDate(0, -1, 0)})
+
+	r := gin.Default()
+	r.GET("/households/:household_id/reports/accounts", h.GetAccountReport)
+
+	req, _ := http.NewRequest("GET", "/households/"+householdID+"/reports/accounts?from=2024-05-01&to=2024-05-31", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var report AccountReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 80.0, report.Total)
+	require.Len(t, report.Accounts, 3)
+
+	card := report.Accounts[0]
+	assert.Equal(t, "Visa - ACME", card.Name)
+	assert.Equal(t, "card", card.Type)
+	assert.Equal(t, 60.0, card.Total)
+	assert.Equal(t, 75.0, card.Share)
+	assert.Equal(t, []SpendingShare{
+		{ID: "cat-1", Name: "Food", Total: 45, Share: 75},
+		{ID: "cat-2", Name: "Fun", Total: 15, Share: 25},
+	}, card.Categories)
+
+	assert.Equal(t, "Cash", report.Accounts[1].Name)
+	assert.Equal(t, 20.0, report.Accounts[1].Total)
+	assert.Equal(t, "Savings", report.Accounts[2].Name)
+	assert.Equal(t, 0.0, report.Accounts[2].Total)
+	assert.Empty(t, report.Accounts[2].Categories)
+
+	req, _ = http.NewRequest("GET", "/households/"+householdID+"/reports/accounts?from=2024-05-31&to=2024-05-01", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
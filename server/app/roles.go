@@ -0,0 +1,135 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// roleRanks orders the roles by what they are allowed to do.
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// errLastOwner rolls back changes that would leave a household without
+// owners.
+var errLastOwner = errors.New("household needs an owner")
+
+// hasRole tells whether role allows what required does.
+func hasRole(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
+// requiresRole is the error for members without the required role.
+func requiresRole(role string) *requestError {
+	return &requestError{status: http.StatusForbidden, message: "Requires the " + role + " role"}
+}
+
+// PermissionMiddleware makes the household read-only for viewers. It runs
+// after JWTMiddleware, which sets the member's role.
+func (h *Handlers) PermissionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+		default:
+			h.RequireRole(RoleMember)(c)
+		}
+	}
+}
+
+// RequireRole only lets members with at least the given role through.
+func (h *Handlers) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasRole(c.GetString("role"), role) {
+			requiresRole(role).respond(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ensureOwner fails with errLastOwner if the household has no owners left.
+// Users who deleted their account do not count.
+func ensureOwner(tx *gorm.DB, householdID string) error {
+	var owners int64
+	liveUsers := tx.Session(&gorm.Session{NewDB: true}).Model(&User{}).Select("id")
+	err := tx.Model(&Membership{}).
+		Where("household_id = ? AND role = ? AND user_id IN (?)", householdID, RoleOwner, liveUsers).
+		Count(&owners).Error
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+// lastOwnerError is the error for changes that would leave the household
+// without owners.
+func lastOwnerError() *requestError {
+	return &requestError{status: http.StatusConflict, message: "A household needs at least one owner"}
+}
+
+// UpdateMemberRole changes the role of a member. Only owners can make or
+// change owners, and the last owner cannot step down.
+func (h *Handlers) UpdateMemberRole(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if roleRanks[req.Role] == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be owner, admin, member or viewer"})
+		return
+	}
+
+	var membership Membership
+	if err := h.db.Where("user_id = ? AND household_id = ?", c.Param("user_id"), householdID).First(&membership).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	var user User
+	if err := h.db.First(&user, "id = ?", membership.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	if (membership.Role == RoleOwner || req.Role == RoleOwner) && c.GetString("role") != RoleOwner {
+		requiresRole(RoleOwner).respond(c)
+		return
+	}
+	if membership.Role == req.Role {
+		c.JSON(http.StatusOK, activeMember(user, membership.Role))
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&membership).Update("role", req.Role).Error; err != nil {
+			return err
+		}
+		return ensureOwner(tx, householdID)
+	})
+	if errors.Is(err, errLastOwner) {
+		lastOwnerError().respond(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	member := activeMember(user, req.Role)
+	h.publishEvent(householdID, EventMemberUpdated, member)
+	c.JSON(http.StatusOK, member)
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	cfg.JWTSecret = "test_secret"
+	h := NewHandlers(db, cfg)
+
+	r := gin.New()
+	g := r.Group("/households/:household_id")
+	g.Use(h.JWTMiddleware(), h.PermissionMiddleware())
+	admin := h.RequireRole(RoleAdmin)
+	g.GET("/members", h.GetMembers)
+	g.DELETE("/members/:user_id", admin, h.RemoveMember)
+	g.PUT("/members/:user_id/role", admin, h.UpdateMemberRole)
+	g.POST("/accounts", admin, h.CreateAccount)
+	g.POST("/transactions", h.CreateTransaction)
+	g.POST("/batch", h.ApplyBatch)
+
+	householdID := "hh-roles"
+	db.Create(&Household{ID: householdID, Name: "Home"})
+	db.Create(&Category{ID: "cat-1", Name: "Food", MonthlyBudget: 100, HouseholdID: householdID})
+	tokens := map[string]string{}
+	for _, id := range []string{"parent", "partner", "kid"} {
+		user := User{ID: id, Name: SecretString(id), Email: SecretString(id + "@example.com"), HouseholdID: householdID}
+		require.NoError(t, db.Create(&user).Error)
+		token, err := h.generateJWT(user)
+		require.NoError(t, err)
+		tokens[id] = token
+	}
+
+	do := func(as, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/households/"+householdID+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tokens[as])
+		r.ServeHTTP(w, req)
+		return w
+	}
+	setRole := func(as, id, role string) int {
+		return do(as, "PUT", "/members/"+id+"/role", `{"role": "`+role+`"}`).Code
+	}
+
+	// The first member owns the household, the others are members
+	w := do("kid", "GET", "/members", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var members []MemberResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &members))
+	roles := map[string]string{}
+	for _, m := range members {
+		roles[m.ID] = m.Role
+	}
+	assert.Equal(t, map[string]string{"parent": RoleOwner, "partner": RoleMember, "kid": RoleMember}, roles)
+
+	// Members cannot manage the household
+	assert.Equal(t, http.StatusForbidden, setRole("kid", "kid", RoleAdmin))
+	assert.Equal(t, http.StatusForbidden, do("kid", "POST", "/accounts", `{"type": "cash", "name": "Mine"}`).Code)
+	assert.Equal(t, http.StatusForbidden, do("kid", "DELETE", "/members/partner", "").Code)
+	assert.Equal(t, http.StatusCreated, do("kid", "POST", "/transactions", `{"category_id": "cat-1", "amount": 5}`).Code)
+
+	// Admins can, but only owners manage owners
+	assert.Equal(t, http.StatusOK, setRole("parent", "partner", RoleAdmin))
+	assert.Equal(t, http.StatusCreated, do("partner", "POST", "/accounts", `{"type": "cash", "name": "Wallet"}`).Code)
+	assert.Equal(t, http.StatusForbidden, setRole("partner", "partner", RoleOwner))
+	assert.Equal(t, http.StatusForbidden, setRole("partner", "parent", RoleMember))
+	assert.Equal(t, http.StatusForbidden, do("partner", "DELETE", "/members/parent", "").Code)
+	assert.Equal(t, http.StatusBadRequest, setRole("partner", "kid", "superuser"))
+	assert.Equal(t, http.StatusNotFound, setRole("partner", "stranger", RoleViewer))
+
+	// Viewers are read-only, in batches too
+	assert.Equal(t, http.StatusOK, setRole("partner", "kid", RoleViewer))
+	assert.Equal(t, http.StatusOK, do("kid", "GET", "/members", "").Code)
+	assert.Equal(t, http.StatusForbidden, do("kid", "POST", "/transactions", `{"category_id": "cat-1", "amount": 5}`).Code)
+	assert.Equal(t, http.StatusForbidden, do("kid", "POST", "/batch", `{"operations": []}`).Code)
+
+	setRole("parent", "partner", RoleMember)
+	w = do("partner", "POST", "/batch", `{"operations": [
+		{"op": "create", "type": "transaction", "data": {"category_id": "cat-1", "amount": 1}},
+		{"op": "create", "type": "category", "data": {"name": "Fun", "monthly_budget": 10}}
+	]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var batch BatchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.Equal(t, http.StatusCreated, batch.Results[0].Status)
+	assert.Equal(t, http.StatusForbidden, batch.Results[1].Status)
+
+	// The last owner can neither step down nor be removed
+	assert.Equal(t, http.StatusConflict, setRole("parent", "parent", RoleAdmin))
+	assert.Equal(t, http.StatusConflict, do("parent", "DELETE", "/members/parent", "").Code)
+	assert.Equal(t, http.StatusOK, setRole("parent", "partner", RoleOwner))
+	assert.Equal(t, http.StatusOK, setRole("parent", "parent", RoleAdmin))
+	assert.Equal(t, http.StatusOK, do("partner", "DELETE", "/members/parent", "").Code)
+}
+
+func TestMigrateOwners(t *testing.T) {
+	db, _ := setupTestDB(t)
+	// Who signed up first counts, not whose membership is older
+	db.Create(&User{ID: "second", Name: "Second", Email: "second@example.com", HouseholdID: "hh-1"})
+	db.Create(&User{ID: "first", Name: "First", Email: "first@example.com", HouseholdID: "hh-1", CreatedAt: time.Now().Add(-time.Hour)})
+	db.Model(&Membership{}).Where("household_id = ?", "hh-1").Update("role", RoleMember)
+
+	require.NoError(t, MigrateOwners(db))
+	require.NoError(t, MigrateOwners(db))
+
+	roles, err := memberRoles(db, "hh-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"first": RoleOwner, "second": RoleMember}, roles)
+}
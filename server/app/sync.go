@@ -0,0 +1,279 @@
+package app
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 1000
+)
+
+// Tombstone tells a client to forget an entity.
+type Tombstone struct {
+	Type string `json:"type"` // household, member, account, category or transaction
+	ID   string `json:"id"`
+}
+
+// SyncChanges is a page of the changes made to a household after a cursor.
+type SyncChanges struct {
+	// Cursor is passed back to get the changes after this page.
+	Cursor       int64            `json:"cursor"`
+	HasMore      bool             `json:"has_more"`
+	Household    *Household       `json:"household,omitempty"`
+	Members      []MemberResponse `json:"members"`
+	Accounts     []Account        `json:"accounts"`
+	Categories   []Category       `json:"categories"`
+	Transactions []Transaction    `json:"transactions"`
+	Deleted      []Tombstone      `json:"deleted"`
+}
+
+// syncSource is a table synced to clients, with the scope of a window's
+// rows in it.
+type syncSource struct {
+	model any
+	scope func(changeWindow) func(*gorm.DB) *gorm.DB
+}
+
+// byColumn scopes a source to a household by column.
+func byColumn(column string) func(changeWindow) func(*gorm.DB) *gorm.DB {
+	return func(w changeWindow) func(*gorm.DB) *gorm.DB { return w.scope(column) }
+}
+
+var syncSources = []syncSource{
+	{&Household{}, byColumn("id")},
+	{&Membership{}, byColumn("household_id")},
+	{&User{}, changeWindow.members},
+	{&Invitation{}, byColumn("household_id")},
+	{&Account{}, byColumn("household_id")},
+	{&Category{}, byColumn("household_id")},
+	{&Transaction{}, byColumn("household_id")},
+}
+
+// changeWindow scopes a query to the household's rows changed within
+// (from, upto]. Initial syncs leave out deleted rows, which the client never
+// had.
+type changeWindow struct {
+	householdID string
+	from, upto  int64
+	initial     bool
+}
+
+func (w changeWindow) scope(column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" = ? AND change_seq > ? AND change_seq <= ?", w.householdID, w.from, w.upto)
+	}
+}
+
+// members scopes a query to the household's members changed within the
+// window. Members who joined or left are found through their memberships.
+func (w changeWindow) members() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("id IN (?) AND change_seq > ? AND change_seq <= ?", memberIDs(db, w.householdID), w.from, w.upto)
+	}
+}
+
+// changedRows returns the live rows changed in the window and the IDs of
+// the rows deleted in it.
+func changedRows[T any](db *gorm.DB, w changeWindow, scope func(*gorm.DB) *gorm.DB) ([]T, []string, error) {
+	var live []T
+	if err := db.Scopes(scope).Order("change_seq ASC").Find(&live).Error; err != nil {
+		return nil, nil, err
+	}
+	var deleted []string
+	if !w.initial {
+		if err := db.Unscoped().Model(new(T)).Scopes(scope).Where("deleted_at IS NOT NULL").Pluck("id", &deleted).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	return live, deleted, nil
+}
+
+// syncUpperBound picks the end of the page starting after from: the change
+// sequence of the limit-th changed row, or current if there are fewer. Rows
+// sharing a sequence are never split across pages.
+func (h *Handlers) syncUpperBound(w changeWindow, current int64, limit int) (int64, bool, error) {
+	all := w
+	all.upto = current
+
+	var seqs []int64
+	for _, src := range syncSources {
+		var s []int64
+		query := h.db.Model(src.model).Scopes(src.scope(all))
+		if !w.initial {
+			query = query.Unscoped()
+		}
+		if err := query.Order("change_seq ASC").Limit(limit+1).Pluck("change_seq", &s).Error; err != nil {
+			return 0, false, err
+		}
+		seqs = append(seqs, s...)
+	}
+	if len(seqs) <= limit {
+		return current, false, nil
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	upto := seqs[limit-1]
+	return upto, upto < current, nil
+}
+
+// GetSyncChanges returns what changed in the household after the cursor,
+// including tombstones for deleted entities. Without a cursor it returns
+// everything, for a first sync.
+func (h *Handlers) GetSyncChanges(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	w := changeWindow{householdID: householdID, from: -1, initial: true}
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || cursor < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		w.from = cursor
+		w.initial = false
+	}
+	limit := defaultSyncLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSyncLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxSyncLimit)})
+			return
+		}
+		limit = n
+	}
+
+	current, err := currentChangeSeq(h.db, householdID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read changes"})
+		return
+	}
+	if w.from > current {
+		// The server lost changes, e.g. after restoring a backup
+		c.JSON(http.StatusGone, gin.H{"error": "Cursor is no longer valid, sync again without it"})
+		return
+	}
+	upto, hasMore, err := h.syncUpperBound(w, current, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read changes"})
+		return
+	}
+	w.upto = upto
+
+	changes, err := h.buildSyncChanges(w)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read changes"})
+		return
+	}
+	changes.HasMore = hasMore
+	c.JSON(http.StatusOK, changes)
+}
+
+func (h *Handlers) buildSyncChanges(w changeWindow) (*SyncChanges, error) {
+	changes := &SyncChanges{
+		Cursor:       w.upto,
+		Members:      []MemberResponse{},
+		Deleted:      []Tombstone{},
+		Accounts:     []Account{},
+		Categories:   []Category{},
+		Transactions: []Transaction{},
+	}
+	tombstones := func(kind string, ids []string) {
+		for _, id := range ids {
+			changes.Deleted = append(changes.Deleted, Tombstone{Type: kind, ID: id})
+		}
+	}
+
+	households, deleted, err := changedRows[Household](h.db, w, w.scope("id"))
+	if err != nil {
+		return nil, err
+	}
+	if len(households) > 0 {
+		changes.Household = &households[0]
+	}
+	tombstones("household", deleted)
+
+	// Members are users and pending invitations, as in GetMembers. Users
+	// are sent when they or their membership change, and forgotten when
+	// they leave.
+	users, deleted, err := changedRows[User](h.db, w, w.members())
+	if err != nil {
+		return nil, err
+	}
+	var joined []Membership
+	if err := h.db.Scopes(w.scope("household_id")).Where("user_id NOT IN (?)", h.db.Model(&User{}).Scopes(w.members()).Select("id")).Find(&joined).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range joined {
+		var user User
+		if err := h.db.First(&user, "id = ?", m.UserID).Error; err == nil {
+			users = append(users, user)
+		}
+	}
+	if !w.initial {
+		var left []string
+		if err := h.db.Unscoped().Model(&Membership{}).Scopes(w.scope("household_id")).Where("deleted_at IS NOT NULL").Pluck("user_id", &left).Error; err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, left...)
+	}
+	roles, err := memberRoles(h.db, w.householdID)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		changes.Members = append(changes.Members, activeMember(user, roles[user.ID]))
+	}
+	tombstones("member", deleted)
+
+	invitations, deleted, err := changedRows[Invitation](h.db, w, w.scope("household_id"))
+	if err != nil {
+		return nil, err
+	}
+	for _, invite := range invitations {
+		if invite.Status != "pending" {
+			deleted = append(deleted, invite.ID)
+			continue
+		}
+		changes.Members = append(changes.Members, MemberResponse{
+			ID:         invite.ID,
+			Name:       "Invitado", // Placeholder
+			Email:      string(invite.Email),
+			Status:     "pending",
+			InviteCode: invite.Code,
+		})
+	}
+	if !w.initial {
+		tombstones("member", deleted)
+	}
+
+	accounts, deleted, err := changedRows[Account](h.db, w, w.scope("household_id"))
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		h.populateAccountDisplayName(&accounts[i])
+	}
+	changes.Accounts = append(changes.Accounts, accounts...)
+	tombstones("account", deleted)
+
+	categories, deleted, err := changedRows[Category](h.db, w, w.scope("household_id"))
+	if err != nil {
+		return nil, err
+	}
+	changes.Categories = append(changes.Categories, categories...)
+	tombstones("category", deleted)
+
+	transactions, deleted, err := changedRows[Transaction](h.db, w, w.scope("household_id"))
+	if err != nil {
+		return nil, err
+	}
+	changes.Transactions = append(changes.Transactions, transactions...)
+	tombstones("transaction", deleted)
+
+	return changes, nil
+}
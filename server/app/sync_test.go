@@ -0,0 +1,207 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestChangeTracking(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	cat := Category{ID: "cat-1", Name: "Food", HouseholdID: "hh"}
+	require.NoError(t, db.Create(&cat).Error)
+	assert.Equal(t, int64(1), cat.ChangeSeq)
+
+	batch := []Category{{ID: "cat-2", HouseholdID: "hh"}, {ID: "cat-3", HouseholdID: "hh"}}
+	require.NoError(t, db.Create(&batch).Error)
+	assert.Equal(t, int64(2), batch[0].ChangeSeq)
+	assert.Equal(t, int64(2), batch[1].ChangeSeq)
+
+	changeSeq := func(id string) int64 {
+		var c Category
+		require.NoError(t, db.Unscoped().First(&c, "id = ?", id).Error)
+		return c.ChangeSeq
+	}
+
+	cat.MonthlyBudget = 100
+	require.NoError(t, db.Save(&cat).Error)
+	assert.Equal(t, int64(3), changeSeq("cat-1"))
+
+	require.NoError(t, db.Model(&Category{}).Where("id = ?", "cat-1").Update("monthly_budget", 200).Error)
+	assert.Equal(t, int64(4), changeSeq("cat-1"))
+
+	require.NoError(t, db.Model(&Category{ID: "cat-2"}).Select("name").Updates(Category{Name: "Fun"}).Error)
+	assert.Equal(t, int64(5), changeSeq("cat-2"))
+
+	// Soft deletes are stamped too, whichever way they are written
+	require.NoError(t, db.Delete(&cat).Error)
+	assert.Equal(t, int64(6), changeSeq("cat-1"))
+	require.NoError(t, db.Where("household_id = ?", "hh").Delete(&Category{}, "id = ?", "cat-3").Error)
+	assert.Equal(t, int64(7), changeSeq("cat-3"))
+	var deleted Category
+	require.NoError(t, db.Unscoped().First(&deleted, "id = ?", "cat-3").Error)
+	assert.True(t, deleted.DeletedAt.Valid)
+
+	// Deleting an already deleted row still takes a sequence, but changes nothing
+	require.NoError(t, db.Delete(&Category{}, "id = ?", "cat-3").Error)
+	assert.Equal(t, int64(7), changeSeq("cat-3"))
+
+	// A rolled back change gives its sequence back
+	_ = db.Transaction(func(tx *gorm.DB) error {
+		tx.Create(&Category{ID: "cat-4", HouseholdID: "hh"})
+		return fmt.Errorf("rollback")
+	})
+	current, err := currentChangeSeq(db, "hh")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), current)
+}
+
+func TestChangeTrackingPerHousehold(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	require.NoError(t, db.Create(&Category{ID: "cat-a", HouseholdID: "hh-a"}).Error)
+	require.NoError(t, db.Create(&Category{ID: "cat-a2", HouseholdID: "hh-a"}).Error)
+	other := Category{ID: "cat-b", HouseholdID: "hh-b"}
+	require.NoError(t, db.Create(&other).Error)
+	assert.Equal(t, int64(1), other.ChangeSeq)
+
+	// Updates found by their conditions are counted in their household
+	require.NoError(t, db.Model(&Category{}).Where("id = ?", "cat-b").Update("monthly_budget", 10).Error)
+	b, err := currentChangeSeq(db, "hh-b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), b)
+
+	// A user's changes come after what each of their households saw
+	require.NoError(t, db.Create(&User{ID: "u1", Email: "u1@example.com", HouseholdID: "hh-a"}).Error)
+	_, err = addMembership(db, "u1", "hh-a")
+	require.NoError(t, err)
+	_, err = addMembership(db, "u1", "hh-b")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&User{}).Where("id = ?", "u1").Update("color", "#fff").Error)
+	var user User
+	require.NoError(t, db.First(&user, "id = ?", "u1").Error)
+	for _, householdID := range []string{"hh-a", "hh-b"} {
+		current, err := currentChangeSeq(db, householdID)
+		require.NoError(t, err)
+		assert.Equal(t, current, user.ChangeSeq, householdID)
+	}
+	assert.Equal(t, int64(4), user.ChangeSeq)
+}
+
+func TestMigrateChangeCounters(t *testing.T) {
+	db, _ := setupTestDB(t)
+	require.NoError(t, db.Create(&Household{ID: "hh-old", Name: "Old"}).Error)
+	require.NoError(t, db.Migrator().DropTable(&ChangeCounter{}))
+	require.NoError(t, db.Exec("CREATE TABLE change_counters (id integer PRIMARY KEY, value integer)").Error)
+	require.NoError(t, db.Exec("INSERT INTO change_counters (id, value) VALUES (1, 42)").Error)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, MigrateChangeCounters(db))
+	}
+	current, err := currentChangeSeq(db, "hh-old")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), current)
+
+	category := Category{ID: "cat-old", HouseholdID: "hh-old"}
+	require.NoError(t, db.Create(&category).Error)
+	assert.Equal(t, int64(43), category.ChangeSeq)
+}
+
+func getSyncChanges(t *testing.T, r *gin.Engine, query string) (int, SyncChanges) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/households/hh-sync/sync/changes"+query, nil))
+	var changes SyncChanges
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &changes))
+	}
+	return w.Code, changes
+}
+
+func TestGetSyncChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	r := gin.Default()
+	r.GET("/households/:household_id/sync/changes", h.GetSyncChanges)
+
+	db.Create(&Household{ID: "hh-sync", Name: "Home"})
+	db.Create(&User{ID: "u1", Name: "Ana", Email: "ana@example.com", HouseholdID: "hh-sync"})
+	db.Create(&Account{ID: "acc-1", Type: "cash", Name: "Cash", HouseholdID: "hh-sync"})
+	db.Create(&Category{ID: "cat-1", Name: "Food", HouseholdID: "hh-sync"})
+	db.Create(&Transaction{ID: "t1", HouseholdID: "hh-sync", CategoryID: "cat-1", Amount: 10})
+	db.Create(&Transaction{ID: "gone", HouseholdID: "hh-sync", CategoryID: "cat-1", Amount: 5})
+	db.Delete(&Transaction{}, "id = ?", "gone")
+	db.Create(&Category{ID: "other", Name: "Other", HouseholdID: "hh-other"})
+
+	// First sync: everything live, no tombstones
+	code, changes := getSyncChanges(t, r, "")
+	require.Equal(t, http.StatusOK, code)
+	require.NotNil(t, changes.Household)
+	assert.Equal(t, "Home", string(changes.Household.Name))
+	require.Len(t, changes.Members, 1)
+	assert.Equal(t, "Ana", changes.Members[0].Name)
+	require.Len(t, changes.Accounts, 1)
+	assert.Equal(t, "Cash", changes.Accounts[0].DisplayName)
+	require.Len(t, changes.Categories, 1)
+	require.Len(t, changes.Transactions, 1)
+	assert.Empty(t, changes.Deleted)
+	assert.False(t, changes.HasMore)
+	cursor := changes.Cursor
+
+	// Nothing changed
+	code, changes = getSyncChanges(t, r, fmt.Sprintf("?cursor=%d", cursor))
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, changes.Categories)
+	assert.Empty(t, changes.Transactions)
+	assert.Nil(t, changes.Household)
+	assert.Equal(t, cursor, changes.Cursor)
+
+	// Edits, deletions and invitations
+	db.Model(&Category{}).Where("id = ?", "cat-1").Update("monthly_budget", 300)
+	db.Delete(&Transaction{}, "id = ?", "t1")
+	db.Create(&Invitation{ID: "inv-1", Code: "c1", Email: "bob@example.com", HouseholdID: "hh-sync", Status: "pending"})
+	db.Create(&Invitation{ID: "inv-2", Code: "c2", Email: "eve@example.com", HouseholdID: "hh-sync", Status: "accepted"})
+
+	code, changes = getSyncChanges(t, r, fmt.Sprintf("?cursor=%d", cursor))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, changes.Categories, 1)
+	assert.Equal(t, 300.0, changes.Categories[0].MonthlyBudget)
+	assert.Empty(t, changes.Transactions)
+	require.Len(t, changes.Members, 1)
+	assert.Equal(t, "pending", changes.Members[0].Status)
+	assert.ElementsMatch(t, []Tombstone{{Type: "transaction", ID: "t1"}, {Type: "member", ID: "inv-2"}}, changes.Deleted)
+	assert.Greater(t, changes.Cursor, cursor)
+
+	// Pages never split rows changed together
+	cursor = changes.Cursor
+	db.Create(&[]Category{{ID: "cat-a", HouseholdID: "hh-sync"}, {ID: "cat-b", HouseholdID: "hh-sync"}})
+	db.Create(&Category{ID: "cat-c", HouseholdID: "hh-sync"})
+
+	code, changes = getSyncChanges(t, r, fmt.Sprintf("?cursor=%d&limit=1", cursor))
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, changes.Categories, 2)
+	assert.True(t, changes.HasMore)
+
+	code, changes = getSyncChanges(t, r, fmt.Sprintf("?cursor=%d&limit=1", changes.Cursor))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, changes.Categories, 1)
+	assert.Equal(t, "cat-c", changes.Categories[0].ID)
+	assert.False(t, changes.HasMore)
+
+	// Invalid cursors
+	code, _ = getSyncChanges(t, r, "?cursor=abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = getSyncChanges(t, r, "?cursor=99999")
+	assert.Equal(t, http.StatusGone, code)
+	code, _ = getSyncChanges(t, r, "?limit=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,461 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// webhookInterval is how often the worker looks for deliveries to send.
+	webhookInterval = 15 * time.Second
+	// webhookBatchSize caps the deliveries sent per run.
+	webhookBatchSize = 50
+	// webhookLease keeps other workers away from a delivery being sent.
+	webhookLease = 5 * time.Minute
+	// webhookMaxAttempts is how many deliveries are tried before giving up.
+	webhookMaxAttempts = 8
+	// webhookTimeout bounds how long a receiver may take to answer.
+	webhookTimeout = 10 * time.Second
+	maxWebhooks    = 10
+)
+
+// errPrivateAddress stops webhooks from reaching the server's own network.
+var errPrivateAddress = errors.New("webhook address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, where some clouds serve
+// instance metadata.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddress tells whether webhooks may connect to ip. Loopback,
+// private, link-local (which holds the cloud metadata endpoints) and
+// unspecified addresses are refused.
+func isPublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// dialPublicOnly checks the address a webhook is about to connect to, after
+// DNS resolution, so that hostnames cannot point to internal addresses.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddress(ip) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, ip)
+	}
+	return nil
+}
+
+// newWebhookClient returns the client webhooks are sent with. It only
+// connects to public addresses and does not follow redirects, which are
+// reported as failed deliveries.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: dialPublicOnly}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would connect on our behalf, unchecked
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// queueWebhooks queues an event for the household's webhooks subscribed to
+// it, within db.
+func (h *Handlers) queueWebhooks(db *gorm.DB, event Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding %s event for household %s: %v", event.Type, event.HouseholdID, err)
+		return
+	}
+
+	var webhooks []Webhook
+	if err := db.Where("household_id = ? AND active = ?", event.HouseholdID, true).Find(&webhooks).Error; err != nil {
+		log.Printf("Error listing webhooks for household %s: %v", event.HouseholdID, err)
+		return
+	}
+	for _, wh := range webhooks {
+		if !subscribed(wh, event.Type) {
+			continue
+		}
+		delivery := WebhookDelivery{
+			ID:            uuid.New().String(),
+			WebhookID:     wh.ID,
+			HouseholdID:   event.HouseholdID,
+			EventID:       event.ID,
+			Event:         event.Type,
+			Payload:       SecretString(payload),
+			Status:        WebhookPending,
+			NextAttemptAt: event.CreatedAt,
+		}
+		if err := db.Create(&delivery).Error; err != nil {
+			log.Printf("Error queueing %s event for webhook %s: %v", event.Type, wh.ID, err)
+		}
+	}
+}
+
+func subscribed(wh Webhook, eventType string) bool {
+	for _, e := range strings.Split(wh.Events, ",") {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// signPayload computes the X-Keda-Signature header. Receivers recompute the
+// HMAC-SHA256 of "<t>.<body>" with their secret and compare it to v1.
+func signPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// sendWebhook posts a delivery to its webhook and returns the response
+// status.
+func sendWebhook(client *http.Client, wh Webhook, d WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, string(wh.URL), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Keda-Webhooks")
+	req.Header.Set("X-Keda-Event", d.Event)
+	req.Header.Set("X-Keda-Delivery", d.ID)
+	req.Header.Set("X-Keda-Signature", signPayload(string(wh.Secret), now.Unix(), body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliverWebhooks sends the deliveries due at now and returns how many
+// succeeded. Deliveries are claimed like outbox emails, so several workers
+// can run at once.
+func (h *Handlers) deliverWebhooks(now time.Time, client *http.Client) int {
+	var due []WebhookDelivery
+	if err := h.db.Where("status = ? AND next_attempt_at <= ?", WebhookPending, now).
+		Order("next_attempt_at ASC").
+		Limit(webhookBatchSize).
+		Find(&due).Error; err != nil {
+		log.Printf("Error listing webhook deliveries: %v", err)
+		return 0
+	}
+
+	delivered := 0
+	for _, d := range due {
+		claim := h.db.Model(&WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", d.ID, WebhookPending, now).
+			Update("next_attempt_at", now.Add(webhookLease))
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue // Claimed by another worker
+		}
+
+		updates := map[string]any{"attempts": d.Attempts + 1}
+		// The webhooks of a deleted household are deleted with it, but still
+		// get the event saying so
+		var wh Webhook
+		err := h.db.Unscoped().First(&wh, "id = ?", d.WebhookID).Error
+		if err != nil || !wh.Active || (wh.DeletedAt.Valid && d.Event != EventHouseholdDeleted) {
+			// Deleted or disabled: keep the delivery so it can be replayed
+			updates["status"] = WebhookFailed
+			updates["last_error"] = "Webhook deleted or disabled"
+		} else if status, err := sendWebhook(client, wh, d, now); err != nil {
+			updates["response_status"] = status
+			updates["last_error"] = err.Error()
+			if d.Attempts+1 >= webhookMaxAttempts {
+				updates["status"] = WebhookFailed
+				log.Printf("Giving up on webhook delivery %s after %d attempts: %v", d.ID, d.Attempts+1, err)
+			} else {
+				updates["next_attempt_at"] = now.Add(retryBackoff(d.Attempts + 1))
+			}
+		} else {
+			updates["response_status"] = status
+			updates["status"] = WebhookDelivered
+			updates["delivered_at"] = now
+			delivered++
+		}
+		if err := h.db.Model(&WebhookDelivery{}).Where("id = ?", d.ID).Updates(updates).Error; err != nil {
+			log.Printf("Error updating webhook delivery %s: %v", d.ID, err)
+		}
+	}
+	return delivered
+}
+
+// RunWebhookWorker delivers webhook events until ctx is cancelled.
+func (h *Handlers) RunWebhookWorker(ctx context.Context) {
+	client := newWebhookClient()
+	ticker := time.NewTicker(webhookInterval)
+	defer ticker.Stop()
+
+	for {
+		h.deliverWebhooks(time.Now().UTC(), client)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ============================================================================
+// WEBHOOK SUBSCRIPTIONS
+// ============================================================================
+
+type WebhookResponse struct {
+	Webhook
+	Events []string `json:"events"`
+	// Secret is only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+func newWebhookResponse(wh Webhook) WebhookResponse {
+	return WebhookResponse{Webhook: wh, Events: strings.Split(wh.Events, ",")}
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// validate checks the request and returns the events as stored.
+func (r WebhookRequest) validate() (string, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if len(r.Events) == 0 {
+		return "", fmt.Errorf("at least one event is required")
+	}
+	seen := map[string]bool{}
+	events := []string{}
+	for _, e := range r.Events {
+		if !eventTypes[e] {
+			return "", fmt.Errorf("unknown event %q", e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	sort.Strings(events)
+	return strings.Join(events, ","), nil
+}
+
+func (h *Handlers) GetWebhooks(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var webhooks []Webhook
+	if err := h.db.Where("household_id = ?", householdID).Order("created_at ASC").Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	response := []WebhookResponse{}
+	for _, wh := range webhooks {
+		response = append(response, newWebhookResponse(wh))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handlers) CreateWebhook(c *gin.Context) {
+	householdID := c.Param("household_id")
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := req.validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	h.db.Model(&Webhook{}).Where("household_id = ?", householdID).Count(&count)
+	if count >= maxWebhooks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A household can have at most %d webhooks", maxWebhooks)})
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	webhook := Webhook{
+		ID:          uuid.New().String(),
+		HouseholdID: householdID,
+		URL:         SecretString(req.URL),
+		Secret:      SecretString("whsec_" + hex.EncodeToString(b)),
+		Events:      events,
+		Active:      req.Active == nil || *req.Active,
+	}
+	if err := h.db.Create(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	response := newWebhookResponse(webhook)
+	response.Secret = string(webhook.Secret)
+	c.JSON(http.StatusCreated, response)
+}
+
+func (h *Handlers) UpdateWebhook(c *gin.Context) {
+	householdID := c.Param("household_id")
+	id := c.Param("id")
+
+	var webhook Webhook
+	if err := h.db.First(&webhook, "id = ? AND household_id = ?", id, householdID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := req.validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook.URL = SecretString(req.URL)
+	webhook.Events = events
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	if err := h.db.Save(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newWebhookResponse(webhook))
+}
+
+func (h *Handlers) DeleteWebhook(c *gin.Context) {
+	householdID := c.Param("household_id")
+	id := c.Param("id")
+
+	result := h.db.Where("household_id = ?", householdID).Delete(&Webhook{}, "id = ?", id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// GetWebhookDeliveries lists the latest deliveries of a webhook, optionally
+// filtered by status.
+func (h *Handlers) GetWebhookDeliveries(c *gin.Context) {
+	householdID := c.Param("household_id")
+	id := c.Param("id")
+
+	query := h.db.Where("webhook_id = ? AND household_id = ?", id, householdID)
+	if status := c.Query("status"); status != "" {
+		if status != WebhookPending && status != WebhookDelivered && status != WebhookFailed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, delivered or failed"})
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = n
+	}
+
+	deliveries := []WebhookDelivery{}
+	if err := query.Order("created_at DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayWebhookDelivery sends the event of a past delivery again, as a new
+// delivery so that the log keeps the original attempts.
+func (h *Handlers) ReplayWebhookDelivery(c *gin.Context) {
+	householdID := c.Param("household_id")
+	id := c.Param("id")
+
+	var original WebhookDelivery
+	if err := h.db.First(&original, "id = ? AND webhook_id = ? AND household_id = ?", c.Param("delivery_id"), id, householdID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+
+	delivery := WebhookDelivery{
+		ID:            uuid.New().String(),
+		WebhookID:     original.WebhookID,
+		HouseholdID:   householdID,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        WebhookPending,
+		NextAttemptAt: time.Now().UTC(),
+	}
+	if err := h.db.Create(&delivery).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay delivery"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, delivery)
+}
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWebhookRouter(h *Handlers) *gin.Engine {
+	r := gin.Default()
+	r.GET("/households/:household_id/webhooks", h.GetWebhooks)
+	r.POST("/households/:household_id/webhooks", h.CreateWebhook)
+	r.PUT("/households/:household_id/webhooks/:id", h.UpdateWebhook)
+	r.DELETE("/households/:household_id/webhooks/:id", h.DeleteWebhook)
+	r.GET("/households/:household_id/webhooks/:id/deliveries", h.GetWebhookDeliveries)
+	r.POST("/households/:household_id/webhooks/:id/deliveries/:delivery_id/replay", h.ReplayWebhookDelivery)
+	r.POST("/households/:household_id/transactions", h.CreateTransaction)
+	return r
+}
+
+func TestSignPayload(t *testing.T) {
+	// Receivers verify with HMAC-SHA256("<t>.<body>")
+	sig := signPayload("secret", 1700000000, []byte(`{"a":1}`))
+	assert.Equal(t, "t=1700000000,v1=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686", sig)
+}
+
+func TestWebhookRequestValidation(t *testing.T) {
+	events, err := WebhookRequest{URL: "https://example.com/hook", Events: []string{EventTransactionCreated, EventCategoryUpdated, EventTransactionCreated}}.validate()
+	require.NoError(t, err)
+	assert.Equal(t, "category.updated,transaction.created", events)
+
+	for _, req := range []WebhookRequest{
+		{URL: "ftp://example.com", Events: []string{EventTransactionCreated}},
+		{URL: "/relative", Events: []string{EventTransactionCreated}},
+		{URL: "https://example.com"},
+		{URL: "https://example.com", Events: []string{"transaction.exploded"}},
+	} {
+		_, err := req.validate()
+		assert.Error(t, err, req)
+	}
+}
+
+func TestWebhookClient_PublicAddressesOnly(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.100.100.200": false,
+		"fd00:ec2::254":   false,
+		"fe80::1":         false,
+		"0.0.0.0":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		assert.Equal(t, public, isPublicAddress(netip.MustParseAddr(addr)), addr)
+	}
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+	_, err := sendWebhook(newWebhookClient(), Webhook{URL: SecretString(receiver.URL)}, WebhookDelivery{Payload: "{}"}, time.Now())
+	assert.ErrorIs(t, err, errPrivateAddress)
+
+	// Redirects are not followed
+	redirect := httptest.NewServer(http.RedirectHandler(receiver.URL, http.StatusFound))
+	defer redirect.Close()
+	client := newWebhookClient()
+	client.Transport = redirect.Client().Transport
+	status, err := sendWebhook(client, Webhook{URL: SecretString(redirect.URL)}, WebhookDelivery{Payload: "{}"}, time.Now())
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusFound, status)
+}
+
+func TestWebhooks_EndToEnd(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	r := setupWebhookRouter(h)
+	householdID := "hh-hooks"
+
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	fail := true
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(req.Body)
+		received = append(received, req)
+		bodies = append(bodies, body)
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	// Subscribe
+	body, _ := json.Marshal(WebhookRequest{URL: receiver.URL, Events: []string{EventTransactionCreated}})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/households/"+householdID+"/webhooks", bytes.NewBuffer(body)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created WebhookResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, strings.HasPrefix(created.Secret, "whsec_"))
+	assert.Equal(t, []string{EventTransactionCreated}, created.Events)
+	assert.True(t, created.Active)
+
+	// The secret is not shown again
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/households/"+householdID+"/webhooks", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Secret)
+
+	// A new transaction queues a delivery; unrelated events do not
+	body, _ = json.Marshal(map[string]any{"amount": 12.5, "date": "2024-05-10T00:00:00Z", "note": "Pizza"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/households/"+householdID+"/transactions", bytes.NewBuffer(body)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	h.publishEvent(householdID, EventCategoryDeleted, deletedResource{ID: "cat-1"})
+	h.publishEvent("other-household", EventTransactionCreated, deletedResource{ID: "t-1"})
+
+	var deliveries []WebhookDelivery
+	require.NoError(t, db.Find(&deliveries).Error)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, EventTransactionCreated, deliveries[0].Event)
+
+	// A failing receiver is retried with backoff
+	client := receiver.Client()
+	now := time.Now().UTC().Add(time.Second)
+	assert.Equal(t, 0, h.deliverWebhooks(now, client))
+	var delivery WebhookDelivery
+	require.NoError(t, db.First(&delivery, "id = ?", deliveries[0].ID).Error)
+	assert.Equal(t, WebhookPending, delivery.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.ResponseStatus)
+	assert.True(t, delivery.NextAttemptAt.Equal(now.Add(30*time.Second)))
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	assert.Equal(t, 1, h.deliverWebhooks(delivery.NextAttemptAt, client))
+	require.NoError(t, db.First(&delivery, "id = ?", deliveries[0].ID).Error)
+	assert.Equal(t, WebhookDelivered, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+
+	// Signed payload
+	require.Len(t, received, 2)
+	last := received[1]
+	assert.Equal(t, EventTransactionCreated, last.Header.Get("X-Keda-Event"))
+	assert.Equal(t, delivery.ID, last.Header.Get("X-Keda-Delivery"))
+	signature := last.Header.Get("X-Keda-Signature")
+	timestamp, err := strconv.ParseInt(strings.TrimPrefix(strings.Split(signature, ",")[0], "t="), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, signPayload(created.Secret, timestamp, bodies[1]), signature)
+
+	var event struct {
+		Type        string `json:"type"`
+		HouseholdID string `json:"household_id"`
+		Data        struct {
+			Amount float64 `json:"amount"`
+			Note   string  `json:"note"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(bodies[1], &event))
+	assert.Equal(t, EventTransactionCreated, event.Type)
+	assert.Equal(t, householdID, event.HouseholdID)
+	assert.Equal(t, 12.5, event.Data.Amount)
+	assert.Equal(t, "Pizza", event.Data.Note)
+
+	// Delivery log and replay
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/households/"+householdID+"/webhooks/"+created.ID+"/deliveries?status=delivered", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var logged []WebhookDelivery
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &logged))
+	require.Len(t, logged, 1)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/households/"+householdID+"/webhooks/"+created.ID+"/deliveries/"+delivery.ID+"/replay", nil))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var replay WebhookDelivery
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &replay))
+	assert.NotEqual(t, delivery.ID, replay.ID)
+	assert.Equal(t, delivery.EventID, replay.EventID)
+
+	assert.Equal(t, 1, h.deliverWebhooks(time.Now().UTC().Add(time.Second), client))
+	require.Len(t, bodies, 3)
+	assert.Equal(t, bodies[1], bodies[2])
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/households/other/webhooks/"+created.ID+"/deliveries/"+delivery.ID+"/replay", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeliverWebhooks_GivesUp(t *testing.T) {
+	db, cfg := setupTestDB(t)
+	h := NewHandlers(db, cfg)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db.Create(&Webhook{ID: "wh-1", HouseholdID: "hh", URL: SecretString(receiver.URL), Secret: "s", Events: EventTransactionCreated, Active: true})
+	db.Create(&Webhook{ID: "wh-2", HouseholdID: "hh", URL: SecretString(receiver.URL), Secret: "s", Events: EventTransactionCreated})
+	db.Create(&WebhookDelivery{ID: "d-1", WebhookID: "wh-1", HouseholdID: "hh", Payload: "{}", Status: WebhookPending, NextAttemptAt: now})
+	db.Create(&WebhookDelivery{ID: "d-2", WebhookID: "wh-2", HouseholdID: "hh", Payload: "{}", Status: WebhookPending, NextAttemptAt: now})
+
+	var delivery WebhookDelivery
+	for delivery.Status != WebhookFailed {
+		h.deliverWebhooks(now, receiver.Client())
+		require.NoError(t, db.First(&delivery, "id = ?", "d-1").Error)
+		now = delivery.NextAttemptAt
+	}
+	assert.Equal(t, webhookMaxAttempts, delivery.Attempts)
+	assert.Equal(t, "unexpected status 500", delivery.LastError)
+
+	// Disabled webhooks are not called
+	var disabled WebhookDelivery
+	require.NoError(t, db.First(&disabled, "id = ?", "d-2").Error)
+	assert.Equal(t, WebhookFailed, disabled.Status)
+	assert.Equal(t, 1, disabled.Attempts)
+}
@@ -31,6 +31,22 @@ type Config struct {
 	SMTPUser string `mapstructure:"smtp_user"`
 	SMTPPass string `mapstructure:"smtp_pass"`
 	SMTPFrom string `mapstructure:"smtp_from"`
+
+	// DigestEnabled turns on the monthly digest email scheduler
+	DigestEnabled bool `mapstructure:"digest_enabled"`
+
+	// Invitations
+	// InvitationTTLHours is how long invitations can be accepted; 0 means forever
+	InvitationTTLHours int `mapstructure:"invitation_ttl_hours"`
+	// InvitationRequireEmailMatch only lets the invited email accept an invitation
+	InvitationRequireEmailMatch bool `mapstructure:"invitation_require_email_match"`
+
+	// HouseholdPurgeDays is how long a deleted household can be restored
+	// before its data is purged
+	HouseholdPurgeDays int `mapstructure:"household_purge_days"`
+	// AccountReactivationDays is how long users who deleted their account
+	// can sign in to get it back, before their personal data is erased
+	AccountReactivationDays int `mapstructure:"account_reactivation_days"`
 }
 
 // LoadConfig loads configuration from environment variables and/or a config file.
@@ -60,6 +76,11 @@ func LoadConfig(path string) (*Config, error) {
 	viper.SetDefault("smtp_user", "")
 	viper.SetDefault("smtp_pass", "")
 	viper.SetDefault("smtp_from", "noreply@keda.local")
+	viper.SetDefault("digest_enabled", true)
+	viper.SetDefault("invitation_ttl_hours", 168)
+	viper.SetDefault("invitation_require_email_match", false)
+	viper.SetDefault("household_purge_days", 30)
+	viper.SetDefault("account_reactivation_days", 30)
 
 	if path != "" {
 		viper.SetConfigFile(path)
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -24,14 +27,29 @@ func main() {
 		log.Fatalf("Could not load config: %v", err)
 	}
 
-	r := gin.Default()
+	// Maintenance commands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backup":
+			runBackup(cfg, os.Args[2:])
+			return
+		case "restore":
+			runRestore(cfg, os.Args[2:])
+			return
+		}
+	}
+
+	// gin.Default without its logger, which would print the access tokens
+	// of event streams
+	r := gin.New()
+	r.Use(app.AccessLogger(), gin.Recovery())
 
 	// Configure CORS
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Idempotency-Key", "If-Match"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "ETag"},
 		AllowCredentials: true,
 	}))
 
@@ -40,6 +58,17 @@ func main() {
 	// Initialize handlers
 	handlers := app.NewHandlers(db, cfg)
 
+	// Background jobs
+	go handlers.RunOutboxWorker(context.Background())
+	go handlers.RunWebhookWorker(context.Background())
+	go handlers.RunIdempotencyCleanup(context.Background())
+	go handlers.RunInvitationExpiry(context.Background())
+	go handlers.RunHouseholdPurge(context.Background())
+	go handlers.RunAccountAnonymisation(context.Background())
+	if cfg.DigestEnabled && !cfg.TestMode {
+		go handlers.RunDigestScheduler(context.Background())
+	}
+
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -60,46 +89,116 @@ func main() {
 	}
 
 	// Households
-	r.POST("/households", handlers.CreateHousehold)
+	r.POST("/households", handlers.UserMiddleware(), handlers.CreateHousehold)
+
+	// Current user, across their households
+	me := r.Group("/me")
+	me.Use(handlers.UserMiddleware())
+	{
+		me.GET("", handlers.GetMe)
+		me.PATCH("", handlers.UpdateMe)
+		me.DELETE("", handlers.DeleteMe)
+		me.GET("/households", handlers.GetMyHouseholds)
+		me.POST("/households/switch", handlers.SwitchHousehold)
+		me.POST("/households/:household_id/leave", handlers.LeaveHousehold)
+		me.POST("/households/:household_id/restore", handlers.RestoreHousehold)
+		me.POST("/invitations/accept", handlers.AcceptInvitation)
+	}
 
 	// Scoped routes
 	h := r.Group("/households/:household_id")
-	h.Use(handlers.JWTMiddleware())
+	h.Use(handlers.JWTMiddleware(), handlers.PermissionMiddleware(), handlers.IdempotencyMiddleware())
+	// Viewers can only read; only admins manage members, accounts and budgets
+	admin := handlers.RequireRole(app.RoleAdmin)
+	owner := handlers.RequireRole(app.RoleOwner)
 	{
+		// Household
+		h.GET("", handlers.GetHousehold)
+		h.PATCH("", admin, handlers.UpdateHousehold)
+		h.DELETE("", owner, handlers.DeleteHousehold)
+		h.POST("/transfer-ownership", owner, handlers.TransferOwnership)
+
 		// Legacy sync endpoint (for backwards compatibility)
 		h.GET("/sync", handlers.HandleSync)
+		h.GET("/sync/changes", handlers.GetSyncChanges)
+
+		// Real-time updates
+		h.GET("/events", handlers.StreamEvents)
 
 		// Invitations
-		h.POST("/invites", handlers.CreateInvitation)
+		h.POST("/invites", admin, handlers.CreateInvitation)
+		h.POST("/invites/:id/resend", admin, handlers.ResendInvitation)
+		h.POST("/invites/:id/revoke", admin, handlers.RevokeInvitation)
 
 		// Members
 		h.GET("/members", handlers.GetMembers)
-		h.DELETE("/members/:user_id", handlers.RemoveMember)
+		h.DELETE("/members/:user_id", admin, handlers.RemoveMember)
+		h.PUT("/members/:user_id/role", admin, handlers.UpdateMemberRole)
 
 		// Categories
 		h.GET("/categories", handlers.GetCategories)
-		h.POST("/categories", handlers.CreateCategory)
-		h.PUT("/categories/:id", handlers.UpdateCategory)
-		h.DELETE("/categories/:id", handlers.DeleteCategory)
+		h.GET("/categories/:id", handlers.GetCategory)
+		h.POST("/categories", admin, handlers.CreateCategory)
+		h.PUT("/categories/:id", admin, handlers.UpdateCategory)
+		h.DELETE("/categories/:id", admin, handlers.DeleteCategory)
 		h.GET("/categories/:id/suggested-notes", handlers.GetSuggestedNotes)
 
 		// Accounts
 		h.GET("/accounts", handlers.GetAccounts)
-		h.POST("/accounts", handlers.CreateAccount)
-		h.PUT("/accounts/:id", handlers.UpdateAccount)
-		h.DELETE("/accounts/:id", handlers.DeleteAccount)
+		h.GET("/accounts/:id", handlers.GetAccount)
+		h.POST("/accounts", admin, handlers.CreateAccount)
+		h.PUT("/accounts/:id", admin, handlers.UpdateAccount)
+		h.DELETE("/accounts/:id", admin, handlers.DeleteAccount)
+		h.POST("/accounts/:id/import/ofx", handlers.ImportOFX)
 
 		// Transactions
 		h.GET("/transactions", handlers.GetTransactions)
+		h.GET("/transactions/:id", handlers.GetTransaction)
 		h.POST("/transactions", handlers.CreateTransaction)
 		h.PUT("/transactions/:id", handlers.UpdateTransaction)
 		h.DELETE("/transactions/:id", handlers.DeleteTransaction)
+		h.POST("/batch", handlers.ApplyBatch)
 
 		// Monthly summary
 		h.GET("/summary/:month", handlers.GetMonthlySummary)
 
+		// Reports
+		h.GET("/trends", handlers.GetTrends)
+		h.GET("/reports/members", handlers.GetMemberReport)
+		h.GET("/reports/accounts", handlers.GetAccountReport)
+
 		// Recommendations
 		h.GET("/recommendations", handlers.GetRecommendations)
+		h.POST("/recommendations/:category_id/accept", admin, handlers.AcceptRecommendation)
+		h.POST("/recommendations/:category_id/dismiss", handlers.DismissRecommendation)
+		h.POST("/recommendations/:category_id/snooze", handlers.SnoozeRecommendation)
+
+		// Budget alerts
+		h.GET("/alerts", handlers.GetBudgetAlerts)
+		h.GET("/alerts/settings", handlers.GetAlertSettings)
+		h.PUT("/alerts/settings", admin, handlers.UpdateAlertSettings)
+		h.PUT("/alerts/subscription", handlers.UpdateAlertSubscription)
+		h.PUT("/categories/:id/alerts", admin, handlers.UpdateCategoryAlerts)
+
+		// Email outbox
+		h.GET("/outbox", admin, handlers.GetOutbox)
+		h.POST("/outbox/:id/retry", admin, handlers.RetryOutboxEmail)
+
+		// Webhooks
+		h.GET("/webhooks", admin, handlers.GetWebhooks)
+		h.POST("/webhooks", admin, handlers.CreateWebhook)
+		h.PUT("/webhooks/:id", admin, handlers.UpdateWebhook)
+		h.DELETE("/webhooks/:id", admin, handlers.DeleteWebhook)
+		h.GET("/webhooks/:id/deliveries", admin, handlers.GetWebhookDeliveries)
+		h.POST("/webhooks/:id/deliveries/:delivery_id/replay", admin, handlers.ReplayWebhookDelivery)
+
+		// Exports
+		h.GET("/export/transactions", handlers.ExportTransactions)
+		h.GET("/export/summaries", handlers.ExportSummaries)
+		h.GET("/export/journal", handlers.ExportJournal)
+
+		// Backup
+		h.POST("/backup", admin, handlers.ExportBackup)
 	}
 
 	port := cfg.Port
@@ -132,10 +231,29 @@ func initDB(cfg *config.Config) {
 
 	log.Println("Successfully connected to database")
 
+	if err := db.Use(app.ChangeTracking{}); err != nil {
+		log.Fatalf("Could not enable change tracking: %v", err)
+	}
+
 	// Run GORM Migrations
+	if err := app.MigrateChangeCounters(db); err != nil {
+		log.Fatalf("Could not migrate change counters: %v", err)
+	}
 	if err := db.AutoMigrate(app.Entities...); err != nil {
 		log.Fatalf("Could not run migrations: %v", err)
 	}
+	if err := app.MigrateIdempotencyKeys(db); err != nil {
+		log.Fatalf("Could not migrate idempotency keys: %v", err)
+	}
+	if err := app.MigrateMemberships(db); err != nil {
+		log.Fatalf("Could not migrate memberships: %v", err)
+	}
+	if err := app.MigrateOwners(db); err != nil {
+		log.Fatalf("Could not migrate household owners: %v", err)
+	}
+	if err := app.MigrateInvitationExpiry(db, cfg.InvitationTTLHours); err != nil {
+		log.Fatalf("Could not migrate invitation expiry: %v", err)
+	}
 
 	// Seed data if in TEST_MODE
 	if cfg.TestMode {
@@ -153,3 +271,78 @@ func initDB(cfg *config.Config) {
 		log.Printf("⚠️  Failed to run encryption migration: %v", err)
 	}
 }
+
+// runBackup writes a household backup to a file:
+//
+//	server backup -household <id> -out backup.json.gz [-passphrase ...]
+//
+// The passphrase can also be set with KEDA_BACKUP_PASSPHRASE.
+func runBackup(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	householdID := fs.String("household", "", "ID of the household to back up")
+	out := fs.String("out", "", "Output file")
+	passphrase := fs.String("passphrase", os.Getenv("KEDA_BACKUP_PASSPHRASE"), "Optional passphrase to encrypt the backup")
+	_ = fs.Parse(args)
+
+	if *householdID == "" || *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	initDB(cfg)
+
+	archive, err := app.BuildHouseholdArchive(db, *householdID)
+	if err != nil {
+		log.Fatalf("Could not build backup: %v", err)
+	}
+
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Fatalf("Could not create %s: %v", *out, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := app.WriteBackup(f, archive, *passphrase); err != nil {
+		log.Fatalf("Could not write backup: %v", err)
+	}
+	log.Printf("✅ Household %s backed up to %s", *householdID, *out)
+}
+
+// runRestore recreates a household from a backup file:
+//
+//	server restore -in backup.json.gz [-passphrase ...]
+func runRestore(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("in", "", "Backup file to restore")
+	passphrase := fs.String("passphrase", os.Getenv("KEDA_BACKUP_PASSPHRASE"), "Passphrase of an encrypted backup")
+	_ = fs.Parse(args)
+
+	if *in == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	initDB(cfg)
+
+	f, err := os.Open(*in)
+	if err != nil {
+		log.Fatalf("Could not open %s: %v", *in, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	archive, err := app.ReadBackup(f, *passphrase)
+	if err != nil {
+		log.Fatalf("Could not read backup: %v", err)
+	}
+
+	result, err := app.RestoreHouseholdArchive(db, archive)
+	if err != nil {
+		log.Fatalf("Could not restore backup: %v", err)
+	}
+
+	log.Printf("✅ Restored household %s: %d users (%d already existed), %d memberships, %d accounts, %d categories, %d transactions, %d invitations",
+		result.HouseholdID, result.Users, result.ExistingUsers, result.Memberships, result.Accounts, result.Categories, result.Transactions, result.Invitations)
+	for oldID, newID := range result.IDMap {
+		log.Printf("   remapped %s -> %s", oldID, newID)
+	}
+}